@@ -4,26 +4,43 @@ import (
 	"context"
 	"encoding/json"
 	"encoding/xml"
-	"fmt"
-	"log"
+	"errors"
 	"os"
-	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
-	"github.com/fatih/color"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
 	"github.com/tarathep/apimtool/models"
 )
 
 type APIM struct {
 	SubscriptionID string
 	Location       string
-	Credential     *azidentity.DefaultAzureCredential
+	Credential     azcore.TokenCredential
+	Cloud          cloud.Configuration
 	Context        context.Context
+	Parallel       int
+	Cache          time.Duration
+	Backends       *BackendIndex
+	// API version and schema of generated templates
+	Template TemplateOptions
+	// mode of matching backend URLs of lookups, URLMatchExact or URLMatchPrefix (default)
+	URLMatch string
 }
 
-type apiModel struct {
+// Mode of matching backend URLs, prefix by default
+func (a APIM) URLMatchMode() string {
+	if a.URLMatch == "" {
+		return URLMatchPrefix
+	}
+	return a.URLMatch
+}
+
+// API with backend of set-backend-service policy and operations
+type APIModel struct {
 	No               int
 	APIName          string
 	APIDisplayName   string
@@ -35,305 +52,166 @@ type apiModel struct {
 	Operation        []Operation
 }
 
-func Env() struct {
+func Env() (struct {
 	SubscriptionID string
 	Location       string
-} {
-	subscriptionID := os.Getenv("APIMTOOL_AZURE_SUBSCRIPTION_ID")
+}, error) {
+	env := struct {
+		SubscriptionID string
+		Location       string
+	}{}
 
-	if len(subscriptionID) == 0 {
-		log.Fatal("APIMTOOL_AZURE_SUBSCRIPTION_ID is not set.")
+	env.SubscriptionID = os.Getenv("APIMTOOL_AZURE_SUBSCRIPTION_ID")
+	if len(env.SubscriptionID) == 0 {
+		return env, errors.New("APIMTOOL_AZURE_SUBSCRIPTION_ID is not set")
 	}
-	location := os.Getenv("APIMTOOL_AZURE_LOCATION")
 
-	if len(location) == 0 {
-		log.Fatal("APIMTOOL_AZURE_LOCATION is not set.")
+	env.Location = os.Getenv("APIMTOOL_AZURE_LOCATION")
+	if len(env.Location) == 0 {
+		return env, errors.New("APIMTOOL_AZURE_LOCATION is not set")
 	}
 
-	return struct {
-		SubscriptionID string
-		Location       string
-	}{SubscriptionID: subscriptionID, Location: location}
+	return env, nil
 }
 
-func (apim APIM) ListBackend(resourceGroup, serviceName, filterDisplayName, option string) {
-	color.New(color.Italic, color.FgHiBlue, color.Bold).Print("List Backend's\n\n")
-
-	backends, err := apim.getBackends(resourceGroup, serviceName, filterDisplayName)
-
+// List backends which name contains filter
+func (a APIM) ListBackend(resourceGroup, serviceName, filter string) ([]Backend, error) {
+	index, err := a.BackendIndex(resourceGroup, serviceName)
 	if err != nil {
-		color.New(color.FgRed).Println("Fail to get APIs", err)
-		return
+		return []Backend{}, err
 	}
+	return index.Filter(filter), nil
+}
 
-	var (
-		maxNameSize, maxBackendURLSize int
-	)
-	if option == "" {
-		option = "table"
-	}
-
-	switch option {
-	case "table":
-		{
-			if len(backends) == 0 {
-				color.New(color.FgHiBlue).Println("Not Found")
-				return
-			}
-			// find max len values for print
-			for _, backend := range backends {
-				if len(backend.Name) > maxNameSize {
-					maxNameSize = len(backend.Name)
-				}
-
-				if len(backend.URL) > maxBackendURLSize {
-					maxBackendURLSize = len(backend.URL)
-				}
-
-			}
-			if maxNameSize < 4 {
-				maxNameSize = 4
-			}
-
-			if maxBackendURLSize < 10 {
-				maxBackendURLSize = 10
-			}
-
-			color.New(color.FgHiMagenta).Printf("%*s  %*s  %*s\n", 3, "No.", maxNameSize, "NAME", maxBackendURLSize, "BackendURL")
-			for i, backend := range backends {
-				color.New(color.FgHiWhite).Printf("%*d  %*s  %*s\n", 3, (i + 1), maxNameSize, backend.Name, maxBackendURLSize, backend.URL)
-			}
-		}
-	case "list":
-		{
-			for i, backend := range backends {
-				color.New(color.FgHiBlack).Print("No : ")
-				fmt.Println(1 + i)
-				color.New(color.FgHiBlack).Print("BACKEND NAME : ")
-				fmt.Println(backend.Name)
-				color.New(color.FgHiBlack).Print("BACKEND URL : ")
-				fmt.Println(backend.URL)
-				color.New(color.FgHiBlack).Print("BACKEND Protocol : ")
-				fmt.Println(backend.Protocol)
-				color.New(color.FgHiWhite).Println("------------------------------------------------------------")
-			}
-
-		}
+// List APIs which displayName contains filterDisplayName
+func (a APIM) ListAPI(resourceGroup, serviceName, filterDisplayName string) ([]Api, error) {
+	apis, err := a.getAPIs(resourceGroup, serviceName, filterDisplayName)
+	if err != nil {
+		return []Api{}, err
 	}
+	return apis, nil
 }
 
-func (apim APIM) ListAPI(resourceGroup, serviceName, filterDisplayName string, option string) {
-	start := time.Now()
-	color.New(color.Italic, color.FgHiBlue, color.Bold).Print("List API Management API's\n\n")
-
-	apis, err := apim.getAPIs(resourceGroup, serviceName, filterDisplayName)
+// List APIs with backend policy and operations, in the same order of ListAPI
+func (a APIM) ListAPIModel(resourceGroup, serviceName, filterDisplayName string) ([]APIModel, error) {
+	apis, err := a.getAPIs(resourceGroup, serviceName, filterDisplayName)
 	if err != nil {
-		color.New(color.FgRed).Println("Fail to get APIs", err)
-		return
+		return []APIModel{}, err
 	}
 
-	var (
-		maxApiNameSize, maxDisplayNameSize, maxProtocalSize, maxApiPathSize, maxApiBackendURLSize int
-	)
-	if option == "" {
-		option = "table"
+	// Load backends once for all APIs instead of a request per API, a.Backends is reused when the caller loaded it
+	index, err := a.BackendIndex(resourceGroup, serviceName)
+	if err != nil {
+		return []APIModel{}, err
 	}
+	a.Backends = index
 
-	switch option {
-	case "table":
-		{
-			if len(apis) == 0 {
-				color.New(color.FgHiBlue).Println("Not Found")
-				return
-			}
-			// find max len values for print
-			for _, api := range apis {
-				if len(api.Name) > maxApiNameSize {
-					maxApiNameSize = len(api.Name)
-				}
-
-				if len(api.DisplayName) > maxDisplayNameSize {
-					maxDisplayNameSize = len(api.DisplayName)
-				}
-
-				maxProtocalSizeT := func() int {
-					ps := ""
-					for _, p := range api.Protocols {
-						ps += " " + p
-					}
-					return len(ps)
-				}()
+	// Each worker writes only its own index, the result keeps the order of getAPIs
+	apiModels := make([]APIModel, len(apis))
+	err = a.forEach(len(apis), func(a APIM, i int) error {
+		model, err := a.apiModel(resourceGroup, serviceName, apis[i])
+		apiModels[i] = model
+		return err
+	})
+	if err != nil {
+		return []APIModel{}, err
+	}
+	return apiModels, nil
+}
 
-				if maxProtocalSizeT > maxProtocalSize {
-					maxProtocalSize = maxProtocalSizeT
-				}
+// Run fn for 0..n-1 with a.parallel() workers, fn gets a with the context of the workers which is
+// cancelled on the first error or when the parent context is done (e.g. Ctrl+C)
+func (a APIM) forEach(n int, fn func(a APIM, i int) error) error {
+	ctx, cancel := context.WithCancel(a.Context)
+	defer cancel()
+	a.Context = ctx
 
-				if len(api.Path) > maxApiPathSize {
-					maxApiPathSize = len(api.Path)
-				}
+	jobs := make(chan int)
 
-				if len(api.BackendURL) > maxApiBackendURLSize {
-					maxApiBackendURLSize = len(api.BackendURL)
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for w := 0; w < a.parallel(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := fn(a, i); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
 				}
 			}
-			if maxApiNameSize < 4 {
-				maxApiNameSize = 4
-			}
-			if maxDisplayNameSize < 11 {
-				maxDisplayNameSize = 11
-			}
-			if maxProtocalSize < 11 {
-				maxProtocalSize = 11
-			}
-			if maxApiPathSize < 4 {
-				maxApiPathSize = 4
-			}
-			if maxApiBackendURLSize < 10 {
-				maxApiBackendURLSize = 10
-			}
+		}()
+	}
 
-			color.New(color.FgHiMagenta).Printf("%*s  %*s  %*s  %*s  %*s  %*s\n", 3, "No.", maxApiNameSize, "NAME", maxDisplayNameSize, "DisplayName", maxProtocalSize, "Protocol(s)", maxApiPathSize, "Path", maxApiBackendURLSize, "BackendURL")
-			for i, api := range apis {
-				color.New(color.FgHiWhite).Printf("%*d  %*s  %*s  %*s  %*s  %*s\n", 3, (i + 1), maxApiNameSize, api.Name, maxDisplayNameSize, api.DisplayName, maxProtocalSize, func() string {
-					ps := ""
-					for _, p := range api.Protocols {
-						ps += " " + p
-					}
-					return ps
-				}(), maxApiPathSize, api.Path, maxApiBackendURLSize, api.BackendURL)
-			}
+dispatch:
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
 		}
-	case "list":
-		{
-			err, apiModels := apim.apis(resourceGroup, serviceName, filterDisplayName)
-			if err != nil {
-				return
-			}
-			// Sort by No, keeping original order or equal elements.
-			sort.SliceStable(apiModels, func(i, j int) bool {
-				return apiModels[i].No < apiModels[j].No
-			})
-
-			for i, model := range apiModels {
-				color.New(color.FgHiBlack).Print("No : ")
-				fmt.Println(1 + i)
-				color.New(color.FgHiBlack).Print("API NAME : ")
-				fmt.Println(model.APIName)
-				color.New(color.FgHiBlack).Print("API DISPLAY NAME : ")
-				fmt.Println(model.APIDisplayName)
-				color.New(color.FgHiBlack).Print("PROTOCOL(s) : ")
-				fmt.Println(model.APIProtocols)
-				color.New(color.FgHiBlack).Print("PATH : ")
-				fmt.Println(model.APIPath)
-				color.New(color.FgHiBlack).Print("Backend URL : ")
-				fmt.Println(model.APIBackendURL)
-
-				color.New(color.FgHiBlack).Print("Backend Policy ID : ")
-
-				fmt.Println(model.BackendPolicyID)
-
-				color.New(color.FgHiBlack).Print("Backend Policy URL : ")
-
-				fmt.Println(model.BackendPolicyURL)
-
-				color.New(color.FgHiBlack).Print("Operations : \n")
-				operations := model.Operation
-
-				for i, operation := range operations {
-					color.New(color.FgHiWhite).Print("  ", (i + 1), " ")
-					switch operation.Method {
-					case "GET":
-						color.New(color.FgHiBlue).Print(operation.Method, " ")
-					case "POST":
-						color.New(color.FgHiGreen).Print(operation.Method, " ")
-					case "PUT":
-						color.New(color.FgHiYellow).Print(operation.Method, " ")
-					case "DELETE":
-						color.New(color.FgHiRed).Print(operation.Method, " ")
-					case "PATCH":
-						color.New(color.FgHiCyan).Print(operation.Method, " ")
-					default:
-						color.New(color.FgHiBlack).Print(operation.Method, " ")
-					}
-					color.New(color.FgHiWhite).Println(operation.Name, operation.URLTemplate)
-				}
-				color.New(color.FgHiWhite).Println("------------------------------------------------------------")
-			}
+	}
+	close(jobs)
+	wg.Wait()
 
-		}
+	if firstErr != nil {
+		return firstErr
 	}
-	fmt.Println("\nTime used is ", time.Since(start))
+	return ctx.Err()
 }
 
-func (a APIM) apis(resourceGroup, serviceName, filterDisplayName string) (error, []apiModel) {
-	apis, err := a.getAPIs(resourceGroup, serviceName, filterDisplayName)
-	if err != nil {
-		color.New(color.FgRed).Println("Fail to get APIs", err)
-		return err, []apiModel{}
+// Number of concurrent workers for fetching API details, default is 8
+func (a APIM) parallel() int {
+	if a.Parallel <= 0 {
+		return 8
 	}
+	return a.Parallel
+}
 
-	var apiModels []apiModel
-
-	// Create a WaitGroup to synchronize the Go routines
-	var wg sync.WaitGroup
-	wg.Add(len(apis))
-
-	for _, api := range apis {
-		go func(api Api) {
-			defer wg.Done()
-
-			apiModel := func(api Api) apiModel {
-				var model apiModel
-				model.No = api.No
-				model.APIName = api.Name
-				model.APIDisplayName = api.DisplayName
-				model.APIProtocols = api.Protocols
-				model.APIPath = api.Path
-				model.APIBackendURL = api.BackendURL
-
-				//Create a Channel for GetAPIPolicy
-				c1 := make(chan string)
-
-				go func(a APIM, resourceGroup string, serviceName string, Name string) {
-					c1 <- a.GetAPIPolicy(resourceGroup, serviceName, Name).Inbound.SetBackendService.BackendID
-				}(a, resourceGroup, serviceName, api.Name)
-
-				backendPolicyID := <-c1
-				model.BackendPolicyID = backendPolicyID
-
-				//Create a Channel for GetBackendURLfromID
-				c2 := make(chan string)
-				go func(a APIM, resourceGroup string, serviceName string, backendPolicyID string) {
-					backendPolicyURL, err := a.GetBackendURLfromID(resourceGroup, serviceName, backendPolicyID)
-					if err != nil {
-						color.New(color.FgHiRed).Println("Error", err)
-					}
-					c2 <- backendPolicyURL
-				}(a, resourceGroup, serviceName, backendPolicyID)
-
-				//Create a Channel for Operation
-				model.BackendPolicyURL = <-c2
-
-				c3 := make(chan []Operation)
-				go func(a APIM, resourceGroup string, serviceName string, Name string) {
-					operation, err := a.getOperations(resourceGroup, serviceName, api.Name, "")
-					if err != nil {
-						color.New(color.FgHiRed).Println("Error", err)
-					}
-					c3 <- operation
-				}(a, resourceGroup, serviceName, api.Name)
-
-				model.Operation = <-c3
+// Fetch policy, backend and operations of an API, operations is fetched while resolving the backend
+func (a APIM) apiModel(resourceGroup, serviceName string, api Api) (APIModel, error) {
+	model := APIModel{
+		No:             api.No,
+		APIName:        api.Name,
+		APIDisplayName: api.DisplayName,
+		APIProtocols:   api.Protocols,
+		APIPath:        api.Path,
+		APIBackendURL:  api.BackendURL,
+	}
 
-				return model
-			}(api)
+	var (
+		wg                    sync.WaitGroup
+		operationErr, backErr error
+	)
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		model.Operation, operationErr = a.getOperations(resourceGroup, serviceName, api.Name, "")
+	}()
+
+	go func() {
+		defer wg.Done()
+		policies, err := a.GetAPIPolicy(resourceGroup, serviceName, api.Name)
+		if err != nil {
+			backErr = err
+			return
+		}
+		model.BackendPolicyID = policies.Inbound.SetBackendService.BackendID
+		model.BackendPolicyURL, backErr = a.GetBackendURLfromID(resourceGroup, serviceName, model.BackendPolicyID)
+	}()
 
-			apiModels = append(apiModels, apiModel)
-		}(api)
+	wg.Wait()
 
+	if operationErr != nil {
+		return model, operationErr
 	}
-	wg.Wait()
-	return nil, apiModels
+	return model, backErr
 }
 
 func (a APIM) GetBackendURLfromID(resourceGroup, serviceName, backendID string) (string, error) {
@@ -341,115 +219,132 @@ func (a APIM) GetBackendURLfromID(resourceGroup, serviceName, backendID string)
 		return "", nil
 	}
 
-	backends, err := a.getBackends(resourceGroup, serviceName, "name="+backendID)
+	index, err := a.BackendIndex(resourceGroup, serviceName)
 	if err != nil {
 		return "", err
 	}
-	URLs := "["
-	for i, backend := range backends {
-		if len(backends) == 1 {
-			return backend.URL, nil
-		}
-		if (i + 1) == len(backends) {
-			URLs += backend.URL + "]"
-		} else {
-			URLs += backend.URL + ","
-		}
-	}
-	return URLs, nil
+	url, _ := index.URL(backendID)
+	return url, nil
 }
 
-// Get Backend ID by URL from APIM
+// Get Backend IDs by URL from APIM, comma separated, backends matching url by a.URLMatch
 func (a APIM) GetBackendIDfromURL(resourceGroup, serviceName, url string) (string, error) {
-	BackendIDs := ""
-	backends, err := a.getBackends(resourceGroup, serviceName, "url="+url)
-
+	index, err := a.BackendIndex(resourceGroup, serviceName)
 	if err != nil {
 		return "", err
 	}
-	for i, backend := range backends {
-		if len(backends) == 1 {
-			return backend.Name, nil
-		}
-		if (i + 1) == len(backends) {
-			BackendIDs += backend.Name
-		} else {
-			BackendIDs += backend.Name + ","
-		}
-	}
-	return BackendIDs, nil
-
+	return strings.Join(index.IDs(url, a.URLMatchMode()), ","), nil
 }
 
-func (a APIM) GetAPIPolicy(resourceGroup, serviceName, apiID string) models.Policies {
+// Get API policy, empty policies if the API has no policy
+func (a APIM) GetAPIPolicy(resourceGroup, serviceName, apiID string) (models.Policies, error) {
 	apiPoliciesHeader := models.Policies{}
 	apiPolicy, err := a.getAPIPolicy(resourceGroup, serviceName, apiID)
 	if err != nil {
-		return models.Policies{}
+		return models.Policies{}, err
+	}
+	if len(apiPolicy) == 0 {
+		return models.Policies{}, nil
 	}
-	xml.Unmarshal([]byte(apiPolicy[0]), &apiPoliciesHeader)
-	return apiPoliciesHeader
+	if err := xml.Unmarshal([]byte(apiPolicy[0]), &apiPoliciesHeader); err != nil {
+		return models.Policies{}, err
+	}
+	return apiPoliciesHeader, nil
 }
 
-// go run main.go apim backend create --resource-group rg-tarathec-poc-az-asse-sbx-001 --service-name apimpocazassesbx003 --backend-id hello --url https://tarathep.com --protocol http
-func (a APIM) CreateOrUpdateBackend(resourceGroup, serviceName, backendID, url, protocol string) {
+// Get policy XML of API, empty if the API has no policy
+func (a APIM) GetAPIPolicyXML(resourceGroup, serviceName, apiID string) (string, error) {
+	policies, err := a.getAPIPolicy(resourceGroup, serviceName, apiID)
+	if err != nil || len(policies) == 0 {
+		return "", err
+	}
+	return policies[0], nil
+}
 
-	color.New(color.Italic, color.FgHiBlue, color.Bold).Print("Create a new backend entity in Api Management.\n\n")
+// Get policy XML of operation, empty if the operation has no policy
+func (a APIM) GetOperationPolicyXML(resourceGroup, serviceName, apiID, operationID string) (string, error) {
+	policies, err := a.getOperationPolicy(resourceGroup, serviceName, apiID, operationID)
+	if err != nil || len(policies) == 0 {
+		return "", err
+	}
+	return policies[0], nil
+}
 
-	fmt.Println("Backend ID \t:", backendID, "\nURL \t\t:", url, "\nProtocol \t:", protocol)
+// Get backend by ID from APIM, ErrNotFound if the backend does not exist
+func (a APIM) GetBackend(resourceGroup, serviceName, backendID string) (Backend, error) {
+	return a.getBackend(resourceGroup, serviceName, backendID)
+}
 
-	color.New(color.FgHiBlack).Print("\nCreating : ")
+// Create backend on APIM, ErrDuplicateURL if the URL is used by other backend
+func (a APIM) CreateOrUpdateBackend(resourceGroup, serviceName, backendID, url, protocol string) (Backend, error) {
+	if err := a.checkBackendURL(resourceGroup, serviceName, url); err != nil {
+		return Backend{}, err
+	}
 
-	//Check existing backend using URL from APIM?
-	beID, err := a.GetBackendIDfromURL(resourceGroup, serviceName, url)
+	result, err := a.createOrUpdateBackend(resourceGroup, serviceName, backendID, url, protocol)
 	if err != nil {
-		color.New(color.FgHiRed).Print("ERROR", err)
-		os.Exit(-1)
-		return
+		return Backend{}, err
 	}
 
-	if beID != "" {
-		//have exiting backend
-		color.New(color.FgHiYellow).Print("This URL is using by backend-id (", beID, ") already exist on APIM\n")
-		os.Exit(-1)
-		return
+	backend := Backend{Name: safePointerString(result.Name)}
+	if result.Properties != nil {
+		backend.URL = safePointerString(result.Properties.URL)
+		if result.Properties.Protocol != nil {
+			backend.Protocol = string(*result.Properties.Protocol)
+		}
 	}
 
-	result, err := a.createOrUpdateBackend(resourceGroup, serviceName, backendID, url, protocol)
-	if err != nil {
-		color.New(color.FgHiRed).Print("ERROR", err)
-		os.Exit(-1)
-		return
+	if backend.Name != backendID || backend.URL != url {
+		return backend, errors.New("unexpected backend " + backend.Name + " (" + backend.URL + ") created")
 	}
+	return backend, nil
+}
 
-	if safePointerString(result.Name) == backendID && safePointerString(result.Properties.URL) == url {
-		color.New(color.FgHiGreen).Print("Done\n")
-		return
+// ErrDuplicateURL if the URL is used by existing backend on APIM, URLs are matched exactly
+func (a APIM) checkBackendURL(resourceGroup, serviceName, url string) error {
+	index, err := a.BackendIndex(resourceGroup, serviceName)
+	if err != nil {
+		return err
+	}
+	if beID := strings.Join(index.IDs(url, URLMatchExact), ","); beID != "" {
+		//have exiting backend
+		return NewError(ErrDuplicateURL, "URL "+url+" is used by backend-id ("+beID+") on APIM", nil)
 	}
-	color.New(color.FgHiRed).Print("ERROR", "Unknow?")
-	os.Exit(-1)
+	return nil
 }
 
-func (apim APIM) ExportBackendsTemplate(resourceGroup, serviceName, pathBackend string) {
-	if pathBackend == "" {
-		pathBackend = "backends.template.json"
-	} else {
-		pathBackend = pathBackend + "/backends.template.json"
+// Export backends of APIM to {pathBackend}/backends.template.json, return path of the file
+func (apim APIM) ExportBackendsTemplate(resourceGroup, serviceName, pathBackend string) (string, error) {
+	pathBackend = BackendsTemplatePath(pathBackend)
+
+	file, err := apim.BackendsTemplate(resourceGroup, serviceName)
+	if err != nil {
+		return pathBackend, err
 	}
+	return pathBackend, os.WriteFile(pathBackend, file, 0644)
+}
 
-	color.New(color.Italic, color.FgHiBlue, color.Bold).Print("Export Backends ARM template {backends.template.json} \n\n")
+// Path of backends.template.json in directory dir, current directory if dir is empty
+func BackendsTemplatePath(dir string) string {
+	if dir == "" {
+		return "backends.template.json"
+	}
+	return dir + "/backends.template.json"
+}
 
+// Content of backends.template.json of backends on APIM
+func (apim APIM) BackendsTemplate(resourceGroup, serviceName string) ([]byte, error) {
 	backends, err := apim.getBackends(resourceGroup, serviceName, "")
 	if err != nil {
-		color.New(color.FgRed).Println("Fail to get APIs", err)
-		return
+		return nil, err
 	}
 
 	var backendTemplate models.BackendTemplate
+	template := apim.Template.WithDefaults()
 
 	for _, backend := range backends {
 		//init arm header
-		backendTemplate.Schema = "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#"
+		backendTemplate.Schema = template.Schema
 		backendTemplate.ContentVersion = "1.0.0.0"
 		backendTemplate.Parameters.ApimServiceName.Type = "string"
 
@@ -495,119 +390,95 @@ func (apim APIM) ExportBackendsTemplate(resourceGroup, serviceName, pathBackend
 				},
 				Name:       "[concat(parameters('ApimServiceName'), '/" + backend.Name + "')]",
 				Type:       "Microsoft.ApiManagement/service/backends",
-				APIVersion: "2021-01-01-preview",
+				APIVersion: template.APIVersion,
 			})
 	}
 
-	// Write to backends.template.json
-	file, err := json.MarshalIndent(backendTemplate, " ", "\t")
-
-	if err != nil {
-		color.New(color.FgHiRed).Println("ERROR", err)
-		os.Exit(-1)
-		return
-	}
-	color.New(color.FgHiBlack).Print("\nExporting : ")
-	if err := os.WriteFile(pathBackend, file, 0644); err != nil {
-		color.New(color.FgHiRed).Println("ERROR", err)
-		os.Exit(-1)
-		return
-	}
-	color.New(color.FgHiGreen).Println("Done\n")
+	return json.MarshalIndent(backendTemplate, " ", "\t")
 }
 
-func (a APIM) ListAPIsDependingOnBackend(resourceGroup, serviceName, backendID, url string) {
-	start := time.Now()
-	color.New(color.Italic, color.FgHiBlue, color.Bold).Print("List API Management API's depending Backend \n\n")
-
-	//LOAD LIST BACKEND ID AND BACKEND URL INTO CACHE MEMMORY
-
-	//FIND BACKEND-URL LIKE COLLECT INTO BACKEND ID NAME INTO CAHCE MEM
-
-	//
-	//a.getAPIsBindingBackend(resourceGroup, serviceName, filter)
-	err, apiModels := a.apis(resourceGroup, serviceName, "")
+// List APIs which backend policy is backendID and/or its URL matches url by a.URLMatch
+func (a APIM) ListAPIsDependingOnBackend(resourceGroup, serviceName, backendID, url string) ([]APIModel, error) {
+	apiModels, err := a.ListAPIModel(resourceGroup, serviceName, "")
 	if err != nil {
-		return
+		return []APIModel{}, err
 	}
+	return DependingOnBackend(apiModels, backendID, url, a.URLMatchMode()), nil
+}
 
-	var (
-		maxApiNameSize, maxDisplayNameSize, maxProtocalSize, maxApiPathSize, maxApiBackendURLSize int
-	)
-
-	if len(apiModels) == 0 {
-		color.New(color.FgHiBlue).Println("Not Found")
-		return
-	}
-	// find max len values for print
+// APIs of apiModels which backend policy is backendID and/or its URL matches url in the mode (URLMatchExact or URLMatchPrefix)
+func DependingOnBackend(apiModels []APIModel, backendID, url, mode string) []APIModel {
+	depends := []APIModel{}
 	for _, api := range apiModels {
-		if len(api.APIName) > maxApiNameSize {
-			maxApiNameSize = len(api.APIName)
-		}
-
-		if len(api.APIDisplayName) > maxDisplayNameSize {
-			maxDisplayNameSize = len(api.APIDisplayName)
+		matchURL := url != "" && api.BackendPolicyURL != "" && MatchURL(url, api.BackendPolicyURL, mode)
+		if backendID != "" && url != "" && api.BackendPolicyID == backendID && matchURL {
+			depends = append(depends, api)
+		} else if backendID != "" && url == "" && api.BackendPolicyID == backendID {
+			depends = append(depends, api)
+		} else if backendID == "" && url != "" && matchURL {
+			depends = append(depends, api)
 		}
+	}
+	return depends
+}
 
-		maxProtocalSizeT := func() int {
-			ps := ""
-			for _, p := range api.APIProtocols {
-				ps += " " + p
-			}
-			return len(ps)
-		}()
+func (a APIM) ListAPIRevisions(resourceGroup, serviceName, apiID string) ([]Revision, error) {
+	return a.getAPIRevisions(resourceGroup, serviceName, apiID)
+}
 
-		if maxProtocalSizeT > maxProtocalSize {
-			maxProtocalSize = maxProtocalSizeT
-		}
+func (a APIM) ListAPIVersionSets(resourceGroup, serviceName string) ([]VersionSet, error) {
+	return a.getAPIVersionSets(resourceGroup, serviceName)
+}
 
-		if len(api.APIPath) > maxApiPathSize {
-			maxApiPathSize = len(api.APIPath)
-		}
+// Next revision number of the API, the latest revision + 1
+func (a APIM) NextAPIRevision(resourceGroup, serviceName, apiID string) (string, error) {
+	revisions, err := a.getAPIRevisions(resourceGroup, serviceName, apiID)
+	if err != nil {
+		return "", err
+	}
 
-		if len(api.APIBackendURL) > maxApiBackendURLSize {
-			maxApiBackendURLSize = len(api.APIBackendURL)
+	next := 1
+	for _, revision := range revisions {
+		if n, err := strconv.Atoi(revision.Revision); err == nil && n >= next {
+			next = n + 1
 		}
 	}
-	if maxApiNameSize < 4 {
-		maxApiNameSize = 4
-	}
-	if maxDisplayNameSize < 11 {
-		maxDisplayNameSize = 11
-	}
-	if maxProtocalSize < 11 {
-		maxProtocalSize = 11
+	return strconv.Itoa(next), nil
+}
+
+// Create a new revision of API of the config
+func (a APIM) CreateAPIRevision(resourceGroup, serviceName, apiID, revision, description string, config RevisionConfig) (Revision, error) {
+	result, err := a.createAPIRevision(resourceGroup, serviceName, apiID, revision, description, config)
+	if err != nil {
+		return Revision{}, err
 	}
-	if maxApiPathSize < 4 {
-		maxApiPathSize = 4
+
+	created := Revision{APIID: safePointerString(result.ID), Description: description}
+	if result.Properties != nil {
+		created.Revision = safePointerString(result.Properties.APIRevision)
 	}
-	if maxApiBackendURLSize < 10 {
-		maxApiBackendURLSize = 10
+	if created.Revision != revision {
+		return created, errors.New("unexpected revision " + created.Revision + " created")
 	}
+	return created, nil
+}
 
-	color.New(color.FgHiMagenta).Printf("%*s  %*s  %*s  %*s  %*s  %*s\n", 3, "No.", maxApiNameSize, "NAME", maxDisplayNameSize, "DisplayName", maxProtocalSize, "Protocol(s)", maxApiPathSize, "Path", maxApiBackendURLSize, "BackendURL")
-	i := 0
-	for _, api := range apiModels {
-
-		var print = func() {
-			color.New(color.FgHiWhite).Printf("%*d  %*s  %*s  %*s  %*s  %*s\n", 3, (i + 1), maxApiNameSize, api.APIName, maxDisplayNameSize, api.APIDisplayName, maxProtocalSize, func() string {
-				ps := ""
-				for _, p := range api.APIProtocols {
-					ps += " " + p
-				}
-				return ps
-			}(), maxApiPathSize, api.APIPath, maxApiBackendURLSize, api.APIBackendURL)
-		}
+// Make a revision current by creating a release with release note
+func (a APIM) ReleaseAPIRevision(resourceGroup, serviceName, apiID, revision, notes string) error {
+	_, err := a.createAPIRelease(resourceGroup, serviceName, apiID, revision, notes)
+	return err
+}
 
-		if backendID != "" && url != "" && api.BackendPolicyID == backendID && api.BackendPolicyURL == url {
-			print()
-		} else if backendID != "" && url == "" && api.BackendPolicyID == backendID {
-			print()
-		} else if backendID == "" && url != "" && api.BackendPolicyURL == url {
-			print()
-		}
+// Get names (API IDs) of all APIs on APIM
+func (a APIM) APINames(resourceGroup, serviceName string) ([]string, error) {
+	apis, err := a.getAPIs(resourceGroup, serviceName, "")
+	if err != nil {
+		return []string{}, err
 	}
 
-	fmt.Println("\nTime used is ", time.Since(start))
-
+	names := []string{}
+	for _, api := range apis {
+		names = append(names, api.Name)
+	}
+	return names, nil
 }
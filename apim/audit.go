@@ -0,0 +1,109 @@
+package apim
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	FindingOrphan    = "orphan"
+	FindingDuplicate = "duplicate-url"
+	FindingMismatch  = "serviceurl-mismatch"
+	FindingMissing   = "missing-backend"
+
+	SourceAPIM     = "APIM"
+	SourceTemplate = "backends.template.json"
+)
+
+type Finding struct {
+	Source    string
+	Kind      string
+	BackendID string
+	API       string
+	URL       string
+	Detail    string
+}
+
+// Audit backends of a source (APIM or backends.template.json) against the API policies on APIM, serviceUrl of an API
+// matches the URL of its backend in the mode, URLMatchExact or URLMatchPrefix
+func auditBackends(source string, backends []Backend, apiModels []APIModel, mode string) []Finding {
+	findings := []Finding{}
+
+	byID := map[string]Backend{}
+	byURL := map[string][]string{}
+	for _, backend := range backends {
+		byID[backend.Name] = backend
+		byURL[NormalizeURL(backend.URL)] = append(byURL[NormalizeURL(backend.URL)], backend.Name)
+	}
+
+	referenced := map[string]bool{}
+	for _, api := range apiModels {
+		if api.BackendPolicyID == "" {
+			continue
+		}
+		referenced[api.BackendPolicyID] = true
+
+		backend, ok := byID[api.BackendPolicyID]
+		if !ok {
+			findings = append(findings, Finding{Source: source, Kind: FindingMissing, BackendID: api.BackendPolicyID, API: api.APIName,
+				Detail: "API " + api.APIName + " references backend-id " + api.BackendPolicyID + " which does not exist"})
+			continue
+		}
+		if api.APIBackendURL != "" && !MatchURL(backend.URL, api.APIBackendURL, mode) {
+			findings = append(findings, Finding{Source: source, Kind: FindingMismatch, BackendID: backend.Name, API: api.APIName, URL: api.APIBackendURL,
+				Detail: "API " + api.APIName + " serviceUrl " + api.APIBackendURL + " but backend-id " + backend.Name + " is " + backend.URL})
+		}
+	}
+
+	for _, backend := range backends {
+		if !referenced[backend.Name] {
+			findings = append(findings, Finding{Source: source, Kind: FindingOrphan, BackendID: backend.Name, URL: backend.URL,
+				Detail: "backend-id " + backend.Name + " (" + backend.URL + ") is not referenced by any API policy"})
+		}
+	}
+
+	urls := []string{}
+	for url := range byURL {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		if ids := byURL[url]; len(ids) > 1 {
+			sort.Strings(ids)
+			findings = append(findings, Finding{Source: source, Kind: FindingDuplicate, BackendID: strings.Join(ids, ","), URL: url,
+				Detail: "URL " + url + " is used by backend-id " + strings.Join(ids, ", ")})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Kind < findings[j].Kind })
+	return findings
+}
+
+// Findings of an audit and the sources (APIM, backends.template.json) which were audited
+type AuditReport struct {
+	Sources  []string
+	Findings []Finding
+}
+
+// Report orphan backends, duplicate URLs, serviceUrl mismatches and missing backends on APIM
+// and on backends.template.json when templateBackends is not nil
+func (a APIM) AuditBackends(resourceGroup, serviceName string, templateBackends []Backend) (AuditReport, error) {
+	index, err := a.BackendIndex(resourceGroup, serviceName)
+	if err != nil {
+		return AuditReport{}, err
+	}
+	a.Backends = index
+
+	apiModels, err := a.ListAPIModel(resourceGroup, serviceName, "")
+	if err != nil {
+		return AuditReport{}, err
+	}
+
+	report := AuditReport{Sources: []string{SourceAPIM}}
+	report.Findings = auditBackends(SourceAPIM, index.Backends, apiModels, a.URLMatchMode())
+	if templateBackends != nil {
+		report.Sources = append(report.Sources, SourceTemplate)
+		report.Findings = append(report.Findings, auditBackends(SourceTemplate, templateBackends, apiModels, a.URLMatchMode())...)
+	}
+	return report, nil
+}
@@ -0,0 +1,192 @@
+package apim
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Backends of a service loaded once per command, serves ID->URL and URL->IDs lookups without requests to ARM
+type BackendIndex struct {
+	SubscriptionID string    `json:"subscriptionId"`
+	ResourceGroup  string    `json:"resourceGroup"`
+	ServiceName    string    `json:"serviceName"`
+	LoadedAt       time.Time `json:"loadedAt"`
+	Backends       []Backend `json:"backends"`
+
+	byID map[string]Backend
+	// guards Backends and byID, backends may be added while parse workers look up
+	mu sync.RWMutex
+}
+
+func NewBackendIndex(subscriptionID, resourceGroup, serviceName string, backends []Backend) *BackendIndex {
+	index := &BackendIndex{
+		SubscriptionID: subscriptionID,
+		ResourceGroup:  resourceGroup,
+		ServiceName:    serviceName,
+		LoadedAt:       time.Now(),
+		Backends:       backends,
+	}
+	index.build()
+	return index
+}
+
+func (index *BackendIndex) build() {
+	index.byID = make(map[string]Backend, len(index.Backends))
+	for _, backend := range index.Backends {
+		index.byID[backend.Name] = backend
+	}
+}
+
+func (index *BackendIndex) of(subscriptionID, resourceGroup, serviceName string) bool {
+	return index != nil &&
+		index.SubscriptionID == subscriptionID &&
+		strings.EqualFold(index.ResourceGroup, resourceGroup) &&
+		strings.EqualFold(index.ServiceName, serviceName)
+}
+
+// Get backend URL by backend ID
+func (index *BackendIndex) URL(backendID string) (string, bool) {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	backend, ok := index.byID[backendID]
+	return backend.URL, ok
+}
+
+// Get backend by backend ID
+func (index *BackendIndex) Backend(backendID string) (Backend, bool) {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	backend, ok := index.byID[backendID]
+	return backend, ok
+}
+
+// Get backend IDs which URL matches url in the mode, URLMatchExact or URLMatchPrefix. In prefix mode only the backends
+// of the longest path matching url
+func (index *BackendIndex) IDs(url, mode string) []string {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	urls := make([]string, len(index.Backends))
+	for i, backend := range index.Backends {
+		urls[i] = backend.URL
+	}
+	ids := []string{}
+	for _, i := range MostSpecificMatches(urls, url, mode) {
+		ids = append(ids, index.Backends[i].Name)
+	}
+	return ids
+}
+
+// Add backend created on APIM to the index, and to the cache file when a.Cache is set
+func (a APIM) AddToBackendIndex(index *BackendIndex, backend Backend) {
+	if index == nil {
+		return
+	}
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	index.Backends = append(index.Backends, backend)
+	index.build()
+
+	cachePath := backendCachePath(index.SubscriptionID, index.ResourceGroup, index.ServiceName)
+	if a.Cache > 0 && cachePath != "" {
+		if err := writeBackendCache(cachePath, index); err != nil {
+			log.Warn().Err(err).Msg("cannot write backends cache " + cachePath)
+		}
+	}
+}
+
+// Get backends which name contains filter
+func (index *BackendIndex) Filter(filter string) []Backend {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	backends := []Backend{}
+	for _, backend := range index.Backends {
+		if strings.Contains(strings.ToLower(backend.Name), strings.ToLower(filter)) {
+			backends = append(backends, backend)
+		}
+	}
+	return backends
+}
+
+// Load backend index of the service, reuse a.Backends when it is the same service
+// or the local cache file when a.Cache (TTL) is set and the file is not expired
+func (a APIM) BackendIndex(resourceGroup, serviceName string) (*BackendIndex, error) {
+	if a.Backends.of(a.SubscriptionID, resourceGroup, serviceName) {
+		return a.Backends, nil
+	}
+
+	cachePath := backendCachePath(a.SubscriptionID, resourceGroup, serviceName)
+
+	if a.Cache > 0 && cachePath != "" {
+		if index, err := readBackendCache(cachePath); err == nil && time.Since(index.LoadedAt) < a.Cache {
+			log.Debug().Str("func", "BackendIndex").Msg("load backends from cache " + cachePath)
+			return index, nil
+		}
+	}
+
+	backends, err := a.getBackends(resourceGroup, serviceName, "")
+	if err != nil {
+		return nil, err
+	}
+	index := NewBackendIndex(a.SubscriptionID, resourceGroup, serviceName, backends)
+
+	if a.Cache > 0 && cachePath != "" {
+		if err := writeBackendCache(cachePath, index); err != nil {
+			log.Warn().Err(err).Msg("cannot write backends cache " + cachePath)
+		}
+	}
+	return index, nil
+}
+
+// Remove the cache file of backends of the service when a backend is written on APIM, whether or not a.Cache is set, so the
+// next command with --cache loads the backends from APIM instead of a stale file
+func (a APIM) invalidateBackendCache(resourceGroup, serviceName string) {
+	cachePath := backendCachePath(a.SubscriptionID, resourceGroup, serviceName)
+	if cachePath == "" {
+		return
+	}
+	if err := os.Remove(cachePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warn().Err(err).Msg("cannot remove backends cache " + cachePath)
+	}
+}
+
+// {user cache dir}/apimtool/backends-{subscription}-{resource group}-{service}.json
+func backendCachePath(subscriptionID, resourceGroup, serviceName string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "apimtool", strings.ToLower("backends-"+subscriptionID+"-"+resourceGroup+"-"+serviceName+".json"))
+}
+
+func readBackendCache(path string) (*BackendIndex, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &BackendIndex{}
+	if err := json.Unmarshal(file, index); err != nil {
+		return nil, err
+	}
+	index.build()
+	return index, nil
+}
+
+func writeBackendCache(path string, index *BackendIndex) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := json.MarshalIndent(index, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, file, 0644)
+}
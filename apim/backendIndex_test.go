@@ -0,0 +1,45 @@
+package apim
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBackendCache(t *testing.T) {
+	// user cache dir of Linux and macOS
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+	t.Setenv("HOME", dir)
+	a := APIM{SubscriptionID: "sub", Cache: time.Hour, Context: context.Background()}
+	cachePath := backendCachePath("sub", "rg", "svc")
+
+	index := NewBackendIndex("sub", "rg", "svc", []Backend{{Name: "be1", URL: "https://a.com", Protocol: "http"}})
+	if err := writeBackendCache(cachePath, index); err != nil {
+		t.Fatal(err)
+	}
+	cached, err := a.BackendIndex("RG", "svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url, ok := cached.URL("be1"); !ok || url != "https://a.com" {
+		t.Errorf("URL of be1 of cache = %q, %v", url, ok)
+	}
+
+	a.AddToBackendIndex(cached, Backend{Name: "be2", URL: "https://b.com", Protocol: "http"})
+	reloaded, err := readBackendCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := reloaded.IDs("https://b.com", URLMatchExact); len(ids) != 1 || ids[0] != "be2" {
+		t.Errorf("IDs of https://b.com of cache = %v, want [be2]", ids)
+	}
+
+	a.invalidateBackendCache("rg", "svc")
+	if _, err := os.Stat(cachePath); !os.IsNotExist(err) {
+		t.Errorf("cache file after invalidate: %v", err)
+	}
+	// no cache file is not an error
+	a.invalidateBackendCache("rg", "svc")
+}
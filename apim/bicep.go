@@ -0,0 +1,268 @@
+package apim
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Declaration of the existing service, the parent of the resources of generated Bicep modules
+func (o TemplateOptions) bicepHeader() string {
+	return "param ApimServiceName string\n\n" +
+		"resource service 'Microsoft.ApiManagement/service@" + o.WithDefaults().APIVersion + "' existing = {\n" +
+		"  name: ApimServiceName\n" +
+		"}\n"
+}
+
+var (
+	bicepIdentifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	bicepSymbolPattern     = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+	bicepPropertyPattern   = regexp.MustCompile(`^\s*(\w+): '((?:[^'\\]|\\.)*)'\s*$`)
+	// declarations of symbolic names, names of a module are unique
+	bicepSymbolDeclarationPattern = regexp.MustCompile(`(?m)^\s*(?:resource|param|var|module) (\w+)`)
+)
+
+// Path of backends.bicep in directory dir, current directory if dir is empty
+func BackendsBicepPath(dir string) string {
+	if dir == "" {
+		return "backends.bicep"
+	}
+	return filepath.Join(dir, "backends.bicep")
+}
+
+// Content of backends.bicep of backends on APIM
+func (a APIM) BackendsBicep(resourceGroup, serviceName string) ([]byte, error) {
+	backends, err := a.getBackends(resourceGroup, serviceName, "")
+	if err != nil {
+		return nil, err
+	}
+
+	content := a.Template.bicepHeader()
+	for _, backend := range backends {
+		content = a.Template.AppendBackendBicep(content, backend)
+	}
+	return []byte(content), nil
+}
+
+// Append resource of backend to Bicep module content, same properties as the resource of backends.template.json
+func (o TemplateOptions) AppendBackendBicep(content string, backend Backend) string {
+	symbols := map[string]bool{}
+	for _, m := range bicepSymbolDeclarationPattern.FindAllStringSubmatch(content, -1) {
+		symbols[m[1]] = true
+	}
+	symbol := "backend_" + bicepSymbol(backend.Name)
+	for i := 2; symbols[symbol]; i++ {
+		symbol = "backend_" + bicepSymbol(backend.Name) + "_" + strconv.Itoa(i)
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(content, "\n") + "\n\n")
+	writeBicepResource(&b, "", symbol, "Microsoft.ApiManagement/service/backends@"+o.WithDefaults().APIVersion,
+		"service", backend.Name, map[string]interface{}{
+			"credentials": map[string]interface{}{"query": map[string]interface{}{}, "header": map[string]interface{}{}},
+			"tls":         map[string]interface{}{"validateCertificateChain": false, "validateCertificateName": false},
+			"url":         backend.URL,
+			"protocol":    backend.Protocol,
+		}, nil)
+	return b.String()
+}
+
+// Backends declared in Bicep module content, as written by AppendBackendBicep
+func BicepBackends(content string) []Backend {
+	backends := []Backend{}
+	for _, block := range bicepResourceBlocks(content) {
+		if backend, ok := bicepBackend(block); ok {
+			backends = append(backends, backend)
+		}
+	}
+	return backends
+}
+
+// Backend of resource declaration, false if the resource is not a backend
+func bicepBackend(block string) (Backend, bool) {
+	backend := Backend{}
+	if !strings.Contains(block, "'Microsoft.ApiManagement/service/backends@") {
+		return backend, false
+	}
+	for _, line := range strings.Split(block, "\n") {
+		m := bicepPropertyPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		value := bicepUnquote(m[2])
+		switch {
+		case m[1] == "name" && backend.Name == "":
+			backend.Name = value
+		case m[1] == "url":
+			backend.URL = value
+		case m[1] == "protocol":
+			backend.Protocol = value
+		}
+	}
+	return backend, true
+}
+
+// Remove resource of backend from Bicep module content, false if the backend is not declared
+func RemoveBackendBicep(content, backendID string) (string, bool) {
+	for _, block := range bicepResourceBlocks(content) {
+		if backend, ok := bicepBackend(block); ok && backend.Name == backendID {
+			content = strings.Replace(content, block+"\n", "", 1)
+			for strings.Contains(content, "\n\n\n") {
+				content = strings.ReplaceAll(content, "\n\n\n", "\n\n")
+			}
+			return strings.TrimRight(content, "\n") + "\n", true
+		}
+	}
+	return content, false
+}
+
+// Top level resource declarations of Bicep module content, from "resource" to the closing brace at column 0
+func bicepResourceBlocks(content string) []string {
+	blocks := []string{}
+	var block []string
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, "resource ") {
+			block = []string{}
+		}
+		if block == nil {
+			continue
+		}
+		block = append(block, line)
+		if strings.TrimRight(line, " \t\r") == "}" {
+			blocks = append(blocks, strings.Join(block, "\n"))
+			block = nil
+		}
+	}
+	return blocks
+}
+
+// Bicep module of API with its policy, operations and operation policies as nested child resources
+func (o TemplateOptions) APIBicep(api SnapshotAPI) []byte {
+	apiID := safePointerString(api.API.Name)
+
+	var b strings.Builder
+	b.WriteString(o.bicepHeader() + "\n")
+	writeBicepResource(&b, "", "api", "Microsoft.ApiManagement/service/apis@"+o.WithDefaults().APIVersion, "service", apiID,
+		o.supported("apis", templateProperties(api.API.Properties, apiTemplateProperties)), func(b *strings.Builder, indent string) {
+			if api.Policy != "" {
+				b.WriteString("\n")
+				writeBicepResource(b, indent, "policy", "policies", "", "policy", policyTemplateProperties(api.Policy), nil)
+			}
+			symbols := map[string]bool{"policy": true}
+			for _, operation := range api.Operations {
+				operationID := safePointerString(operation.Operation.Name)
+				symbol := "operation_" + bicepSymbol(operationID)
+				for i := 2; symbols[symbol]; i++ {
+					symbol = "operation_" + bicepSymbol(operationID) + "_" + strconv.Itoa(i)
+				}
+				symbols[symbol] = true
+
+				b.WriteString("\n")
+				writeBicepResource(b, indent, symbol, "operations", "", operationID,
+					o.supported("apis/operations", templateProperties(operation.Operation.Properties, operationTemplateProperties)), func(b *strings.Builder, indent string) {
+						if operation.Policy != "" {
+							b.WriteString("\n")
+							writeBicepResource(b, indent, "policy", "policies", "", "policy", policyTemplateProperties(operation.Policy), nil)
+						}
+					})
+			}
+		})
+	return []byte(b.String())
+}
+
+// Write resource declaration, parent is omitted for nested resources. children writes nested resources at their indent
+func writeBicepResource(b *strings.Builder, indent, symbol, resourceType, parent, name string, properties map[string]interface{}, children func(b *strings.Builder, indent string)) {
+	inner := indent + "  "
+	fmt.Fprintf(b, "%sresource %s '%s' = {\n", indent, symbol, resourceType)
+	if parent != "" {
+		fmt.Fprintf(b, "%sparent: %s\n", inner, parent)
+	}
+	fmt.Fprintf(b, "%sname: %s\n", inner, bicepString(name))
+	fmt.Fprintf(b, "%sproperties: ", inner)
+	writeBicepValue(b, properties, inner)
+	b.WriteString("\n")
+	if children != nil {
+		children(b, inner)
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+// Write value of JSON types as Bicep, object keys are sorted
+func writeBicepValue(b *strings.Builder, value interface{}, indent string) {
+	inner := indent + "  "
+	switch v := value.(type) {
+	case nil:
+		b.WriteString("null")
+	case string:
+		b.WriteString(bicepString(v))
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case float64:
+		b.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case int:
+		b.WriteString(strconv.Itoa(v))
+	case []string:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = item
+		}
+		writeBicepValue(b, items, indent)
+	case []interface{}:
+		if len(v) == 0 {
+			b.WriteString("[]")
+			return
+		}
+		b.WriteString("[\n")
+		for _, item := range v {
+			b.WriteString(inner)
+			writeBicepValue(b, item, inner)
+			b.WriteString("\n")
+		}
+		b.WriteString(indent + "]")
+	case map[string]interface{}:
+		if len(v) == 0 {
+			b.WriteString("{}")
+			return
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b.WriteString("{\n")
+		for _, key := range keys {
+			label := key
+			if !bicepIdentifierPattern.MatchString(key) {
+				label = bicepString(key)
+			}
+			b.WriteString(inner + label + ": ")
+			writeBicepValue(b, v[key], inner)
+			b.WriteString("\n")
+		}
+		b.WriteString(indent + "}")
+	default:
+		b.WriteString(bicepString(fmt.Sprint(v)))
+	}
+}
+
+// Bicep string literal, multi-line strings are used for values with line breaks e.g. policy XML
+func bicepString(s string) string {
+	if strings.Contains(s, "\n") && !strings.Contains(s, "'''") {
+		return "'''\n" + s + "'''"
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "${", `\${`)
+	return "'" + replacer.Replace(s) + "'"
+}
+
+func bicepUnquote(s string) string {
+	replacer := strings.NewReplacer(`\\`, `\`, `\'`, `'`, `\n`, "\n", `\r`, "\r", `\t`, "\t", `\${`, "${")
+	return replacer.Replace(s)
+}
+
+// Symbolic name of resource of ID, characters other than letters, digits and underscore are replaced
+func bicepSymbol(id string) string {
+	return strings.Trim(bicepSymbolPattern.ReplaceAllString(id, "_"), "_")
+}
@@ -0,0 +1,137 @@
+package apim
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/apimanagement/armapimanagement"
+)
+
+func TestBicepString(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"abc", `'abc'`},
+		{"it's", `'it\'s'`},
+		{"${param}", `'\${param}'`},
+		{"$ {a} $x", `'$ {a} $x'`},
+		{`C:\path\n`, `'C:\\path\\n'`},
+		{"a\tb\rc", `'a\tb\rc'`},
+		{"<a>\n  it's ${x}\n</a>", "'''\n<a>\n  it's ${x}\n</a>'''"},
+		{"'''\nb", `'\'\'\'\nb'`},
+	}
+	for _, tt := range tests {
+		got := bicepString(tt.s)
+		if got != tt.want {
+			t.Errorf("bicepString(%q) = %s, want %s", tt.s, got, tt.want)
+		}
+		if strings.HasPrefix(got, "'''") {
+			continue
+		}
+		if unquoted := bicepUnquote(strings.TrimSuffix(strings.TrimPrefix(got, "'"), "'")); unquoted != tt.s {
+			t.Errorf("bicepUnquote(bicepString(%q)) = %q", tt.s, unquoted)
+		}
+	}
+}
+
+func TestBicepSymbol(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"be1", "be1"},
+		{"my-backend.v2", "my_backend_v2"},
+		{"-a--b-", "a_b"},
+		{"a_b", "a_b"},
+	}
+	for _, tt := range tests {
+		if got := bicepSymbol(tt.id); got != tt.want {
+			t.Errorf("bicepSymbol(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestBackendBicepRoundTrip(t *testing.T) {
+	o := TemplateOptions{}
+	backends := []Backend{
+		{Name: "a-b", URL: "https://a.com", Protocol: "http"},
+		{Name: "a_b", URL: "https://b.com/it's/${x}", Protocol: "soap"},
+		{Name: "a.b", URL: `https://c.com/\path`, Protocol: "http"},
+	}
+	content := o.bicepHeader()
+	for _, backend := range backends {
+		content = o.AppendBackendBicep(content, backend)
+	}
+
+	if got := BicepBackends(content); !reflect.DeepEqual(got, backends) {
+		t.Errorf("BicepBackends = %+v, want %+v", got, backends)
+	}
+	symbols := []string{}
+	for _, m := range regexp.MustCompile(`(?m)^resource (\w+) `).FindAllStringSubmatch(content, -1) {
+		symbols = append(symbols, m[1])
+	}
+	if want := []string{"service", "backend_a_b", "backend_a_b_2", "backend_a_b_3"}; !reflect.DeepEqual(symbols, want) {
+		t.Errorf("symbols = %v, want %v", symbols, want)
+	}
+
+	removed, ok := RemoveBackendBicep(content, "a_b")
+	if !ok {
+		t.Fatal("RemoveBackendBicep(a_b) = false")
+	}
+	if got := BicepBackends(removed); !reflect.DeepEqual(got, []Backend{backends[0], backends[2]}) {
+		t.Errorf("BicepBackends after removing a_b = %+v", got)
+	}
+	if strings.Contains(removed, "\n\n\n") || !strings.HasPrefix(removed, o.bicepHeader()) {
+		t.Errorf("content after removing a_b:\n%s", removed)
+	}
+	if _, ok := RemoveBackendBicep(removed, "a_b"); ok {
+		t.Error("RemoveBackendBicep of removed backend = true")
+	}
+
+	// the symbol of the removed backend is free again
+	if appended := o.AppendBackendBicep(removed, backends[1]); !strings.Contains(appended, "resource backend_a_b_2 ") {
+		t.Errorf("symbol of appended backend is not backend_a_b_2:\n%s", appended)
+	}
+}
+
+func TestAPIBicep(t *testing.T) {
+	policy := "<policies>\n  <inbound>\n    <set-header name=\"x\"><value>it's @(\"${x}\")</value></set-header>\n  </inbound>\n</policies>"
+	api := SnapshotAPI{
+		API: &armapimanagement.APIContract{Name: to.Ptr("orders"), Properties: &armapimanagement.APIContractProperties{
+			DisplayName: to.Ptr("Orders' API"), Path: to.Ptr("orders")}},
+		Policy: policy,
+		Operations: []SnapshotOperation{
+			{Operation: &armapimanagement.OperationContract{Name: to.Ptr("get-order"),
+				Properties: &armapimanagement.OperationContractProperties{DisplayName: to.Ptr("get"), Method: to.Ptr("GET"), URLTemplate: to.Ptr("/{id}")}}, Policy: policy},
+			{Operation: &armapimanagement.OperationContract{Name: to.Ptr("get_order"),
+				Properties: &armapimanagement.OperationContractProperties{DisplayName: to.Ptr("get"), Method: to.Ptr("GET"), URLTemplate: to.Ptr("/")}}},
+			{Operation: &armapimanagement.OperationContract{Name: to.Ptr("policy"),
+				Properties: &armapimanagement.OperationContractProperties{DisplayName: to.Ptr("policy"), Method: to.Ptr("GET"), URLTemplate: to.Ptr("/policy")}}},
+		},
+	}
+	content := string(TemplateOptions{}.APIBicep(api))
+
+	for _, want := range []string{
+		"resource api 'Microsoft.ApiManagement/service/apis@",
+		"  parent: service\n  name: 'orders'\n",
+		"displayName: 'Orders\\' API'",
+		"resource operation_get_order 'operations' = {\n    name: 'get-order'",
+		"resource operation_get_order_2 'operations' = {\n    name: 'get_order'",
+		"resource operation_policy 'operations' = {\n    name: 'policy'",
+		"'''\n" + policy + "'''",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("APIBicep has no %q:\n%s", want, content)
+		}
+	}
+	if got := strings.Count(content, "'''\n"+policy+"'''"); got != 2 {
+		t.Errorf("policy is written %d times, want 2 (API and get-order)", got)
+	}
+	if strings.Count(content, "{") != strings.Count(content, "}") {
+		t.Errorf("unbalanced braces:\n%s", content)
+	}
+}
@@ -0,0 +1,262 @@
+package apim
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Comparable state of a service, from APIM, a snapshot or templates
+type State struct {
+	Source   string
+	Backends map[string]BackendState
+	APIs     map[string]APIState
+}
+
+type BackendState struct {
+	URL                      string
+	Protocol                 string
+	ValidateCertificateChain bool
+	ValidateCertificateName  bool
+}
+
+type APIState struct {
+	Path       string
+	Protocols  []string
+	ServiceURL string
+	Policy     string
+	Operations map[string]OperationState
+}
+
+type OperationState struct {
+	Method      string
+	URLTemplate string
+	Policy      string
+}
+
+func NewState(source string) State {
+	return State{Source: source, Backends: map[string]BackendState{}, APIs: map[string]APIState{}}
+}
+
+// State of the service on APIM
+func (a APIM) State(resourceGroup, serviceName string) (State, error) {
+	snapshot, err := a.CreateSnapshot(resourceGroup, serviceName, false)
+	if err != nil {
+		return State{}, err
+	}
+	state := SnapshotState(snapshot)
+	state.Source = resourceGroup + "/" + serviceName
+	return state, nil
+}
+
+// State of a snapshot, revisions which are not current are skipped
+func SnapshotState(snapshot Snapshot) State {
+	state := NewState(snapshot.ResourceGroup + "/" + snapshot.ServiceName + "@" + snapshot.CreatedAt.Format("2006-01-02T15:04:05Z"))
+
+	for _, backend := range snapshot.Backends {
+		b := BackendState{}
+		if p := backend.Properties; p != nil {
+			b.URL = safePointerString(p.URL)
+			if p.Protocol != nil {
+				b.Protocol = string(*p.Protocol)
+			}
+			if p.TLS != nil {
+				b.ValidateCertificateChain = p.TLS.ValidateCertificateChain != nil && *p.TLS.ValidateCertificateChain
+				b.ValidateCertificateName = p.TLS.ValidateCertificateName != nil && *p.TLS.ValidateCertificateName
+			}
+		}
+		state.Backends[safePointerString(backend.Name)] = b
+	}
+
+	for _, api := range snapshot.APIs {
+		s := APIState{Protocols: []string{}, Policy: api.Policy, Operations: map[string]OperationState{}}
+		if p := api.API.Properties; p != nil {
+			if p.IsCurrent != nil && !*p.IsCurrent {
+				continue
+			}
+			s.Path = safePointerString(p.Path)
+			s.ServiceURL = safePointerString(p.ServiceURL)
+			for _, protocol := range p.Protocols {
+				if protocol != nil {
+					s.Protocols = append(s.Protocols, string(*protocol))
+				}
+			}
+		}
+		for _, operation := range api.Operations {
+			o := OperationState{Policy: operation.Policy}
+			if p := operation.Operation.Properties; p != nil {
+				o.Method = safePointerString(p.Method)
+				o.URLTemplate = safePointerString(p.URLTemplate)
+			}
+			s.Operations[safePointerString(operation.Operation.Name)] = o
+		}
+		state.APIs[safePointerString(api.API.Name)] = s
+	}
+	return state
+}
+
+// Kinds of difference
+const (
+	DifferenceOnlyInA = "only-in-a"
+	DifferenceOnlyInB = "only-in-b"
+	DifferenceChanged = "changed"
+)
+
+// Difference of an entity between two states, entity is backend/{id}, api/{id} or api/{id}/operation/{id}
+type Difference struct {
+	Kind   string `json:"kind"`
+	Entity string `json:"entity"`
+	Field  string `json:"field,omitempty"`
+	A      string `json:"a,omitempty"`
+	B      string `json:"b,omitempty"`
+}
+
+type CompareOptions struct {
+	// Ignore backend URLs and serviceUrl of APIs, e.g. to compare environments
+	IgnoreURLs bool
+}
+
+// Semantic differences from state a to state b, URLs are compared normalized and policies XML-normalized
+func Compare(a, b State, options CompareOptions) []Difference {
+	differences := []Difference{}
+	changed := func(entity, field, valueA, valueB string) {
+		if valueA != valueB {
+			differences = append(differences, Difference{Kind: DifferenceChanged, Entity: entity, Field: field, A: valueA, B: valueB})
+		}
+	}
+	url := func(entity, field, valueA, valueB string) {
+		if !options.IgnoreURLs && NormalizeURL(valueA) != NormalizeURL(valueB) {
+			differences = append(differences, Difference{Kind: DifferenceChanged, Entity: entity, Field: field, A: valueA, B: valueB})
+		}
+	}
+	policy := func(entity, valueA, valueB string) {
+		if NormalizePolicy(valueA) != NormalizePolicy(valueB) {
+			differences = append(differences, Difference{Kind: DifferenceChanged, Entity: entity, Field: "policy", A: valueA, B: valueB})
+		}
+	}
+
+	for _, id := range unionKeys(a.Backends, b.Backends) {
+		entity := EntityBackend + "/" + id
+		backendA, inA := a.Backends[id]
+		backendB, inB := b.Backends[id]
+		if kind := presence(inA, inB); kind != "" {
+			differences = append(differences, Difference{Kind: kind, Entity: entity})
+			continue
+		}
+		url(entity, "url", backendA.URL, backendB.URL)
+		changed(entity, "protocol", strings.ToLower(backendA.Protocol), strings.ToLower(backendB.Protocol))
+		changed(entity, "tls.validateCertificateChain", fmt.Sprint(backendA.ValidateCertificateChain), fmt.Sprint(backendB.ValidateCertificateChain))
+		changed(entity, "tls.validateCertificateName", fmt.Sprint(backendA.ValidateCertificateName), fmt.Sprint(backendB.ValidateCertificateName))
+	}
+
+	for _, id := range unionKeys(a.APIs, b.APIs) {
+		entity := EntityAPI + "/" + id
+		apiA, inA := a.APIs[id]
+		apiB, inB := b.APIs[id]
+		if kind := presence(inA, inB); kind != "" {
+			differences = append(differences, Difference{Kind: kind, Entity: entity})
+			continue
+		}
+		changed(entity, "path", strings.Trim(apiA.Path, "/"), strings.Trim(apiB.Path, "/"))
+		changed(entity, "protocols", sortedLower(apiA.Protocols), sortedLower(apiB.Protocols))
+		url(entity, "serviceUrl", apiA.ServiceURL, apiB.ServiceURL)
+		policy(entity, apiA.Policy, apiB.Policy)
+
+		for _, operationID := range unionKeys(apiA.Operations, apiB.Operations) {
+			operationEntity := entity + "/operation/" + operationID
+			operationA, inA := apiA.Operations[operationID]
+			operationB, inB := apiB.Operations[operationID]
+			if kind := presence(inA, inB); kind != "" {
+				differences = append(differences, Difference{Kind: kind, Entity: operationEntity})
+				continue
+			}
+			changed(operationEntity, "method", strings.ToUpper(operationA.Method), strings.ToUpper(operationB.Method))
+			changed(operationEntity, "urlTemplate", operationA.URLTemplate, operationB.URLTemplate)
+			policy(operationEntity, operationA.Policy, operationB.Policy)
+		}
+	}
+	return differences
+}
+
+func presence(inA, inB bool) string {
+	switch {
+	case !inB:
+		return DifferenceOnlyInA
+	case !inA:
+		return DifferenceOnlyInB
+	}
+	return ""
+}
+
+func unionKeys[V any](a, b map[string]V) []string {
+	keys := []string{}
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedLower(values []string) string {
+	lower := []string{}
+	for _, value := range values {
+		lower = append(lower, strings.ToLower(value))
+	}
+	sort.Strings(lower)
+	return strings.Join(lower, ",")
+}
+
+// Normalize policy XML for comparing, comments and whitespace between elements are removed,
+// attributes are sorted and elements are indented. Policy which is not well-formed XML
+// (e.g. rawxml expressions) is compared with whitespace collapsed
+func NormalizePolicy(policy string) string {
+	policy = strings.TrimSpace(policy)
+	if policy == "" {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	decoder := xml.NewDecoder(strings.NewReader(policy))
+	decoder.Strict = false
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return strings.Join(strings.Fields(policy), " ")
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			sort.Slice(t.Attr, func(i, j int) bool {
+				return t.Attr[i].Name.Space+":"+t.Attr[i].Name.Local < t.Attr[j].Name.Space+":"+t.Attr[j].Name.Local
+			})
+			token = t
+		case xml.CharData:
+			text := strings.TrimSpace(string(t))
+			if text == "" {
+				continue
+			}
+			token = xml.CharData(text)
+		case xml.Comment, xml.ProcInst, xml.Directive:
+			continue
+		}
+		if err := encoder.EncodeToken(token); err != nil {
+			return strings.Join(strings.Fields(policy), " ")
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return strings.Join(strings.Fields(policy), " ")
+	}
+	return buf.String()
+}
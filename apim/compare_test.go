@@ -0,0 +1,106 @@
+package apim
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizePolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"whitespace between elements", "<policies><inbound><base /></inbound></policies>",
+			"<policies>\n  <inbound>\n    <base/>\n  </inbound>\n</policies>\n", true},
+		{"attribute order", `<set-header name="x" exists-action="override" />`,
+			`<set-header exists-action="override" name="x"></set-header>`, true},
+		{"comments", "<inbound><!-- route --><base /></inbound>", "<inbound><base /></inbound>", true},
+		{"text trimmed", "<value> a </value>", "<value>a</value>", true},
+		{"expression quotes", `<value>@(context.Request.Headers.GetValueOrDefault("a", ""))</value>`,
+			`<value>@(context.Request.Headers.GetValueOrDefault(&quot;a&quot;, &quot;&quot;))</value>`, true},
+		{"empty", "", " \n ", true},
+		{"attribute value", `<set-backend-service backend-id="be1" />`, `<set-backend-service backend-id="be2" />`, false},
+		{"element order", "<inbound><base /><cors /></inbound>", "<inbound><cors /><base /></inbound>", false},
+		{"text", "<value>a b</value>", "<value>a  b</value>", false},
+		{"not well-formed", "<inbound>\n  <a>\n</inbound>", "<inbound> <a> </inbound>", true},
+	}
+	for _, tt := range tests {
+		a, b := NormalizePolicy(tt.a), NormalizePolicy(tt.b)
+		if (a == b) != tt.same {
+			t.Errorf("%s: NormalizePolicy = %q and %q, want same %v", tt.name, a, b, tt.same)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	state := func(change func(s State)) State {
+		s := NewState("test")
+		s.Backends["be1"] = BackendState{URL: "https://a.com", Protocol: "http"}
+		s.APIs["echo"] = APIState{Path: "echo", Protocols: []string{"https", "http"}, ServiceURL: "https://a.com/echo",
+			Policy:     `<policies><inbound><set-backend-service backend-id="be1" /></inbound></policies>`,
+			Operations: map[string]OperationState{"get": {Method: "GET", URLTemplate: "/"}}}
+		if change != nil {
+			change(s)
+		}
+		return s
+	}
+	api := func(s State, change func(api *APIState)) {
+		a := s.APIs["echo"]
+		change(&a)
+		s.APIs["echo"] = a
+	}
+
+	tests := []struct {
+		name    string
+		b       State
+		options CompareOptions
+		want    []Difference
+	}{
+		{"same", state(nil), CompareOptions{}, []Difference{}},
+		{"normalized equal", state(func(s State) {
+			s.Backends["be1"] = BackendState{URL: "HTTPS://A.com:443/", Protocol: "HTTP"}
+			api(s, func(a *APIState) {
+				a.Path, a.Protocols = "/echo/", []string{"HTTP", "https"}
+				a.Policy = "<policies>\n  <inbound>\n    <set-backend-service backend-id=\"be1\"></set-backend-service>\n  </inbound>\n</policies>"
+				a.Operations = map[string]OperationState{"get": {Method: "get", URLTemplate: "/"}}
+			})
+		}), CompareOptions{}, []Difference{}},
+		{"only in one", state(func(s State) {
+			delete(s.Backends, "be1")
+			s.Backends["be2"] = BackendState{URL: "https://b.com", Protocol: "http"}
+			api(s, func(a *APIState) {
+				a.Operations = map[string]OperationState{"post": {Method: "POST", URLTemplate: "/"}}
+			})
+		}), CompareOptions{}, []Difference{
+			{Kind: DifferenceOnlyInA, Entity: "backend/be1"},
+			{Kind: DifferenceOnlyInB, Entity: "backend/be2"},
+			{Kind: DifferenceOnlyInA, Entity: "api/echo/operation/get"},
+			{Kind: DifferenceOnlyInB, Entity: "api/echo/operation/post"},
+		}},
+		{"changed", state(func(s State) {
+			s.Backends["be1"] = BackendState{URL: "https://b.com", Protocol: "soap", ValidateCertificateChain: true}
+			api(s, func(a *APIState) {
+				a.Policy = `<policies><inbound><set-backend-service backend-id="be2" /></inbound></policies>`
+				a.Operations = map[string]OperationState{"get": {Method: "GET", URLTemplate: "/{id}"}}
+			})
+		}), CompareOptions{}, []Difference{
+			{Kind: DifferenceChanged, Entity: "backend/be1", Field: "url", A: "https://a.com", B: "https://b.com"},
+			{Kind: DifferenceChanged, Entity: "backend/be1", Field: "protocol", A: "http", B: "soap"},
+			{Kind: DifferenceChanged, Entity: "backend/be1", Field: "tls.validateCertificateChain", A: "false", B: "true"},
+			{Kind: DifferenceChanged, Entity: "api/echo", Field: "policy",
+				A: `<policies><inbound><set-backend-service backend-id="be1" /></inbound></policies>`,
+				B: `<policies><inbound><set-backend-service backend-id="be2" /></inbound></policies>`},
+			{Kind: DifferenceChanged, Entity: "api/echo/operation/get", Field: "urlTemplate", A: "/", B: "/{id}"},
+		}},
+		{"ignore URLs", state(func(s State) {
+			s.Backends["be1"] = BackendState{URL: "https://b.com", Protocol: "http"}
+			api(s, func(a *APIState) { a.ServiceURL = "https://b.com/echo" })
+		}), CompareOptions{IgnoreURLs: true}, []Difference{}},
+	}
+	for _, tt := range tests {
+		if got := Compare(state(nil), tt.b, tt.options); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Compare = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,13 +1,20 @@
 package apim
 
 import (
-	"log"
+	"net/http"
+	"regexp"
 	"strings"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/apimanagement/armapimanagement"
 )
 
+// parameter {name} of URL template of an operation
+var urlTemplateParameter = regexp.MustCompile(`\{([^{}]+)\}`)
+
 type Operation struct {
 	Method      string
 	Name        string
@@ -38,20 +45,40 @@ func safePointerString(s *string) string {
 	return value
 }
 
+// retry with exponential backoff on throttling (429) and transient errors from ARM, Retry-After header is honored
+func (a APIM) clientOptions() *arm.ClientOptions {
+	return &arm.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			Cloud: a.Cloud,
+			Retry: policy.RetryOptions{
+				MaxRetries:    6,
+				RetryDelay:    2 * time.Second,
+				MaxRetryDelay: 60 * time.Second,
+				StatusCodes: []int{
+					http.StatusRequestTimeout,
+					http.StatusTooManyRequests,
+					http.StatusInternalServerError,
+					http.StatusBadGateway,
+					http.StatusServiceUnavailable,
+					http.StatusGatewayTimeout,
+				},
+			},
+		},
+	}
+}
+
 func (a APIM) getOperationPolicy(resourceGroup, serviceName, apiID, operationID string) ([]string, error) {
 
 	var operationPolicies []string
 
-	apiOperationPolicyClient, err := armapimanagement.NewAPIOperationPolicyClient(a.SubscriptionID, a.Credential, nil)
+	apiOperationPolicyClient, err := armapimanagement.NewAPIOperationPolicyClient(a.SubscriptionID, a.Credential, a.clientOptions())
 	if err != nil {
-		log.Println("failed to create client: %v", err)
-		return nil, err
+		return nil, classify(err)
 	}
 
 	listOperation, err := apiOperationPolicyClient.ListByOperation(a.Context, resourceGroup, serviceName, apiID, operationID, &armapimanagement.APIOperationPolicyClientListByOperationOptions{})
 	if err != nil {
-		log.Println("failed to create client: %v", err)
-		return nil, err
+		return nil, classify(err)
 	}
 	for _, v := range listOperation.Value {
 		operationPolicies = append(operationPolicies, string(*v.Properties.Value))
@@ -60,9 +87,9 @@ func (a APIM) getOperationPolicy(resourceGroup, serviceName, apiID, operationID
 }
 
 func (a APIM) getOperations(resourceGroup, serviceName, apiID, filter string) ([]Operation, error) {
-	apiOperationClient, err := armapimanagement.NewAPIOperationClient(a.SubscriptionID, a.Credential, nil)
+	apiOperationClient, err := armapimanagement.NewAPIOperationClient(a.SubscriptionID, a.Credential, a.clientOptions())
 	if err != nil {
-		log.Fatalf("failed to create client: %v", err)
+		return []Operation{}, classify(err)
 	}
 	pager := apiOperationClient.NewListByAPIPager(resourceGroup, serviceName, apiID, &armapimanagement.APIOperationClientListByAPIOptions{
 		Filter: nil,
@@ -76,7 +103,7 @@ func (a APIM) getOperations(resourceGroup, serviceName, apiID, filter string) ([
 	for pager.More() {
 		nextResult, err := pager.NextPage(a.Context)
 		if err != nil {
-			log.Fatalf("failed to advance page: %v", err)
+			return []Operation{}, classify(err)
 		}
 		for _, v := range nextResult.Value {
 			operations = append(operations, Operation{
@@ -93,30 +120,27 @@ func (a APIM) getAPIPolicy(resourceGroup, serviceName, apiID string) ([]string,
 
 	var apiPolicies []string
 
-	apiOperationPolicyClient, err := armapimanagement.NewAPIPolicyClient(a.SubscriptionID, a.Credential, nil)
+	apiOperationPolicyClient, err := armapimanagement.NewAPIPolicyClient(a.SubscriptionID, a.Credential, a.clientOptions())
 	if err != nil {
-		log.Println("failed to create client: %v", err)
-		return nil, err
+		return nil, classify(err)
 	}
 
 	apiPolicyClientListByAPIResponse, err := apiOperationPolicyClient.ListByAPI(a.Context, resourceGroup, serviceName, apiID, &armapimanagement.APIPolicyClientListByAPIOptions{})
 	if err != nil {
-		log.Println("failed to create client: %v", err)
-		return nil, err
+		return nil, classify(err)
 	}
 
 	for _, ps := range apiPolicyClientListByAPIResponse.Value {
 		apiPolicies = append(apiPolicies, safePointerString(ps.Properties.Value))
 	}
 
-	return apiPolicies, err
+	return apiPolicies, classify(err)
 }
 
 func (a APIM) getAPIs(resourceGroup, serviceName, filter string) ([]Api, error) {
-	client, err := armapimanagement.NewAPIClient(a.SubscriptionID, a.Credential, nil)
+	client, err := armapimanagement.NewAPIClient(a.SubscriptionID, a.Credential, a.clientOptions())
 	if err != nil {
-		log.Println("failed to create client: %v", err)
-		return []Api{}, err
+		return []Api{}, classify(err)
 	}
 	pager := client.NewListByServicePager(resourceGroup,
 		serviceName,
@@ -133,13 +157,12 @@ func (a APIM) getAPIs(resourceGroup, serviceName, filter string) ([]Api, error)
 	for pager.More() {
 		nextResult, err := pager.NextPage(a.Context)
 		if err != nil {
-			return []Api{}, err
-			log.Fatalf("failed to advance page: %v", err)
+			return []Api{}, classify(err)
 		}
 
-		for i, v := range nextResult.Value {
+		for _, v := range nextResult.Value {
 			apis = append(apis, Api{
-				No:          (i + 1),
+				No:          len(apis) + 1,
 				Name:        safePointerString(v.Name),
 				DisplayName: safePointerString(v.Properties.DisplayName),
 				Protocols: func() []string {
@@ -158,48 +181,75 @@ func (a APIM) getAPIs(resourceGroup, serviceName, filter string) ([]Api, error)
 }
 
 func (a APIM) createOrUpdateBackend(resourceGroup, serviceName, backendID, url, protocol string) (armapimanagement.BackendClientCreateOrUpdateResponse, error) {
-	client, err := armapimanagement.NewBackendClient(a.SubscriptionID, a.Credential, nil)
+	client, err := armapimanagement.NewBackendClient(a.SubscriptionID, a.Credential, a.clientOptions())
 	if err != nil {
-		log.Println("failed to create client: %v", err)
-		return armapimanagement.BackendClientCreateOrUpdateResponse{}, err
+		return armapimanagement.BackendClientCreateOrUpdateResponse{}, classify(err)
 	}
 
-	return client.CreateOrUpdate(
+	defer a.invalidateBackendCache(resourceGroup, serviceName)
+	response, err := client.CreateOrUpdate(
 		a.Context,
 		resourceGroup,
 		serviceName,
 		backendID,
-		armapimanagement.BackendContract{
-			Properties: &armapimanagement.BackendContractProperties{
-				Protocol: func() *armapimanagement.BackendProtocol {
-					switch protocol {
-					case "http":
-						return &armapimanagement.PossibleBackendProtocolValues()[0]
-					case "soap":
-						return &armapimanagement.PossibleBackendProtocolValues()[1]
-					default:
-						return nil
-					}
-				}(),
-				URL:         to.Ptr(url),
-				Credentials: &armapimanagement.BackendCredentialsContract{},
-				Description: nil,
-				Properties:  &armapimanagement.BackendProperties{},
-				Proxy:       nil,
-				ResourceID:  nil,
-				TLS:         &armapimanagement.BackendTLSProperties{ValidateCertificateName: to.Ptr(false), ValidateCertificateChain: to.Ptr(false)},
-				Title:       nil,
-			},
-		},
+		backendContract(url, protocol),
 		&armapimanagement.BackendClientCreateOrUpdateOptions{})
+	return response, classify(err)
+}
+
+// backend contract sent to APIM by createOrUpdateBackend
+func backendContract(url, protocol string) armapimanagement.BackendContract {
+	return armapimanagement.BackendContract{
+		Properties: &armapimanagement.BackendContractProperties{
+			Protocol: func() *armapimanagement.BackendProtocol {
+				switch protocol {
+				case "http":
+					return &armapimanagement.PossibleBackendProtocolValues()[0]
+				case "soap":
+					return &armapimanagement.PossibleBackendProtocolValues()[1]
+				default:
+					return nil
+				}
+			}(),
+			URL:         to.Ptr(url),
+			Credentials: &armapimanagement.BackendCredentialsContract{},
+			Description: nil,
+			Properties:  &armapimanagement.BackendProperties{},
+			Proxy:       nil,
+			ResourceID:  nil,
+			TLS:         &armapimanagement.BackendTLSProperties{ValidateCertificateName: to.Ptr(false), ValidateCertificateChain: to.Ptr(false)},
+			Title:       nil,
+		},
+	}
+}
+
+// get backend by ID from APIM
+func (a APIM) getBackend(resourceGroup, serviceName, backendID string) (Backend, error) {
+	client, err := armapimanagement.NewBackendClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return Backend{}, classify(err)
+	}
+
+	response, err := client.Get(a.Context, resourceGroup, serviceName, backendID, &armapimanagement.BackendClientGetOptions{})
+	if err != nil {
+		return Backend{}, classify(err)
+	}
+
+	backend := Backend{Name: safePointerString(response.Name)}
+	if response.Properties != nil {
+		backend.URL = safePointerString(response.Properties.URL)
+		if response.Properties.Protocol != nil {
+			backend.Protocol = string(*response.Properties.Protocol)
+		}
+	}
+	return backend, nil
 }
 
 // get backend from APIM Filter pettern {key}={val}
 func (a APIM) getBackends(resourceGroup, serviceName, filter string) ([]Backend, error) {
-	client, err := armapimanagement.NewBackendClient(a.SubscriptionID, a.Credential, nil)
+	client, err := armapimanagement.NewBackendClient(a.SubscriptionID, a.Credential, a.clientOptions())
 	if err != nil {
-		log.Println("failed to create client: %v", err)
-		return []Backend{}, err
+		return []Backend{}, classify(err)
 	}
 
 	filters := strings.Split(filter, "=")
@@ -231,7 +281,7 @@ func (a APIM) getBackends(resourceGroup, serviceName, filter string) ([]Backend,
 	for pager.More() {
 		nextResult, err := pager.NextPage(a.Context)
 		if err != nil {
-			log.Fatalf("failed to advance page: %v", err)
+			return []Backend{}, classify(err)
 		}
 
 		for _, v := range nextResult.Value {
@@ -246,7 +296,7 @@ func (a APIM) getBackends(resourceGroup, serviceName, filter string) ([]Backend,
 			})
 		}
 	}
-	return backends, err
+	return backends, classify(err)
 }
 
 func (a APIM) getAPIsBindingBackend(resourceGroup, serviceName, filter string) (
@@ -288,3 +338,279 @@ func (a APIM) getAPIsBindingBackend(resourceGroup, serviceName, filter string) (
 		APIs []Api
 	}{}, nil
 }
+
+type Revision struct {
+	APIID       string
+	Revision    string
+	Description string
+	IsCurrent   bool
+	IsOnline    bool
+	Created     string
+}
+
+type VersionSet struct {
+	Name              string
+	DisplayName       string
+	VersioningScheme  string
+	VersionHeaderName string
+	VersionQueryName  string
+}
+
+// Content of a new API revision, the source files of parse
+type RevisionConfig struct {
+	DisplayName           string
+	Path                  string
+	Protocols             []string
+	SubscriptionRequired  bool
+	SubscriptionKeyHeader string
+	SubscriptionKeyQuery  string
+	Policy                string
+	Operations            []RevisionOperation
+}
+
+type RevisionOperation struct {
+	ID          string
+	DisplayName string
+	Method      string
+	URLTemplate string
+}
+
+func (a APIM) getAPIRevisions(resourceGroup, serviceName, apiID string) ([]Revision, error) {
+	client, err := armapimanagement.NewAPIRevisionClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return []Revision{}, classify(err)
+	}
+	pager := client.NewListByServicePager(resourceGroup, serviceName, apiID, &armapimanagement.APIRevisionClientListByServiceOptions{})
+
+	revisions := []Revision{}
+
+	for pager.More() {
+		nextResult, err := pager.NextPage(a.Context)
+		if err != nil {
+			return []Revision{}, classify(err)
+		}
+		for _, v := range nextResult.Value {
+			revision := Revision{
+				APIID:       safePointerString(v.APIID),
+				Revision:    safePointerString(v.APIRevision),
+				Description: safePointerString(v.Description),
+				IsCurrent:   v.IsCurrent != nil && *v.IsCurrent,
+				IsOnline:    v.IsOnline != nil && *v.IsOnline,
+			}
+			if v.CreatedDateTime != nil {
+				revision.Created = v.CreatedDateTime.Format("2006-01-02 15:04:05")
+			}
+			revisions = append(revisions, revision)
+		}
+	}
+	return revisions, nil
+}
+
+func (a APIM) getAPIVersionSets(resourceGroup, serviceName string) ([]VersionSet, error) {
+	client, err := armapimanagement.NewAPIVersionSetClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return []VersionSet{}, classify(err)
+	}
+	pager := client.NewListByServicePager(resourceGroup, serviceName, &armapimanagement.APIVersionSetClientListByServiceOptions{})
+
+	versionSets := []VersionSet{}
+
+	for pager.More() {
+		nextResult, err := pager.NextPage(a.Context)
+		if err != nil {
+			return []VersionSet{}, classify(err)
+		}
+		for _, v := range nextResult.Value {
+			versionSet := VersionSet{Name: safePointerString(v.Name)}
+			if v.Properties != nil {
+				versionSet.DisplayName = safePointerString(v.Properties.DisplayName)
+				versionSet.VersionHeaderName = safePointerString(v.Properties.VersionHeaderName)
+				versionSet.VersionQueryName = safePointerString(v.Properties.VersionQueryName)
+				if v.Properties.VersioningScheme != nil {
+					versionSet.VersioningScheme = string(*v.Properties.VersioningScheme)
+				}
+			}
+			versionSets = append(versionSets, versionSet)
+		}
+	}
+	return versionSets, nil
+}
+
+// create a new revision {apiID};rev={revision} of the config with its policy and operations, only the version of
+// the API is taken from the current revision
+func (a APIM) createAPIRevision(resourceGroup, serviceName, apiID, revision, description string, config RevisionConfig) (armapimanagement.APIClientCreateOrUpdateResponse, error) {
+	client, err := armapimanagement.NewAPIClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return armapimanagement.APIClientCreateOrUpdateResponse{}, classify(err)
+	}
+
+	current, err := a.getAPI(resourceGroup, serviceName, apiID)
+	if err != nil {
+		return armapimanagement.APIClientCreateOrUpdateResponse{}, err
+	}
+
+	revisionID := apiID + ";rev=" + revision
+	poller, err := client.BeginCreateOrUpdate(
+		a.Context,
+		resourceGroup,
+		serviceName,
+		revisionID,
+		apiRevisionParameter(current, config, description),
+		&armapimanagement.APIClientBeginCreateOrUpdateOptions{})
+	if err != nil {
+		return armapimanagement.APIClientCreateOrUpdateResponse{}, classify(err)
+	}
+	response, err := poller.PollUntilDone(a.Context, nil)
+	if err != nil {
+		return response, classify(err)
+	}
+
+	if config.Policy != "" {
+		policyClient, err := armapimanagement.NewAPIPolicyClient(a.SubscriptionID, a.Credential, a.clientOptions())
+		if err != nil {
+			return response, classify(err)
+		}
+		if _, err := policyClient.CreateOrUpdate(a.Context, resourceGroup, serviceName, revisionID, armapimanagement.PolicyIDNamePolicy,
+			policyContract(config.Policy), &armapimanagement.APIPolicyClientCreateOrUpdateOptions{}); err != nil {
+			return response, classify(err)
+		}
+	}
+
+	operationClient, err := armapimanagement.NewAPIOperationClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return response, classify(err)
+	}
+	for _, operation := range config.Operations {
+		if _, err := operationClient.CreateOrUpdate(a.Context, resourceGroup, serviceName, revisionID, operation.ID,
+			revisionOperationContract(operation), &armapimanagement.APIOperationClientCreateOrUpdateOptions{}); err != nil {
+			return response, classify(err)
+		}
+	}
+	return response, nil
+}
+
+// parameter of a new revision of the config, in the version set and version of the current revision
+func apiRevisionParameter(current armapimanagement.APIContract, config RevisionConfig, description string) armapimanagement.APICreateOrUpdateParameter {
+	properties := &armapimanagement.APICreateOrUpdateProperties{
+		APIRevisionDescription: to.Ptr(description),
+		DisplayName:            to.Ptr(config.DisplayName),
+		Path:                   to.Ptr(config.Path),
+		SubscriptionRequired:   to.Ptr(config.SubscriptionRequired),
+	}
+	for _, protocol := range config.Protocols {
+		properties.Protocols = append(properties.Protocols, to.Ptr(armapimanagement.Protocol(protocol)))
+	}
+	if config.SubscriptionKeyHeader != "" || config.SubscriptionKeyQuery != "" {
+		properties.SubscriptionKeyParameterNames = &armapimanagement.SubscriptionKeyParameterNamesContract{
+			Header: to.Ptr(config.SubscriptionKeyHeader),
+			Query:  to.Ptr(config.SubscriptionKeyQuery),
+		}
+	}
+	if current.Properties != nil {
+		properties.APIVersion = current.Properties.APIVersion
+		properties.APIVersionSetID = current.Properties.APIVersionSetID
+	}
+	return armapimanagement.APICreateOrUpdateParameter{Properties: properties}
+}
+
+// operation contract of the revision, parameters {name} of the URL template are required strings
+func revisionOperationContract(operation RevisionOperation) armapimanagement.OperationContract {
+	properties := &armapimanagement.OperationContractProperties{
+		DisplayName: to.Ptr(operation.DisplayName),
+		Method:      to.Ptr(operation.Method),
+		URLTemplate: to.Ptr(operation.URLTemplate),
+	}
+	for _, match := range urlTemplateParameter.FindAllStringSubmatch(operation.URLTemplate, -1) {
+		properties.TemplateParameters = append(properties.TemplateParameters, &armapimanagement.ParameterContract{
+			Name:     to.Ptr(match[1]),
+			Type:     to.Ptr("string"),
+			Required: to.Ptr(true),
+		})
+	}
+	return armapimanagement.OperationContract{Properties: properties}
+}
+
+// ID of release of the revision, unique by time of release
+func apiReleaseID(revision string) string {
+	return "rev-" + revision + "-" + time.Now().UTC().Format("20060102150405")
+}
+
+// release contract which makes {apiID};rev={revision} current
+func apiReleaseContract(current armapimanagement.APIContract, revision, notes string) armapimanagement.APIReleaseContract {
+	return armapimanagement.APIReleaseContract{
+		Properties: &armapimanagement.APIReleaseContractProperties{
+			APIID: to.Ptr(safePointerString(current.ID) + ";rev=" + revision),
+			Notes: to.Ptr(notes),
+		},
+	}
+}
+
+// create a release for {apiID};rev={revision}, this makes the revision current
+func (a APIM) createAPIRelease(resourceGroup, serviceName, apiID, revision, notes string) (armapimanagement.APIReleaseClientCreateOrUpdateResponse, error) {
+	current, err := a.getAPI(resourceGroup, serviceName, apiID)
+	if err != nil {
+		return armapimanagement.APIReleaseClientCreateOrUpdateResponse{}, err
+	}
+
+	client, err := armapimanagement.NewAPIReleaseClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return armapimanagement.APIReleaseClientCreateOrUpdateResponse{}, classify(err)
+	}
+
+	response, err := client.CreateOrUpdate(
+		a.Context,
+		resourceGroup,
+		serviceName,
+		apiID,
+		apiReleaseID(revision),
+		apiReleaseContract(current, revision, notes),
+		&armapimanagement.APIReleaseClientCreateOrUpdateOptions{})
+	return response, classify(err)
+}
+
+type Product struct {
+	Name        string
+	DisplayName string
+	APIs        []string
+}
+
+// get products with API names in each product
+func (a APIM) getProducts(resourceGroup, serviceName string) ([]Product, error) {
+	client, err := armapimanagement.NewProductClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return []Product{}, classify(err)
+	}
+	productAPIClient, err := armapimanagement.NewProductAPIClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return []Product{}, classify(err)
+	}
+
+	products := []Product{}
+
+	pager := client.NewListByServicePager(resourceGroup, serviceName, &armapimanagement.ProductClientListByServiceOptions{})
+	for pager.More() {
+		nextResult, err := pager.NextPage(a.Context)
+		if err != nil {
+			return []Product{}, classify(err)
+		}
+		for _, v := range nextResult.Value {
+			product := Product{Name: safePointerString(v.Name), APIs: []string{}}
+			if v.Properties != nil {
+				product.DisplayName = safePointerString(v.Properties.DisplayName)
+			}
+
+			apiPager := productAPIClient.NewListByProductPager(resourceGroup, serviceName, product.Name, &armapimanagement.ProductAPIClientListByProductOptions{})
+			for apiPager.More() {
+				apiResult, err := apiPager.NextPage(a.Context)
+				if err != nil {
+					return []Product{}, classify(err)
+				}
+				for _, api := range apiResult.Value {
+					product.APIs = append(product.APIs, safePointerString(api.Name))
+				}
+			}
+			products = append(products, product)
+		}
+	}
+	return products, nil
+}
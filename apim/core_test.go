@@ -0,0 +1,53 @@
+package apim
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/apimanagement/armapimanagement"
+)
+
+func TestAPIRevisionParameter(t *testing.T) {
+	current := armapimanagement.APIContract{ID: to.Ptr("/apis/orders"), Properties: &armapimanagement.APIContractProperties{
+		Path: to.Ptr("live"), ServiceURL: to.Ptr("https://live.com"), APIVersion: to.Ptr("v1"), APIVersionSetID: to.Ptr("/apiVersionSets/orders-versionset")}}
+	config := RevisionConfig{DisplayName: "orders", Path: "orders", Protocols: []string{"https"}, SubscriptionKeyHeader: "Ocp-Apim-Subscription-Key"}
+
+	properties := apiRevisionParameter(current, config, "my change").Properties
+	if properties.SourceAPIID != nil || properties.ServiceURL != nil {
+		t.Errorf("revision is cloned from the current revision: sourceApiId %v, serviceUrl %v", properties.SourceAPIID, properties.ServiceURL)
+	}
+	if got := safePointerString(properties.Path); got != "orders" {
+		t.Errorf("path = %s, want orders of the config", got)
+	}
+	if got := safePointerString(properties.APIVersionSetID); got != "/apiVersionSets/orders-versionset" || safePointerString(properties.APIVersion) != "v1" {
+		t.Errorf("version = %s of %s, want v1 of the current revision", safePointerString(properties.APIVersion), got)
+	}
+	if len(properties.Protocols) != 1 || *properties.Protocols[0] != armapimanagement.ProtocolHTTPS {
+		t.Errorf("protocols = %v", properties.Protocols)
+	}
+}
+
+func TestRevisionOperationContract(t *testing.T) {
+	tests := []struct {
+		urlTemplate string
+		parameters  []string
+	}{
+		{"/orders", nil},
+		{"/orders/{id}", []string{"id"}},
+		{"/orders/{orderId}/items/{itemId}", []string{"orderId", "itemId"}},
+	}
+	for _, tt := range tests {
+		contract := revisionOperationContract(RevisionOperation{ID: "op", DisplayName: "op", Method: "GET", URLTemplate: tt.urlTemplate})
+		var parameters []string
+		for _, parameter := range contract.Properties.TemplateParameters {
+			if !*parameter.Required || safePointerString(parameter.Type) != "string" {
+				t.Errorf("%s: parameter %s is not a required string", tt.urlTemplate, safePointerString(parameter.Name))
+			}
+			parameters = append(parameters, safePointerString(parameter.Name))
+		}
+		if !reflect.DeepEqual(parameters, tt.parameters) {
+			t.Errorf("template parameters of %s = %v, want %v", tt.urlTemplate, parameters, tt.parameters)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package apim
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// Authentication methods of NewCredential
+const (
+	AuthDefault          = "default"
+	AuthCLI              = "cli"
+	AuthSecret           = "secret"
+	AuthCertificate      = "certificate"
+	AuthWorkloadIdentity = "workload-identity"
+	AuthManagedIdentity  = "managed-identity"
+	AuthDeviceCode       = "device-code"
+)
+
+// Options to create a credential, secrets are read from AZURE_CLIENT_SECRET and AZURE_CLIENT_CERTIFICATE_PASSWORD
+type CredentialOptions struct {
+	Method             string
+	TenantID           string
+	ClientID           string
+	CertificatePath    string
+	FederatedTokenFile string
+	Cloud              cloud.Configuration
+}
+
+// Cloud configuration by name {public,china,usgov}
+func Cloud(name string) (cloud.Configuration, error) {
+	switch strings.ToLower(name) {
+	case "", "public", "azurecloud":
+		return cloud.AzurePublic, nil
+	case "china", "azurechinacloud":
+		return cloud.AzureChina, nil
+	case "usgov", "azureusgovernment":
+		return cloud.AzureGovernment, nil
+	}
+	return cloud.Configuration{}, errors.New("unknown cloud " + name + ", support {public,china,usgov}")
+}
+
+// Cloud with its Resource Manager endpoint replaced, e.g. by a stand-in ARM server for tests
+func WithResourceManagerEndpoint(c cloud.Configuration, endpoint string) cloud.Configuration {
+	services := map[cloud.ServiceName]cloud.ServiceConfiguration{}
+	for name, service := range c.Services {
+		services[name] = service
+	}
+	service := services[cloud.ResourceManager]
+	service.Endpoint = endpoint
+	services[cloud.ResourceManager] = service
+	c.Services = services
+	return c
+}
+
+// Create a credential of the authentication method
+func NewCredential(o CredentialOptions) (azcore.TokenCredential, error) {
+	clientOptions := azcore.ClientOptions{Cloud: o.Cloud}
+
+	var (
+		cred azcore.TokenCredential
+		err  error
+	)
+	switch o.Method {
+	case "", AuthDefault:
+		cred, err = azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{ClientOptions: clientOptions, TenantID: o.TenantID})
+	case AuthCLI:
+		cred, err = azidentity.NewAzureCLICredential(&azidentity.AzureCLICredentialOptions{TenantID: o.TenantID})
+	case AuthSecret:
+		secret := os.Getenv("AZURE_CLIENT_SECRET")
+		if o.TenantID == "" || o.ClientID == "" || secret == "" {
+			return nil, errors.New("tenant ID, client ID and AZURE_CLIENT_SECRET are required by " + AuthSecret)
+		}
+		cred, err = azidentity.NewClientSecretCredential(o.TenantID, o.ClientID, secret, &azidentity.ClientSecretCredentialOptions{ClientOptions: clientOptions})
+	case AuthCertificate:
+		if o.TenantID == "" || o.ClientID == "" || o.CertificatePath == "" {
+			return nil, errors.New("tenant ID, client ID and certificate path are required by " + AuthCertificate)
+		}
+		data, readErr := os.ReadFile(o.CertificatePath)
+		if readErr != nil {
+			return nil, readErr
+		}
+		var password []byte
+		if p := os.Getenv("AZURE_CLIENT_CERTIFICATE_PASSWORD"); p != "" {
+			password = []byte(p)
+		}
+		certs, key, parseErr := azidentity.ParseCertificates(data, password)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		cred, err = azidentity.NewClientCertificateCredential(o.TenantID, o.ClientID, certs, key, &azidentity.ClientCertificateCredentialOptions{ClientOptions: clientOptions})
+	case AuthWorkloadIdentity:
+		if o.TenantID == "" || o.ClientID == "" || o.FederatedTokenFile == "" {
+			return nil, errors.New("tenant ID, client ID and federated token file are required by " + AuthWorkloadIdentity)
+		}
+		// the token file is rotated by the platform, read it on every token request
+		tokenFile := o.FederatedTokenFile
+		cred, err = azidentity.NewClientAssertionCredential(o.TenantID, o.ClientID, func(context.Context) (string, error) {
+			token, err := os.ReadFile(tokenFile)
+			return strings.TrimSpace(string(token)), err
+		}, &azidentity.ClientAssertionCredentialOptions{ClientOptions: clientOptions})
+	case AuthManagedIdentity:
+		options := &azidentity.ManagedIdentityCredentialOptions{ClientOptions: clientOptions}
+		if o.ClientID != "" {
+			options.ID = azidentity.ClientID(o.ClientID)
+		}
+		cred, err = azidentity.NewManagedIdentityCredential(options)
+	case AuthDeviceCode:
+		cred, err = azidentity.NewDeviceCodeCredential(&azidentity.DeviceCodeCredentialOptions{ClientOptions: clientOptions, TenantID: o.TenantID, ClientID: o.ClientID})
+	default:
+		return nil, errors.New("unknown authentication method " + o.Method)
+	}
+	if err != nil {
+		return nil, NewError(ErrAuthFailed, "cannot create "+o.Method+" credential", err)
+	}
+	return cred, nil
+}
@@ -0,0 +1,81 @@
+package apim
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// Classes of errors returned by apim and engine, check with errors.Is(err, apim.ErrNotFound)
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrDuplicateURL = errors.New("duplicate URL")
+	ErrDuplicateID  = errors.New("duplicate ID")
+	ErrThrottled    = errors.New("throttled")
+	ErrAuthFailed   = errors.New("authentication failed")
+)
+
+// Error of a class (Kind) with message and the underlying error
+type Error struct {
+	Kind    error
+	Message string
+	Err     error
+}
+
+func NewError(kind error, message string, err error) *Error {
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = e.Kind.Error()
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Classify errors from Azure SDK into the classes of error
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var apimErr *Error
+	if errors.As(err, &apimErr) {
+		return err
+	}
+
+	var responseErr *azcore.ResponseError
+	if errors.As(err, &responseErr) {
+		switch responseErr.StatusCode {
+		case http.StatusTooManyRequests:
+			return NewError(ErrThrottled, "throttled by Azure Resource Manager", err)
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return NewError(ErrAuthFailed, "not authorized to Azure Resource Manager", err)
+		case http.StatusNotFound:
+			return NewError(ErrNotFound, "resource not found", err)
+		}
+		return err
+	}
+
+	// errors of credentials (authentication failed, credential unavailable) are not retriable
+	var authErr *azidentity.AuthenticationFailedError
+	var nonRetriable interface{ NonRetriable() }
+	if errors.As(err, &authErr) || errors.As(err, &nonRetriable) {
+		return NewError(ErrAuthFailed, "cannot get token from Azure credential", err)
+	}
+	return err
+}
@@ -0,0 +1,224 @@
+package apim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Relationship of products -> APIs -> backends -> backend hosts and APIs -> operations
+type Graph struct {
+	Products []GraphProduct `json:"products"`
+	APIs     []GraphAPI     `json:"apis"`
+	Backends []GraphBackend `json:"backends"`
+}
+
+type GraphProduct struct {
+	Name        string   `json:"name"`
+	DisplayName string   `json:"displayName"`
+	APIs        []string `json:"apis"`
+}
+
+type GraphAPI struct {
+	Name        string           `json:"name"`
+	DisplayName string           `json:"displayName"`
+	Path        string           `json:"path"`
+	ServiceURL  string           `json:"serviceUrl"`
+	BackendID   string           `json:"backendId,omitempty"`
+	Operations  []GraphOperation `json:"operations"`
+}
+
+type GraphOperation struct {
+	Name        string `json:"name"`
+	Method      string `json:"method"`
+	URLTemplate string `json:"urlTemplate"`
+}
+
+type GraphBackend struct {
+	ID       string `json:"id"`
+	URL      string `json:"url"`
+	Host     string `json:"host"`
+	Protocol string `json:"protocol"`
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Host
+}
+
+// Build dependency graph of the service
+func (a APIM) Graph(resourceGroup, serviceName string) (Graph, error) {
+	index, err := a.BackendIndex(resourceGroup, serviceName)
+	if err != nil {
+		return Graph{}, err
+	}
+	a.Backends = index
+
+	apiModels, err := a.ListAPIModel(resourceGroup, serviceName, "")
+	if err != nil {
+		return Graph{}, err
+	}
+
+	products, err := a.getProducts(resourceGroup, serviceName)
+	if err != nil {
+		return Graph{}, err
+	}
+
+	g := Graph{Products: []GraphProduct{}, APIs: []GraphAPI{}, Backends: []GraphBackend{}}
+
+	for _, backend := range index.Backends {
+		g.Backends = append(g.Backends, GraphBackend{ID: backend.Name, URL: backend.URL, Host: hostOf(backend.URL), Protocol: backend.Protocol})
+	}
+	sort.SliceStable(g.Backends, func(i, j int) bool { return g.Backends[i].ID < g.Backends[j].ID })
+
+	for _, model := range apiModels {
+		api := GraphAPI{
+			Name:        model.APIName,
+			DisplayName: model.APIDisplayName,
+			Path:        model.APIPath,
+			ServiceURL:  model.APIBackendURL,
+			BackendID:   model.BackendPolicyID,
+			Operations:  []GraphOperation{},
+		}
+		for _, operation := range model.Operation {
+			api.Operations = append(api.Operations, GraphOperation{Name: operation.Name, Method: operation.Method, URLTemplate: operation.URLTemplate})
+		}
+		g.APIs = append(g.APIs, api)
+	}
+
+	for _, product := range products {
+		g.Products = append(g.Products, GraphProduct{Name: product.Name, DisplayName: product.DisplayName, APIs: product.APIs})
+	}
+	sort.SliceStable(g.Products, func(i, j int) bool { return g.Products[i].Name < g.Products[j].Name })
+
+	return g, nil
+}
+
+// hosts of backends and of APIs serviceUrl without backend policy, sorted
+func (g Graph) hosts() []string {
+	set := map[string]bool{}
+	for _, backend := range g.Backends {
+		set[backend.Host] = true
+	}
+	for _, api := range g.APIs {
+		if api.BackendID == "" && api.ServiceURL != "" {
+			set[hostOf(api.ServiceURL)] = true
+		}
+	}
+	hosts := []string{}
+	for host := range set {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+func (g Graph) JSON() (string, error) {
+	data, err := json.MarshalIndent(g, "", "\t")
+	return string(data), err
+}
+
+func (g Graph) DOT() string {
+	quote := func(s string) string {
+		return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+	}
+
+	var b strings.Builder
+	b.WriteString("digraph apim {\n\trankdir=LR;\n\tnode [shape=box];\n\n")
+
+	for _, product := range g.Products {
+		fmt.Fprintf(&b, "\t%s [label=%s, shape=folder];\n", quote("product:"+product.Name), quote(product.DisplayName))
+	}
+	for _, api := range g.APIs {
+		fmt.Fprintf(&b, "\t%s [label=%s, shape=component];\n", quote("api:"+api.Name), quote(api.DisplayName+`\n/`+api.Path))
+		for _, operation := range api.Operations {
+			fmt.Fprintf(&b, "\t%s [label=%s, shape=note];\n", quote("operation:"+api.Name+"/"+operation.Name), quote(operation.Method+" "+operation.URLTemplate))
+		}
+	}
+	for _, backend := range g.Backends {
+		fmt.Fprintf(&b, "\t%s [label=%s, shape=cylinder];\n", quote("backend:"+backend.ID), quote(backend.ID+`\n`+backend.URL))
+	}
+	for _, host := range g.hosts() {
+		fmt.Fprintf(&b, "\t%s [label=%s, shape=ellipse];\n", quote("host:"+host), quote(host))
+	}
+	b.WriteString("\n")
+
+	for _, product := range g.Products {
+		for _, api := range product.APIs {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", quote("product:"+product.Name), quote("api:"+api))
+		}
+	}
+	for _, api := range g.APIs {
+		if api.BackendID != "" {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", quote("api:"+api.Name), quote("backend:"+api.BackendID))
+		} else if api.ServiceURL != "" {
+			fmt.Fprintf(&b, "\t%s -> %s [style=dashed];\n", quote("api:"+api.Name), quote("host:"+hostOf(api.ServiceURL)))
+		}
+		for _, operation := range api.Operations {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", quote("api:"+api.Name), quote("operation:"+api.Name+"/"+operation.Name))
+		}
+	}
+	for _, backend := range g.Backends {
+		fmt.Fprintf(&b, "\t%s -> %s;\n", quote("backend:"+backend.ID), quote("host:"+backend.Host))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func (g Graph) Mermaid() string {
+	// mermaid node id must be alphanumeric, labels are quoted
+	label := func(s string) string {
+		return `["` + strings.ReplaceAll(s, `"`, "#quot;") + `"]`
+	}
+	ids := map[string]string{}
+	id := func(key string) string {
+		if _, ok := ids[key]; !ok {
+			ids[key] = fmt.Sprintf("n%d", len(ids)+1)
+		}
+		return ids[key]
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+
+	for _, product := range g.Products {
+		fmt.Fprintf(&b, "\t%s%s\n", id("product:"+product.Name), label("product: "+product.DisplayName))
+	}
+	for _, api := range g.APIs {
+		fmt.Fprintf(&b, "\t%s%s\n", id("api:"+api.Name), label("api: "+api.DisplayName+" /"+api.Path))
+		for _, operation := range api.Operations {
+			fmt.Fprintf(&b, "\t%s%s\n", id("operation:"+api.Name+"/"+operation.Name), label(operation.Method+" "+operation.URLTemplate))
+		}
+	}
+	for _, backend := range g.Backends {
+		fmt.Fprintf(&b, "\t%s%s\n", id("backend:"+backend.ID), label("backend: "+backend.ID))
+	}
+	for _, host := range g.hosts() {
+		fmt.Fprintf(&b, "\t%s%s\n", id("host:"+host), label(host))
+	}
+
+	for _, product := range g.Products {
+		for _, api := range product.APIs {
+			fmt.Fprintf(&b, "\t%s --> %s\n", id("product:"+product.Name), id("api:"+api))
+		}
+	}
+	for _, api := range g.APIs {
+		if api.BackendID != "" {
+			fmt.Fprintf(&b, "\t%s --> %s\n", id("api:"+api.Name), id("backend:"+api.BackendID))
+		} else if api.ServiceURL != "" {
+			fmt.Fprintf(&b, "\t%s -.-> %s\n", id("api:"+api.Name), id("host:"+hostOf(api.ServiceURL)))
+		}
+		for _, operation := range api.Operations {
+			fmt.Fprintf(&b, "\t%s --> %s\n", id("api:"+api.Name), id("operation:"+api.Name+"/"+operation.Name))
+		}
+	}
+	for _, backend := range g.Backends {
+		fmt.Fprintf(&b, "\t%s --> %s\n", id("backend:"+backend.ID), id("host:"+backend.Host))
+	}
+	return b.String()
+}
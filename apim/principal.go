@@ -0,0 +1,51 @@
+package apim
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// Principal of the credential from claims of its token to Azure Resource Manager,
+// user principal name of users or app ID of service principals and managed identities
+func (a APIM) Principal() (string, error) {
+	audience := cloud.AzurePublic.Services[cloud.ResourceManager].Audience
+	if conf, ok := a.Cloud.Services[cloud.ResourceManager]; ok && conf.Audience != "" {
+		audience = conf.Audience
+	}
+
+	token, err := a.Credential.GetToken(a.Context, policy.TokenRequestOptions{Scopes: []string{strings.TrimSuffix(audience, "/") + "/.default"}})
+	if err != nil {
+		return "", classify(err)
+	}
+
+	parts := strings.Split(token.Token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", err
+	}
+
+	claims := struct {
+		UPN        string `json:"upn"`
+		UniqueName string `json:"unique_name"`
+		AppID      string `json:"appid"`
+		OID        string `json:"oid"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", err
+	}
+
+	for _, principal := range []string{claims.UPN, claims.UniqueName, claims.AppID, claims.OID} {
+		if principal != "" {
+			return principal, nil
+		}
+	}
+	return "", errors.New("no principal in token")
+}
@@ -0,0 +1,87 @@
+package apim
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/apimanagement/armapimanagement"
+)
+
+var (
+	backendIDAttrPattern     = regexp.MustCompile(`(<set-backend-service\b[^>]*?\bbackend-id=")([^"]*)(")`)
+	setBackendServicePattern = regexp.MustCompile(`<set-backend-service\b[^>]*?/?>`)
+	inboundBasePattern       = regexp.MustCompile(`<inbound>(\s*)<base\s*/>`)
+	inboundPattern           = regexp.MustCompile(`<inbound>`)
+)
+
+// Rebind set-backend-service of backend-id from to backendID in policy XML, the policy is changed in place to keep its
+// format. Only elements of backend-id from are changed, others e.g. of other <choose> branches are kept. ErrNotFound if
+// no element is of from. Without from (the API has no backend-id), a single set-backend-service with base-url is
+// replaced and it is added into inbound if missing
+func rebindPolicy(policy, from, backendID string) (string, error) {
+	element := `<set-backend-service backend-id="` + backendID + `" />`
+	if from != "" {
+		rebound := false
+		after := backendIDAttrPattern.ReplaceAllStringFunc(policy, func(attr string) string {
+			m := backendIDAttrPattern.FindStringSubmatch(attr)
+			if !strings.EqualFold(m[2], from) {
+				return attr
+			}
+			rebound = true
+			return m[1] + backendID + m[3]
+		})
+		if !rebound {
+			return "", NewError(ErrNotFound, "set-backend-service of backend-id "+from+" not found in policy", nil)
+		}
+		return after, nil
+	}
+
+	switch elements := setBackendServicePattern.FindAllString(policy, -1); {
+	case len(elements) > 1:
+		return "", fmt.Errorf("policy has %d set-backend-service elements and none is selected by backend-id", len(elements))
+	case len(elements) == 1 && backendIDAttrPattern.MatchString(elements[0]):
+		return "", fmt.Errorf("set-backend-service of policy is not of the inbound section: %s", elements[0])
+	case len(elements) == 1:
+		return setBackendServicePattern.ReplaceAllStringFunc(policy, func(tag string) string {
+			if strings.HasSuffix(tag, "/>") {
+				return element
+			}
+			return strings.TrimSuffix(element, " />") + ">"
+		}), nil
+	case inboundBasePattern.MatchString(policy):
+		return inboundBasePattern.ReplaceAllString(policy, "${0}${1}"+element), nil
+	case inboundPattern.MatchString(policy):
+		return inboundPattern.ReplaceAllString(policy, "${0}"+element), nil
+	case strings.TrimSpace(policy) == "":
+		return "<policies><inbound><base />" + element + "</inbound><backend><base /></backend><outbound><base /></outbound><on-error><base /></on-error></policies>", nil
+	}
+	return "", NewError(ErrNotFound, "inbound section not found in policy", nil)
+}
+
+// Rebind the API from backend from to backendID, set-backend-service backend-id of the API policy. ErrNotFound if the
+// backend does not exist or the policy has no set-backend-service of from. Return policy XML before and after the change
+func (a APIM) RebindAPIBackend(resourceGroup, serviceName, apiID, from, backendID string) (string, string, error) {
+	if _, err := a.getBackend(resourceGroup, serviceName, backendID); err != nil {
+		return "", "", err
+	}
+
+	before, err := a.GetAPIPolicyXML(resourceGroup, serviceName, apiID)
+	if err != nil {
+		return "", "", err
+	}
+	after, err := rebindPolicy(before, from, backendID)
+	if err != nil {
+		return before, "", err
+	}
+
+	client, err := armapimanagement.NewAPIPolicyClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return before, "", classify(err)
+	}
+	if _, err := client.CreateOrUpdate(a.Context, resourceGroup, serviceName, apiID, armapimanagement.PolicyIDNamePolicy,
+		policyContract(after), &armapimanagement.APIPolicyClientCreateOrUpdateOptions{}); err != nil {
+		return before, "", classify(err)
+	}
+	return before, after, nil
+}
@@ -0,0 +1,74 @@
+package apim
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRebindPolicy(t *testing.T) {
+	choose := `<policies>
+	<inbound>
+		<base />
+		<choose>
+			<when condition="@(context.Request.Headers.ContainsKey(&quot;x-beta&quot;))">
+				<set-backend-service backend-id="beta" />
+			</when>
+			<otherwise>
+				<set-backend-service id="route" backend-id="be1"></set-backend-service>
+			</otherwise>
+		</choose>
+	</inbound>
+</policies>`
+	tests := []struct {
+		name   string
+		policy string
+		from   string
+		want   string
+		err    error
+	}{
+		{"backend-id", `<policies><inbound><base /><set-backend-service backend-id="be1" /></inbound></policies>`, "be1",
+			`<policies><inbound><base /><set-backend-service backend-id="be2" /></inbound></policies>`, nil},
+		{"backend-id of case", `<inbound><set-backend-service backend-id="BE1" /></inbound>`, "be1",
+			`<inbound><set-backend-service backend-id="be2" /></inbound>`, nil},
+		{"choose branch of from only", choose, "be1",
+			`<policies>
+	<inbound>
+		<base />
+		<choose>
+			<when condition="@(context.Request.Headers.ContainsKey(&quot;x-beta&quot;))">
+				<set-backend-service backend-id="beta" />
+			</when>
+			<otherwise>
+				<set-backend-service id="route" backend-id="be2"></set-backend-service>
+			</otherwise>
+		</choose>
+	</inbound>
+</policies>`, nil},
+		{"from not in policy", choose, "old", "", ErrNotFound},
+		{"base-url", `<inbound><base />
+  <set-backend-service base-url="https://a.com" /></inbound>`, "", `<inbound><base />
+  <set-backend-service backend-id="be2" /></inbound>`, nil},
+		{"base-url of open tag", `<inbound><set-backend-service base-url="https://a.com"></set-backend-service></inbound>`, "",
+			`<inbound><set-backend-service backend-id="be2"></set-backend-service></inbound>`, nil},
+		{"branches without from", choose, "", "", errors.New("")},
+		{"no set-backend-service", "<policies>\n  <inbound>\n    <base />\n  </inbound>\n</policies>", "",
+			"<policies>\n  <inbound>\n    <base />\n    <set-backend-service backend-id=\"be2\" />\n  </inbound>\n</policies>", nil},
+		{"inbound without base", "<policies><inbound></inbound></policies>", "",
+			`<policies><inbound><set-backend-service backend-id="be2" /></inbound></policies>`, nil},
+		{"empty", "", "", `<policies><inbound><base /><set-backend-service backend-id="be2" /></inbound><backend><base /></backend><outbound><base /></outbound><on-error><base /></on-error></policies>`, nil},
+		{"no inbound", "<policies></policies>", "", "", ErrNotFound},
+	}
+	for _, tt := range tests {
+		got, err := rebindPolicy(tt.policy, tt.from, "be2")
+		switch {
+		case tt.err == nil && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.err != nil && err == nil:
+			t.Errorf("%s: expected error, got %s", tt.name, got)
+		case errors.Is(tt.err, ErrNotFound) && !errors.Is(err, ErrNotFound):
+			t.Errorf("%s: error = %v, want ErrNotFound", tt.name, err)
+		case got != tt.want:
+			t.Errorf("%s: rebindPolicy =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
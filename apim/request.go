@@ -0,0 +1,99 @@
+package apim
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/apimanagement/armapimanagement"
+)
+
+// api-version of Microsoft.ApiManagement requested by armapimanagement
+const armAPIVersion = "2021-08-01"
+
+// Request which would be sent to Azure Resource Manager, for dry-run
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Body   interface{} `json:"body"`
+}
+
+// URL of resource {path} of the API Management service
+func (a APIM) requestURL(resourceGroup, serviceName, path string) string {
+	endpoint := "https://management.azure.com"
+	if conf, ok := a.Cloud.Services[cloud.ResourceManager]; ok && conf.Endpoint != "" {
+		endpoint = conf.Endpoint
+	}
+	return strings.TrimSuffix(endpoint, "/") +
+		"/subscriptions/" + url.PathEscape(a.SubscriptionID) +
+		"/resourceGroups/" + url.PathEscape(resourceGroup) +
+		"/providers/Microsoft.ApiManagement/service/" + url.PathEscape(serviceName) +
+		path + "?api-version=" + armAPIVersion
+}
+
+// Request of CreateOrUpdateBackend, ErrDuplicateURL if the URL is used by other backend
+func (a APIM) CreateOrUpdateBackendRequest(resourceGroup, serviceName, backendID, url, protocol string) (Request, error) {
+	if err := a.checkBackendURL(resourceGroup, serviceName, url); err != nil {
+		return Request{}, err
+	}
+	return Request{
+		Method: "PUT",
+		URL:    a.requestURL(resourceGroup, serviceName, "/backends/"+backendID),
+		Body:   backendContract(url, protocol),
+	}, nil
+}
+
+// Requests of CreateAPIRevision: the revision, its policy and its operations
+func (a APIM) CreateAPIRevisionRequests(resourceGroup, serviceName, apiID, revision, description string, config RevisionConfig) ([]Request, error) {
+	current, err := a.getAPI(resourceGroup, serviceName, apiID)
+	if err != nil {
+		return []Request{}, err
+	}
+	path := "/apis/" + apiID + ";rev=" + revision
+	requests := []Request{{
+		Method: "PUT",
+		URL:    a.requestURL(resourceGroup, serviceName, path),
+		Body:   apiRevisionParameter(current, config, description),
+	}}
+	if config.Policy != "" {
+		requests = append(requests, Request{
+			Method: "PUT",
+			URL:    a.requestURL(resourceGroup, serviceName, path+"/policies/policy"),
+			Body:   policyContract(config.Policy),
+		})
+	}
+	for _, operation := range config.Operations {
+		requests = append(requests, Request{
+			Method: "PUT",
+			URL:    a.requestURL(resourceGroup, serviceName, path+"/operations/"+operation.ID),
+			Body:   revisionOperationContract(operation),
+		})
+	}
+	return requests, nil
+}
+
+// Request of ReleaseAPIRevision, release ID is generated by time of release
+func (a APIM) ReleaseAPIRevisionRequest(resourceGroup, serviceName, apiID, revision, notes string) (Request, error) {
+	current, err := a.getAPI(resourceGroup, serviceName, apiID)
+	if err != nil {
+		return Request{}, err
+	}
+	return Request{
+		Method: "PUT",
+		URL:    a.requestURL(resourceGroup, serviceName, "/apis/"+apiID+"/releases/"+apiReleaseID(revision)),
+		Body:   apiReleaseContract(current, revision, notes),
+	}, nil
+}
+
+// get API by ID
+func (a APIM) getAPI(resourceGroup, serviceName, apiID string) (armapimanagement.APIContract, error) {
+	client, err := armapimanagement.NewAPIClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return armapimanagement.APIContract{}, classify(err)
+	}
+	response, err := client.Get(a.Context, resourceGroup, serviceName, apiID, &armapimanagement.APIClientGetOptions{})
+	if err != nil {
+		return armapimanagement.APIContract{}, classify(err)
+	}
+	return response.APIContract, nil
+}
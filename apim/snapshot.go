@@ -0,0 +1,755 @@
+package apim
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/apimanagement/armapimanagement"
+	"github.com/rs/zerolog/log"
+)
+
+// Version of snapshot format, restore refuses snapshots of newer versions. Version 2 added version sets
+const SnapshotVersion = 2
+
+// Backends, APIs with operations and policies, named values and API version sets of a service
+type Snapshot struct {
+	Version        int       `json:"version"`
+	CreatedAt      time.Time `json:"createdAt"`
+	SubscriptionID string    `json:"subscriptionId"`
+	ResourceGroup  string    `json:"resourceGroup"`
+	ServiceName    string    `json:"serviceName"`
+
+	Backends    []*armapimanagement.BackendContract       `json:"backends"`
+	APIs        []SnapshotAPI                             `json:"apis"`
+	NamedValues []*armapimanagement.NamedValueContract    `json:"namedValues"`
+	VersionSets []*armapimanagement.APIVersionSetContract `json:"versionSets"`
+}
+
+// API of snapshot with its policy and operations
+type SnapshotAPI struct {
+	API        *armapimanagement.APIContract `json:"api"`
+	Policy     string                        `json:"policy,omitempty"`
+	Operations []SnapshotOperation           `json:"operations"`
+}
+
+// Operation of snapshot with its policy
+type SnapshotOperation struct {
+	Operation *armapimanagement.OperationContract `json:"operation"`
+	Policy    string                              `json:"policy,omitempty"`
+}
+
+// Capture snapshot of the service, values of secret named values are captured only when includeSecrets
+func (a APIM) CreateSnapshot(resourceGroup, serviceName string, includeSecrets bool) (Snapshot, error) {
+	snapshot := Snapshot{
+		Version:        SnapshotVersion,
+		CreatedAt:      time.Now().UTC(),
+		SubscriptionID: a.SubscriptionID,
+		ResourceGroup:  resourceGroup,
+		ServiceName:    serviceName,
+	}
+
+	var err error
+	if snapshot.Backends, err = a.listBackendContracts(resourceGroup, serviceName); err != nil {
+		return snapshot, err
+	}
+	if snapshot.NamedValues, err = a.listNamedValueContracts(resourceGroup, serviceName, includeSecrets); err != nil {
+		return snapshot, err
+	}
+	if snapshot.VersionSets, err = a.listVersionSetContracts(resourceGroup, serviceName); err != nil {
+		return snapshot, err
+	}
+
+	apis, err := a.listAPIContracts(resourceGroup, serviceName)
+	if err != nil {
+		return snapshot, err
+	}
+
+	// Each worker writes only its own index, the snapshot keeps the order of APIs on APIM
+	snapshot.APIs = make([]SnapshotAPI, len(apis))
+	err = a.forEach(len(apis), func(a APIM, i int) error {
+		api, err := a.snapshotAPI(resourceGroup, serviceName, apis[i])
+		snapshot.APIs[i] = api
+		return err
+	})
+	return snapshot, err
+}
+
+func (a APIM) snapshotAPI(resourceGroup, serviceName string, contract *armapimanagement.APIContract) (SnapshotAPI, error) {
+	apiID := safePointerString(contract.Name)
+	api := SnapshotAPI{API: contract, Operations: []SnapshotOperation{}}
+
+	policies, err := a.getAPIPolicy(resourceGroup, serviceName, apiID)
+	if err != nil {
+		return api, err
+	}
+	if len(policies) > 0 {
+		api.Policy = policies[0]
+	}
+
+	operations, err := a.listOperationContracts(resourceGroup, serviceName, apiID)
+	if err != nil {
+		return api, err
+	}
+	for _, operation := range operations {
+		policies, err := a.getOperationPolicy(resourceGroup, serviceName, apiID, safePointerString(operation.Name))
+		if err != nil {
+			return api, err
+		}
+		snapshotOperation := SnapshotOperation{Operation: operation}
+		if len(policies) > 0 {
+			snapshotOperation.Policy = policies[0]
+		}
+		api.Operations = append(api.Operations, snapshotOperation)
+	}
+	return api, nil
+}
+
+// Kinds of entity of snapshot, an entity is {kind}/{id}
+const (
+	EntityBackend    = "backend"
+	EntityAPI        = "api"
+	EntityNamedValue = "namedvalue"
+	EntityVersionSet = "versionset"
+)
+
+// Result of restore, entities as {kind}/{id}. Deleted are operations of restored APIs which are not in the snapshot,
+// as api/{id}/operation/{operation-id}
+type RestoreResult struct {
+	Restored []string
+	Skipped  []string
+	Deleted  []string
+}
+
+// Restore entities of snapshot selected by match to the service, all entities when match is nil.
+// Named values are restored before APIs which may reference them in policies, version sets before APIs of the sets.
+// The version set of a restored API is restored with it, ErrNotFound if it is neither in the snapshot nor on the service
+func (a APIM) RestoreSnapshot(resourceGroup, serviceName string, snapshot Snapshot, match func(kind, id string) bool) (RestoreResult, error) {
+	result := RestoreResult{Restored: []string{}, Skipped: []string{}, Deleted: []string{}}
+	if snapshot.Version > SnapshotVersion {
+		return result, fmt.Errorf("snapshot version %d is not supported, expected %d or older", snapshot.Version, SnapshotVersion)
+	}
+	if match == nil {
+		match = func(string, string) bool { return true }
+	}
+
+	for _, namedValue := range snapshot.NamedValues {
+		id := safePointerString(namedValue.Name)
+		if !match(EntityNamedValue, id) {
+			continue
+		}
+		if namedValue.Properties != nil && namedValue.Properties.Secret != nil && *namedValue.Properties.Secret &&
+			namedValue.Properties.Value == nil && namedValue.Properties.KeyVault == nil {
+			log.Warn().Msg("value of secret named value " + id + " is not in snapshot, skipped")
+			result.Skipped = append(result.Skipped, EntityNamedValue+"/"+id)
+			continue
+		}
+		if err := a.restoreNamedValue(resourceGroup, serviceName, namedValue); err != nil {
+			return result, err
+		}
+		result.Restored = append(result.Restored, EntityNamedValue+"/"+id)
+	}
+
+	versionSets := map[string]*armapimanagement.APIVersionSetContract{}
+	restoredVersionSets := map[string]bool{}
+	restoreVersionSet := func(versionSet *armapimanagement.APIVersionSetContract) error {
+		id := safePointerString(versionSet.Name)
+		if err := a.restoreVersionSet(resourceGroup, serviceName, versionSet); err != nil {
+			return err
+		}
+		restoredVersionSets[strings.ToLower(id)] = true
+		result.Restored = append(result.Restored, EntityVersionSet+"/"+id)
+		return nil
+	}
+	for _, versionSet := range snapshot.VersionSets {
+		id := safePointerString(versionSet.Name)
+		versionSets[strings.ToLower(id)] = versionSet
+		if !match(EntityVersionSet, id) {
+			continue
+		}
+		if err := restoreVersionSet(versionSet); err != nil {
+			return result, err
+		}
+	}
+
+	for _, backend := range snapshot.Backends {
+		id := safePointerString(backend.Name)
+		if !match(EntityBackend, id) {
+			continue
+		}
+		if err := a.restoreBackend(resourceGroup, serviceName, backend); err != nil {
+			return result, err
+		}
+		result.Restored = append(result.Restored, EntityBackend+"/"+id)
+	}
+
+	for _, api := range snapshot.APIs {
+		id := safePointerString(api.API.Name)
+		if !match(EntityAPI, id) {
+			continue
+		}
+		if versionSetID := apiVersionSetID(api.API); versionSetID != "" && !restoredVersionSets[strings.ToLower(versionSetID)] {
+			if versionSet, ok := versionSets[strings.ToLower(versionSetID)]; ok {
+				if err := restoreVersionSet(versionSet); err != nil {
+					return result, err
+				}
+			} else if err := a.checkVersionSet(resourceGroup, serviceName, versionSetID); err != nil {
+				return result, NewError(ErrNotFound, "version set "+versionSetID+" of API "+id+" is not in the snapshot nor on "+serviceName, err)
+			}
+		}
+		deleted, err := a.restoreAPI(resourceGroup, serviceName, api)
+		for _, operationID := range deleted {
+			result.Deleted = append(result.Deleted, EntityAPI+"/"+id+"/operation/"+operationID)
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Restored = append(result.Restored, EntityAPI+"/"+id)
+	}
+	return result, nil
+}
+
+// ID of the version set of an API, the last segment of apiVersionSetId
+func apiVersionSetID(api *armapimanagement.APIContract) string {
+	if api == nil || api.Properties == nil || api.Properties.APIVersionSetID == nil {
+		return ""
+	}
+	id := strings.TrimRight(*api.Properties.APIVersionSetID, "/")
+	return id[strings.LastIndex(id, "/")+1:]
+}
+
+// Resource ID of a version set of the service
+func (a APIM) versionSetResourceID(resourceGroup, serviceName, versionSetID string) string {
+	return "/subscriptions/" + a.SubscriptionID + "/resourceGroups/" + resourceGroup +
+		"/providers/Microsoft.ApiManagement/service/" + serviceName + "/apiVersionSets/" + versionSetID
+}
+
+// Entities of snapshot as {kind}/{id} in the order of restore
+func (s Snapshot) Entities() []string {
+	entities := []string{}
+	for _, namedValue := range s.NamedValues {
+		entities = append(entities, EntityNamedValue+"/"+safePointerString(namedValue.Name))
+	}
+	for _, versionSet := range s.VersionSets {
+		entities = append(entities, EntityVersionSet+"/"+safePointerString(versionSet.Name))
+	}
+	for _, backend := range s.Backends {
+		entities = append(entities, EntityBackend+"/"+safePointerString(backend.Name))
+	}
+	for _, api := range s.APIs {
+		entities = append(entities, EntityAPI+"/"+safePointerString(api.API.Name))
+	}
+	return entities
+}
+
+// Match of entities by selectors, a selector is a kind in plural for all entities of the kind
+// (backends, apis, namedvalues, versionsets) or {kind}/{id} for one entity. No selector matches all entities
+func MatchEntities(selectors []string) (func(kind, id string) bool, error) {
+	kinds := map[string]bool{}
+	ids := map[string]bool{}
+	for _, selector := range selectors {
+		selector = strings.ToLower(selector)
+		switch selector {
+		case EntityBackend + "s", EntityAPI + "s", EntityNamedValue + "s", EntityVersionSet + "s":
+			kinds[strings.TrimSuffix(selector, "s")] = true
+			continue
+		}
+		kind, id, ok := strings.Cut(selector, "/")
+		if !ok || id == "" || (kind != EntityBackend && kind != EntityAPI && kind != EntityNamedValue && kind != EntityVersionSet) {
+			return nil, fmt.Errorf("invalid entity %s, expected backends, apis, namedvalues, versionsets or {backend|api|namedvalue|versionset}/{id}", selector)
+		}
+		ids[kind+"/"+id] = true
+	}
+
+	return func(kind, id string) bool {
+		if len(selectors) == 0 || kinds[kind] {
+			return true
+		}
+		return ids[kind+"/"+strings.ToLower(id)]
+	}, nil
+}
+
+func (a APIM) restoreBackend(resourceGroup, serviceName string, backend *armapimanagement.BackendContract) error {
+	client, err := armapimanagement.NewBackendClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return classify(err)
+	}
+	defer a.invalidateBackendCache(resourceGroup, serviceName)
+	_, err = client.CreateOrUpdate(a.Context, resourceGroup, serviceName, safePointerString(backend.Name),
+		armapimanagement.BackendContract{Properties: backend.Properties}, &armapimanagement.BackendClientCreateOrUpdateOptions{})
+	return classify(err)
+}
+
+func (a APIM) restoreNamedValue(resourceGroup, serviceName string, namedValue *armapimanagement.NamedValueContract) error {
+	client, err := armapimanagement.NewNamedValueClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return classify(err)
+	}
+
+	properties := &armapimanagement.NamedValueCreateContractProperties{}
+	if p := namedValue.Properties; p != nil {
+		properties.DisplayName = p.DisplayName
+		properties.Secret = p.Secret
+		properties.Tags = p.Tags
+		properties.Value = p.Value
+		if p.KeyVault != nil {
+			properties.KeyVault = &armapimanagement.KeyVaultContractCreateProperties{
+				IdentityClientID: p.KeyVault.IdentityClientID,
+				SecretIdentifier: p.KeyVault.SecretIdentifier,
+			}
+		}
+	}
+
+	poller, err := client.BeginCreateOrUpdate(a.Context, resourceGroup, serviceName, safePointerString(namedValue.Name),
+		armapimanagement.NamedValueCreateContract{Properties: properties}, &armapimanagement.NamedValueClientBeginCreateOrUpdateOptions{})
+	if err != nil {
+		return classify(err)
+	}
+	_, err = poller.PollUntilDone(a.Context, nil)
+	return classify(err)
+}
+
+func (a APIM) restoreVersionSet(resourceGroup, serviceName string, versionSet *armapimanagement.APIVersionSetContract) error {
+	client, err := armapimanagement.NewAPIVersionSetClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return classify(err)
+	}
+	_, err = client.CreateOrUpdate(a.Context, resourceGroup, serviceName, safePointerString(versionSet.Name),
+		armapimanagement.APIVersionSetContract{Properties: versionSet.Properties}, &armapimanagement.APIVersionSetClientCreateOrUpdateOptions{})
+	return classify(err)
+}
+
+// ErrNotFound if the version set is not on the service
+func (a APIM) checkVersionSet(resourceGroup, serviceName, versionSetID string) error {
+	client, err := armapimanagement.NewAPIVersionSetClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return classify(err)
+	}
+	_, err = client.Get(a.Context, resourceGroup, serviceName, versionSetID, &armapimanagement.APIVersionSetClientGetOptions{})
+	return classify(err)
+}
+
+// Restore API with its policy and operations, operations on the service which are not in the snapshot are deleted.
+// Returns the IDs of deleted operations
+func (a APIM) restoreAPI(resourceGroup, serviceName string, api SnapshotAPI) ([]string, error) {
+	apiID := safePointerString(api.API.Name)
+	deleted := []string{}
+
+	// properties of API contract are a subset of create properties
+	properties := &armapimanagement.APICreateOrUpdateProperties{}
+	if api.API.Properties != nil {
+		data, err := json.Marshal(api.API.Properties)
+		if err != nil {
+			return deleted, err
+		}
+		if err := json.Unmarshal(data, properties); err != nil {
+			return deleted, err
+		}
+	}
+	// the version set is of the service restored to, the snapshot may be of another service
+	if versionSetID := apiVersionSetID(api.API); versionSetID != "" {
+		properties.APIVersionSetID = to.Ptr(a.versionSetResourceID(resourceGroup, serviceName, versionSetID))
+	}
+
+	client, err := armapimanagement.NewAPIClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return deleted, classify(err)
+	}
+	poller, err := client.BeginCreateOrUpdate(a.Context, resourceGroup, serviceName, apiID,
+		armapimanagement.APICreateOrUpdateParameter{Properties: properties}, &armapimanagement.APIClientBeginCreateOrUpdateOptions{})
+	if err != nil {
+		return deleted, classify(err)
+	}
+	if _, err := poller.PollUntilDone(a.Context, nil); err != nil {
+		return deleted, classify(err)
+	}
+
+	if api.Policy != "" {
+		policyClient, err := armapimanagement.NewAPIPolicyClient(a.SubscriptionID, a.Credential, a.clientOptions())
+		if err != nil {
+			return deleted, classify(err)
+		}
+		if _, err := policyClient.CreateOrUpdate(a.Context, resourceGroup, serviceName, apiID, armapimanagement.PolicyIDNamePolicy,
+			policyContract(api.Policy), &armapimanagement.APIPolicyClientCreateOrUpdateOptions{}); err != nil {
+			return deleted, classify(err)
+		}
+	}
+
+	operationClient, err := armapimanagement.NewAPIOperationClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return deleted, classify(err)
+	}
+	operationPolicyClient, err := armapimanagement.NewAPIOperationPolicyClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return deleted, classify(err)
+	}
+	snapshotOperations := map[string]bool{}
+	for _, operation := range api.Operations {
+		operationID := safePointerString(operation.Operation.Name)
+		snapshotOperations[strings.ToLower(operationID)] = true
+		if _, err := operationClient.CreateOrUpdate(a.Context, resourceGroup, serviceName, apiID, operationID,
+			armapimanagement.OperationContract{Properties: operation.Operation.Properties}, &armapimanagement.APIOperationClientCreateOrUpdateOptions{}); err != nil {
+			return deleted, classify(err)
+		}
+		if operation.Policy == "" {
+			continue
+		}
+		if _, err := operationPolicyClient.CreateOrUpdate(a.Context, resourceGroup, serviceName, apiID, operationID, armapimanagement.PolicyIDNamePolicy,
+			policyContract(operation.Policy), &armapimanagement.APIOperationPolicyClientCreateOrUpdateOptions{}); err != nil {
+			return deleted, classify(err)
+		}
+	}
+
+	// operations added after the snapshot are deleted to give the API of the snapshot
+	operations, err := a.listOperationContracts(resourceGroup, serviceName, apiID)
+	if err != nil {
+		return deleted, err
+	}
+	for _, operation := range operations {
+		operationID := safePointerString(operation.Name)
+		if snapshotOperations[strings.ToLower(operationID)] {
+			continue
+		}
+		if _, err := operationClient.Delete(a.Context, resourceGroup, serviceName, apiID, operationID, "*",
+			&armapimanagement.APIOperationClientDeleteOptions{}); err != nil {
+			return deleted, classify(err)
+		}
+		deleted = append(deleted, operationID)
+	}
+	return deleted, nil
+}
+
+// policy of xml format, the format of policies listed from APIM
+func policyContract(policy string) armapimanagement.PolicyContract {
+	return armapimanagement.PolicyContract{
+		Properties: &armapimanagement.PolicyContractProperties{
+			Value:  to.Ptr(policy),
+			Format: to.Ptr(armapimanagement.PolicyContentFormatXML),
+		},
+	}
+}
+
+func (a APIM) listBackendContracts(resourceGroup, serviceName string) ([]*armapimanagement.BackendContract, error) {
+	client, err := armapimanagement.NewBackendClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return nil, classify(err)
+	}
+	contracts := []*armapimanagement.BackendContract{}
+	pager := client.NewListByServicePager(resourceGroup, serviceName, &armapimanagement.BackendClientListByServiceOptions{})
+	for pager.More() {
+		page, err := pager.NextPage(a.Context)
+		if err != nil {
+			return nil, classify(err)
+		}
+		contracts = append(contracts, page.Value...)
+	}
+	return contracts, nil
+}
+
+func (a APIM) listAPIContracts(resourceGroup, serviceName string) ([]*armapimanagement.APIContract, error) {
+	client, err := armapimanagement.NewAPIClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return nil, classify(err)
+	}
+	contracts := []*armapimanagement.APIContract{}
+	pager := client.NewListByServicePager(resourceGroup, serviceName, &armapimanagement.APIClientListByServiceOptions{})
+	for pager.More() {
+		page, err := pager.NextPage(a.Context)
+		if err != nil {
+			return nil, classify(err)
+		}
+		contracts = append(contracts, page.Value...)
+	}
+	return contracts, nil
+}
+
+func (a APIM) listOperationContracts(resourceGroup, serviceName, apiID string) ([]*armapimanagement.OperationContract, error) {
+	client, err := armapimanagement.NewAPIOperationClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return nil, classify(err)
+	}
+	contracts := []*armapimanagement.OperationContract{}
+	pager := client.NewListByAPIPager(resourceGroup, serviceName, apiID, &armapimanagement.APIOperationClientListByAPIOptions{})
+	for pager.More() {
+		page, err := pager.NextPage(a.Context)
+		if err != nil {
+			return nil, classify(err)
+		}
+		contracts = append(contracts, page.Value...)
+	}
+	return contracts, nil
+}
+
+func (a APIM) listVersionSetContracts(resourceGroup, serviceName string) ([]*armapimanagement.APIVersionSetContract, error) {
+	client, err := armapimanagement.NewAPIVersionSetClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return nil, classify(err)
+	}
+	contracts := []*armapimanagement.APIVersionSetContract{}
+	pager := client.NewListByServicePager(resourceGroup, serviceName, &armapimanagement.APIVersionSetClientListByServiceOptions{})
+	for pager.More() {
+		page, err := pager.NextPage(a.Context)
+		if err != nil {
+			return nil, classify(err)
+		}
+		contracts = append(contracts, page.Value...)
+	}
+	return contracts, nil
+}
+
+func (a APIM) listNamedValueContracts(resourceGroup, serviceName string, includeSecrets bool) ([]*armapimanagement.NamedValueContract, error) {
+	client, err := armapimanagement.NewNamedValueClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return nil, classify(err)
+	}
+	contracts := []*armapimanagement.NamedValueContract{}
+	pager := client.NewListByServicePager(resourceGroup, serviceName, &armapimanagement.NamedValueClientListByServiceOptions{})
+	for pager.More() {
+		page, err := pager.NextPage(a.Context)
+		if err != nil {
+			return nil, classify(err)
+		}
+		contracts = append(contracts, page.Value...)
+	}
+
+	if !includeSecrets {
+		return contracts, nil
+	}
+	for _, contract := range contracts {
+		p := contract.Properties
+		if p == nil || p.Secret == nil || !*p.Secret || p.KeyVault != nil {
+			continue
+		}
+		secret, err := client.ListValue(a.Context, resourceGroup, serviceName, safePointerString(contract.Name), &armapimanagement.NamedValueClientListValueOptions{})
+		if err != nil {
+			return nil, classify(err)
+		}
+		p.Value = secret.Value
+	}
+	return contracts, nil
+}
+
+// Files of a snapshot, manifest.json, backends.json, namedvalues.json, versionsets.json and apis/{apiID}.json
+func (s Snapshot) files() (map[string][]byte, error) {
+	files := map[string][]byte{}
+	add := func(name string, v interface{}) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		files[name] = append(data, '\n')
+		return nil
+	}
+
+	manifest := snapshotManifest{
+		Version:        s.Version,
+		CreatedAt:      s.CreatedAt,
+		SubscriptionID: s.SubscriptionID,
+		ResourceGroup:  s.ResourceGroup,
+		ServiceName:    s.ServiceName,
+		APIs:           []string{},
+	}
+	for _, api := range s.APIs {
+		id := safePointerString(api.API.Name)
+		manifest.APIs = append(manifest.APIs, id)
+		if err := add("apis/"+id+".json", api); err != nil {
+			return nil, err
+		}
+	}
+	if err := add("manifest.json", manifest); err != nil {
+		return nil, err
+	}
+	if err := add("backends.json", s.Backends); err != nil {
+		return nil, err
+	}
+	if err := add("namedvalues.json", s.NamedValues); err != nil {
+		return nil, err
+	}
+	if err := add("versionsets.json", s.VersionSets); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+type snapshotManifest struct {
+	Version        int       `json:"version"`
+	CreatedAt      time.Time `json:"createdAt"`
+	SubscriptionID string    `json:"subscriptionId"`
+	ResourceGroup  string    `json:"resourceGroup"`
+	ServiceName    string    `json:"serviceName"`
+	APIs           []string  `json:"apis"`
+}
+
+// Default path of snapshot, {service}-{timestamp} in dir
+func SnapshotPath(dir, serviceName string, createdAt time.Time) string {
+	return filepath.Join(dir, serviceName+"-"+createdAt.Format("20060102T150405Z"))
+}
+
+// Write snapshot to directory path, or to gzipped tar archive path.tar.gz when archive. Return the path written
+func WriteSnapshot(snapshot Snapshot, path string, archive bool) (string, error) {
+	files, err := snapshot.files()
+	if err != nil {
+		return "", err
+	}
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if !archive {
+		for _, name := range names {
+			file := filepath.Join(path, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				return "", err
+			}
+			if err := os.WriteFile(file, files[name], 0600); err != nil {
+				return "", err
+			}
+		}
+		return path, nil
+	}
+
+	if !strings.HasSuffix(path, ".tar.gz") {
+		path += ".tar.gz"
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(files[name])), ModTime: snapshot.CreatedAt}
+		if err := tw.WriteHeader(header); err != nil {
+			return "", err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return "", err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// Read snapshot from directory or gzipped tar archive written by WriteSnapshot
+func ReadSnapshot(path string) (Snapshot, error) {
+	snapshot := Snapshot{}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return snapshot, NewError(ErrNotFound, "snapshot "+path+" not found", err)
+	}
+
+	files := map[string][]byte{}
+	if info.IsDir() {
+		err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			name, err := filepath.Rel(path, file)
+			if err != nil {
+				return err
+			}
+			files[filepath.ToSlash(name)], err = os.ReadFile(file)
+			return err
+		})
+	} else {
+		files, err = readSnapshotArchive(path)
+	}
+	if err != nil {
+		return snapshot, err
+	}
+
+	manifest := snapshotManifest{}
+	if err := unmarshalSnapshotFile(files, "manifest.json", &manifest); err != nil {
+		return snapshot, err
+	}
+	snapshot.Version = manifest.Version
+	snapshot.CreatedAt = manifest.CreatedAt
+	snapshot.SubscriptionID = manifest.SubscriptionID
+	snapshot.ResourceGroup = manifest.ResourceGroup
+	snapshot.ServiceName = manifest.ServiceName
+
+	if err := unmarshalSnapshotFile(files, "backends.json", &snapshot.Backends); err != nil {
+		return snapshot, err
+	}
+	if err := unmarshalSnapshotFile(files, "namedvalues.json", &snapshot.NamedValues); err != nil {
+		return snapshot, err
+	}
+	// snapshots of version 1 have no version sets
+	if snapshot.Version >= 2 {
+		if err := unmarshalSnapshotFile(files, "versionsets.json", &snapshot.VersionSets); err != nil {
+			return snapshot, err
+		}
+	}
+	for _, id := range manifest.APIs {
+		api := SnapshotAPI{}
+		if err := unmarshalSnapshotFile(files, "apis/"+id+".json", &api); err != nil {
+			return snapshot, err
+		}
+		snapshot.APIs = append(snapshot.APIs, api)
+	}
+	return snapshot, nil
+}
+
+func readSnapshotArchive(path string) (map[string][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if files[strings.TrimPrefix(header.Name, "./")], err = io.ReadAll(tr); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func unmarshalSnapshotFile(files map[string][]byte, name string, v interface{}) error {
+	data, ok := files[name]
+	if !ok {
+		return NewError(ErrNotFound, name+" not found in snapshot", nil)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s of snapshot: %w", name, err)
+	}
+	return nil
+}
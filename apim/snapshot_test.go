@@ -0,0 +1,228 @@
+package apim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/apimanagement/armapimanagement"
+)
+
+func testSnapshot() Snapshot {
+	return Snapshot{
+		Version:        SnapshotVersion,
+		CreatedAt:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		SubscriptionID: "sub",
+		ResourceGroup:  "rg-old",
+		ServiceName:    "svc-old",
+		Backends:       []*armapimanagement.BackendContract{{Name: to.Ptr("be1"), Properties: &armapimanagement.BackendContractProperties{URL: to.Ptr("https://a.com")}}},
+		NamedValues:    []*armapimanagement.NamedValueContract{},
+		VersionSets: []*armapimanagement.APIVersionSetContract{{Name: to.Ptr("vs1"),
+			Properties: &armapimanagement.APIVersionSetContractProperties{DisplayName: to.Ptr("echo"), VersioningScheme: to.Ptr(armapimanagement.VersioningSchemeSegment)}}},
+		APIs: []SnapshotAPI{{
+			API: &armapimanagement.APIContract{Name: to.Ptr("echo"), Properties: &armapimanagement.APIContractProperties{
+				Path: to.Ptr("echo"), APIVersionSetID: to.Ptr("/subscriptions/sub/resourceGroups/rg-old/providers/Microsoft.ApiManagement/service/svc-old/apiVersionSets/vs1")}},
+			Operations: []SnapshotOperation{{Operation: &armapimanagement.OperationContract{Name: to.Ptr("get"),
+				Properties: &armapimanagement.OperationContractProperties{Method: to.Ptr("GET"), URLTemplate: to.Ptr("/"), DisplayName: to.Ptr("get")}}}},
+		}},
+	}
+}
+
+func TestSnapshotWriteRead(t *testing.T) {
+	snapshot := testSnapshot()
+	for _, archive := range []bool{false, true} {
+		path, err := WriteSnapshot(snapshot, filepath.Join(t.TempDir(), "snapshot"), archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		read, err := ReadSnapshot(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(read.Entities(), snapshot.Entities()) {
+			t.Errorf("entities of read snapshot (archive %v) = %v, want %v", archive, read.Entities(), snapshot.Entities())
+		}
+		if got := safePointerString(read.VersionSets[0].Properties.DisplayName); got != "echo" {
+			t.Errorf("version set of read snapshot = %s", got)
+		}
+	}
+
+	want := []string{"versionset/vs1", "backend/be1", "api/echo"}
+	if got := snapshot.Entities(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Entities = %v, want %v", got, want)
+	}
+}
+
+// Snapshots of version 1 have no versionsets.json
+func TestReadSnapshotVersion1(t *testing.T) {
+	snapshot := testSnapshot()
+	path, err := WriteSnapshot(snapshot, filepath.Join(t.TempDir(), "snapshot"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := filepath.Join(path, "manifest.json")
+	data, err := os.ReadFile(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(manifest, []byte(strings.Replace(string(data), `"version": 2`, `"version": 1`, 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(path, "versionsets.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Version != 1 || len(read.VersionSets) != 0 || len(read.APIs) != 1 {
+		t.Errorf("snapshot of version 1 = version %d, %d version sets, %d APIs", read.Version, len(read.VersionSets), len(read.APIs))
+	}
+}
+
+func TestMatchEntities(t *testing.T) {
+	match, err := MatchEntities([]string{"versionsets", "api/Echo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for entity, want := range map[string]bool{"versionset/vs1": true, "api/echo": true, "api/other": false, "backend/be1": false} {
+		kind, id, _ := strings.Cut(entity, "/")
+		if got := match(kind, id); got != want {
+			t.Errorf("match(%s) = %v, want %v", entity, got, want)
+		}
+	}
+	if _, err := MatchEntities([]string{"products"}); err == nil {
+		t.Error("MatchEntities(products): expected error")
+	}
+}
+
+type staticCredential struct{}
+
+func (staticCredential) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// Stand-in ARM of service svc on resource group rg, operations of API echo are get and extra, version sets of
+// versionSets exist. Requests are recorded as {method} {path below the service}
+type restoreServer struct {
+	mu          sync.Mutex
+	requests    []string
+	bodies      map[string]map[string]interface{}
+	versionSets map[string]bool
+}
+
+func (s *restoreServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const service = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ApiManagement/service/svc"
+	path := strings.TrimPrefix(r.URL.Path, service)
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+path)
+	body := map[string]interface{}{}
+	if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+		_ = json.Unmarshal(data, &body)
+		s.bodies[r.Method+" "+path] = body
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodGet && path == "/apis/echo/operations":
+		_, _ = w.Write([]byte(`{"value": [{"name": "get"}, {"name": "extra"}]}`))
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/apiVersionSets/"):
+		if !s.versionSets[strings.TrimPrefix(path, "/apiVersionSets/")] {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error": {"code": "ResourceNotFound", "message": "not found"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"name": "vs1"}`))
+	case r.Method == http.MethodPut || r.Method == http.MethodDelete:
+		_, _ = w.Write([]byte(`{}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error": {"code": "ResourceNotFound", "message": "not found"}}`))
+	}
+}
+
+func testAPIM(t *testing.T, handler http.Handler) APIM {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return APIM{
+		SubscriptionID: "sub",
+		Credential:     staticCredential{},
+		Context:        context.Background(),
+		Cloud: cloud.Configuration{
+			ActiveDirectoryAuthorityHost: server.URL,
+			Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+				cloud.ResourceManager: {Audience: "https://management.core.windows.net/", Endpoint: server.URL},
+			},
+		},
+	}
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	server := &restoreServer{bodies: map[string]map[string]interface{}{}}
+	a := testAPIM(t, server)
+	match, err := MatchEntities([]string{"api/echo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := a.RestoreSnapshot("rg", "svc", testSnapshot(), match)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"versionset/vs1", "api/echo"}; !reflect.DeepEqual(result.Restored, want) {
+		t.Errorf("restored = %v, want %v", result.Restored, want)
+	}
+	if want := []string{"api/echo/operation/extra"}; !reflect.DeepEqual(result.Deleted, want) {
+		t.Errorf("deleted = %v, want %v", result.Deleted, want)
+	}
+
+	want := []string{"PUT /apiVersionSets/vs1", "PUT /apis/echo", "PUT /apis/echo/operations/get", "GET /apis/echo/operations", "DELETE /apis/echo/operations/extra"}
+	if !reflect.DeepEqual(server.requests, want) {
+		t.Errorf("requests = %v, want %v", server.requests, want)
+	}
+	properties, _ := server.bodies["PUT /apis/echo"]["properties"].(map[string]interface{})
+	if got := properties["apiVersionSetId"]; got != "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ApiManagement/service/svc/apiVersionSets/vs1" {
+		t.Errorf("apiVersionSetId of restored API = %v, want the version set of svc", got)
+	}
+}
+
+func TestRestoreSnapshotMissingVersionSet(t *testing.T) {
+	snapshot := testSnapshot()
+	snapshot.VersionSets = nil
+
+	// the version set is on the service
+	server := &restoreServer{bodies: map[string]map[string]interface{}{}, versionSets: map[string]bool{"vs1": true}}
+	if _, err := testAPIM(t, server).RestoreSnapshot("rg", "svc", snapshot, nil); err != nil {
+		t.Errorf("restore of API of a version set on the service: %v", err)
+	}
+
+	server = &restoreServer{bodies: map[string]map[string]interface{}{}}
+	result, err := testAPIM(t, server).RestoreSnapshot("rg", "svc", snapshot, nil)
+	if !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "version set vs1 of API echo") {
+		t.Errorf("error = %v, want ErrNotFound of version set vs1", err)
+	}
+	if want := []string{"backend/be1"}; !reflect.DeepEqual(result.Restored, want) {
+		t.Errorf("restored = %v, want %v", result.Restored, want)
+	}
+	for _, request := range server.requests {
+		if strings.HasPrefix(request, "PUT /apis/") {
+			t.Errorf("API is restored without its version set: %s", request)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package apim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/apimanagement/armapimanagement"
+)
+
+// API version of resources and deployment template schema of generated templates when not configured
+const (
+	DefaultTemplateAPIVersion = "2021-01-01-preview"
+	DefaultTemplateSchema     = "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#"
+)
+
+// API versions of Microsoft.ApiManagement supported by generated templates, oldest first
+var TemplateAPIVersions = []string{
+	"2019-12-01", "2020-06-01-preview", "2020-12-01", "2021-01-01-preview", "2021-04-01-preview",
+	"2021-08-01", "2021-12-01-preview", "2022-04-01-preview", "2022-08-01", "2023-03-01-preview", "2023-05-01-preview",
+}
+
+// Schemas of deployment template supported by generated templates
+var TemplateSchemas = []string{
+	"https://schema.management.azure.com/schemas/2015-01-01/deploymentTemplate.json#",
+	DefaultTemplateSchema,
+}
+
+// First API version supporting a property of a kind of resource, properties not listed are supported by every version.
+// Properties of operations generated (displayName, description, method, urlTemplate, templateParameters) and of backends
+// generated (url, protocol, credentials, tls) are supported by every version of TemplateAPIVersions
+var templatePropertySince = map[string]map[string]string{
+	"apis":            {"contact": "2021-04-01-preview", "license": "2021-04-01-preview", "termsOfServiceUrl": "2021-04-01-preview"},
+	"apis/operations": {},
+	"backends":        {"circuitBreaker": "2023-03-01-preview", "pool": "2023-05-01-preview", "type": "2023-05-01-preview"},
+}
+
+// API version and schema of generated templates, defaults are used for empty fields
+type TemplateOptions struct {
+	APIVersion string
+	Schema     string
+}
+
+// Options with defaults for empty fields
+func (o TemplateOptions) WithDefaults() TemplateOptions {
+	if o.APIVersion == "" {
+		o.APIVersion = DefaultTemplateAPIVersion
+	}
+	if o.Schema == "" {
+		o.Schema = DefaultTemplateSchema
+	}
+	return o
+}
+
+// Error if the API version or schema is not supported
+func (o TemplateOptions) Validate() error {
+	o = o.WithDefaults()
+	if !containsString(TemplateAPIVersions, o.APIVersion) {
+		return fmt.Errorf("API version %s is not supported, expected one of %s", o.APIVersion, strings.Join(TemplateAPIVersions, ", "))
+	}
+	if !containsString(TemplateSchemas, o.Schema) {
+		return fmt.Errorf("schema %s is not supported, expected one of %s", o.Schema, strings.Join(TemplateSchemas, ", "))
+	}
+	return nil
+}
+
+// Properties supported by the API version of the options
+func (o TemplateOptions) supported(kind string, properties map[string]interface{}) map[string]interface{} {
+	for _, key := range o.Unsupported(kind, properties) {
+		delete(properties, key)
+	}
+	return properties
+}
+
+// Properties of a kind of resource, e.g. backends or apis/operations, not supported by the API version of the options, sorted
+func (o TemplateOptions) Unsupported(kind string, properties map[string]interface{}) []string {
+	apiVersion := o.WithDefaults().APIVersion
+	unsupported := []string{}
+	for key, since := range templatePropertySince[kind] {
+		if _, ok := properties[key]; ok && CompareAPIVersions(apiVersion, since) < 0 {
+			unsupported = append(unsupported, key)
+		}
+	}
+	sort.Strings(unsupported)
+	return unsupported
+}
+
+// Order of API versions {yyyy-mm-dd}[-preview], a preview is before the stable version of the same date
+func CompareAPIVersions(a, b string) int {
+	dateA, dateB := a, b
+	if len(dateA) > 10 {
+		dateA = dateA[:10]
+	}
+	if len(dateB) > 10 {
+		dateB = dateB[:10]
+	}
+	switch {
+	case dateA < dateB:
+		return -1
+	case dateA > dateB:
+		return 1
+	}
+	previewA, previewB := strings.HasSuffix(a, "-preview"), strings.HasSuffix(b, "-preview")
+	switch {
+	case previewA && !previewB:
+		return -1
+	case !previewA && previewB:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Formats of generated templates
+const (
+	TemplateFormatARM   = "arm"
+	TemplateFormatBicep = "bicep"
+)
+
+// Properties of API and operation kept in generated templates, the others are read-only or defaulted by APIM
+var (
+	apiTemplateProperties = []string{"displayName", "description", "path", "protocols", "serviceUrl", "subscriptionRequired", "subscriptionKeyParameterNames",
+		"apiVersion", "apiVersionDescription", "type", "contact", "license", "termsOfServiceUrl"}
+	operationTemplateProperties = []string{"displayName", "description", "method", "urlTemplate", "templateParameters"}
+)
+
+// Get API with its policy, operations and operation policies, ErrNotFound if the API does not exist
+func (a APIM) ExportAPI(resourceGroup, serviceName, apiID string) (SnapshotAPI, error) {
+	client, err := armapimanagement.NewAPIClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return SnapshotAPI{}, classify(err)
+	}
+	result, err := client.Get(a.Context, resourceGroup, serviceName, apiID, &armapimanagement.APIClientGetOptions{})
+	if err != nil {
+		return SnapshotAPI{}, classify(err)
+	}
+	return a.snapshotAPI(resourceGroup, serviceName, &result.APIContract)
+}
+
+// Path of template of API in directory dir, {api-id}.template.json or {api-id}.bicep
+func APITemplatePath(dir, apiID, format string) string {
+	if format == TemplateFormatBicep {
+		return filepath.Join(dir, apiID+".bicep")
+	}
+	return filepath.Join(dir, apiID+".template.json")
+}
+
+// Template properties of contract properties, only the keys given and not empty
+func templateProperties(properties interface{}, keys []string) map[string]interface{} {
+	all := map[string]interface{}{}
+	if data, err := json.Marshal(properties); err == nil {
+		_ = json.Unmarshal(data, &all)
+	}
+	kept := map[string]interface{}{}
+	for _, key := range keys {
+		switch value := all[key].(type) {
+		case nil:
+		case string:
+			if value != "" {
+				kept[key] = value
+			}
+		case []interface{}:
+			if len(value) > 0 {
+				kept[key] = value
+			}
+		default:
+			kept[key] = value
+		}
+	}
+	return kept
+}
+
+func policyTemplateProperties(policy string) map[string]interface{} {
+	return map[string]interface{}{"format": string(armapimanagement.PolicyContentFormatXML), "value": policy}
+}
+
+// ARM template of API with its policy, operations and operation policies
+func (o TemplateOptions) APITemplate(api SnapshotAPI) ([]byte, error) {
+	o = o.WithDefaults()
+	apiID := safePointerString(api.API.Name)
+	name := func(segments string) string {
+		return "[concat(parameters('ApimServiceName'), '/" + segments + "')]"
+	}
+	resourceID := func(kind string, segments ...string) string {
+		id := "[resourceId('Microsoft.ApiManagement/service/" + kind + "', parameters('ApimServiceName')"
+		for _, segment := range segments {
+			id += ", '" + segment + "'"
+		}
+		return id + ")]"
+	}
+	resource := func(kind, segments string, properties map[string]interface{}, dependsOn ...string) map[string]interface{} {
+		r := map[string]interface{}{
+			"type":       "Microsoft.ApiManagement/service/" + kind,
+			"apiVersion": o.APIVersion,
+			"name":       name(segments),
+			"properties": properties,
+		}
+		if len(dependsOn) > 0 {
+			r["dependsOn"] = dependsOn
+		}
+		return r
+	}
+
+	apiResourceID := resourceID("apis", apiID)
+	resources := []interface{}{resource("apis", apiID, o.supported("apis", templateProperties(api.API.Properties, apiTemplateProperties)))}
+	if api.Policy != "" {
+		resources = append(resources, resource("apis/policies", apiID+"/policy", policyTemplateProperties(api.Policy), apiResourceID))
+	}
+	for _, operation := range api.Operations {
+		operationID := safePointerString(operation.Operation.Name)
+		resources = append(resources, resource("apis/operations", apiID+"/"+operationID,
+			o.supported("apis/operations", templateProperties(operation.Operation.Properties, operationTemplateProperties)), apiResourceID))
+		if operation.Policy != "" {
+			resources = append(resources, resource("apis/operations/policies", apiID+"/"+operationID+"/policy",
+				policyTemplateProperties(operation.Policy), resourceID("apis/operations", apiID, operationID)))
+		}
+	}
+
+	// policy XML is kept readable, not escaped as HTML
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent(" ", "\t")
+	err := encoder.Encode(map[string]interface{}{
+		"$schema":        o.Schema,
+		"contentVersion": "1.0.0.0",
+		"parameters":     map[string]interface{}{"ApimServiceName": map[string]interface{}{"type": "string"}},
+		"resources":      resources,
+	})
+	return b.Bytes(), err
+}
@@ -0,0 +1,73 @@
+package apim
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareAPIVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"2021-08-01", "2021-08-01", 0},
+		{"2021-01-01-preview", "2021-01-01-preview", 0},
+		{"2020-12-01", "2021-08-01", -1},
+		{"2022-08-01", "2021-08-01", 1},
+		{"2021-04-01-preview", "2021-04-01", -1},
+		{"2021-04-01", "2021-04-01-preview", 1},
+		{"2021-04-01-preview", "2021-01-01", 1},
+		{"2020-12-01", "2021-01-01-preview", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareAPIVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareAPIVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestTemplateAPIVersionsOrdered(t *testing.T) {
+	for i := 1; i < len(TemplateAPIVersions); i++ {
+		if CompareAPIVersions(TemplateAPIVersions[i-1], TemplateAPIVersions[i]) >= 0 {
+			t.Errorf("TemplateAPIVersions %s is not before %s", TemplateAPIVersions[i-1], TemplateAPIVersions[i])
+		}
+	}
+}
+
+func TestTemplateOptionsUnsupported(t *testing.T) {
+	api := map[string]interface{}{"displayName": "a", "contact": map[string]interface{}{}, "license": map[string]interface{}{}}
+	backend := map[string]interface{}{"url": "https://a.com", "protocol": "http", "circuitBreaker": map[string]interface{}{}}
+	tests := []struct {
+		apiVersion string
+		kind       string
+		properties map[string]interface{}
+		want       []string
+	}{
+		{"2021-01-01-preview", "apis", api, []string{"contact", "license"}},
+		{"2021-04-01-preview", "apis", api, []string{}},
+		{"2022-08-01", "backends", backend, []string{"circuitBreaker"}},
+		{"2023-03-01-preview", "backends", backend, []string{}},
+		{"2023-03-01-preview", "backends", map[string]interface{}{"url": "https://a.com", "type": "Pool", "pool": map[string]interface{}{}}, []string{"pool", "type"}},
+		{"2023-05-01-preview", "backends", map[string]interface{}{"type": "Pool", "pool": map[string]interface{}{}, "circuitBreaker": map[string]interface{}{}}, []string{}},
+		{"2019-12-01", "apis/operations", map[string]interface{}{"method": "GET", "urlTemplate": "/"}, []string{}},
+		{"", "apis", api, []string{"contact", "license"}},
+	}
+	for _, tt := range tests {
+		got := TemplateOptions{APIVersion: tt.apiVersion}.Unsupported(tt.kind, tt.properties)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Unsupported(%s, %s) = %v, want %v", tt.apiVersion, tt.kind, got, tt.want)
+		}
+	}
+}
+
+func TestTemplateOptionsValidate(t *testing.T) {
+	if err := (TemplateOptions{}).Validate(); err != nil {
+		t.Errorf("Validate of defaults: %v", err)
+	}
+	if err := (TemplateOptions{APIVersion: "2018-01-01"}).Validate(); err == nil {
+		t.Error("Validate of 2018-01-01: expected error")
+	}
+	if err := (TemplateOptions{Schema: "https://example.com/schema.json#"}).Validate(); err == nil {
+		t.Error("Validate of unknown schema: expected error")
+	}
+}
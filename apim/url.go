@@ -0,0 +1,104 @@
+package apim
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Modes of matching a backend URL against a URL. Exact compares the normalized URLs, prefix also matches a URL under
+// the path of the backend, e.g. backend https://a.com/api matches https://a.com/api/v1 but not https://a.com/apiv1
+const (
+	URLMatchExact  = "exact"
+	URLMatchPrefix = "prefix"
+)
+
+// Normalize URL for comparing backends: lower case scheme and host, IP addresses in canonical form, no trailing dot of
+// host, no default port, clean path without trailing slash. Query and fragment are removed
+func NormalizeURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return strings.TrimRight(strings.ToLower(strings.TrimSpace(rawURL)), "/")
+	}
+	return normalizedOrigin(u) + normalizedPath(u)
+}
+
+// Normalized scheme://host[:port] of URL, without path
+func URLOrigin(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("%s is not an absolute URL", rawURL)
+	}
+	return normalizedOrigin(u), nil
+}
+
+// Does the backend URL match the URL in the mode, an unknown mode is prefix
+func MatchURL(backendURL, rawURL, mode string) bool {
+	backend, err := url.Parse(strings.TrimSpace(backendURL))
+	if err != nil || backend.Host == "" {
+		return NormalizeURL(backendURL) == NormalizeURL(rawURL)
+	}
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" || normalizedOrigin(backend) != normalizedOrigin(u) {
+		return false
+	}
+
+	backendPath, p := normalizedPath(backend), normalizedPath(u)
+	if mode == URLMatchExact {
+		return backendPath == p
+	}
+	return backendPath == "" || p == backendPath || strings.HasPrefix(p, backendPath+"/")
+}
+
+// Indexes of backend URLs matching the URL in the mode. In prefix mode only the backends of the longest path are kept, the
+// most specific, e.g. https://a.com/api of https://a.com and https://a.com/api for https://a.com/api/v1
+func MostSpecificMatches(backendURLs []string, rawURL, mode string) []int {
+	matches := []int{}
+	longest := -1
+	for i, backendURL := range backendURLs {
+		if !MatchURL(backendURL, rawURL, mode) {
+			continue
+		}
+		length := len(NormalizeURL(backendURL))
+		if mode != URLMatchExact && length > longest {
+			matches, longest = []int{}, length
+		}
+		if mode == URLMatchExact || length == longest {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+func normalizedOrigin(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if ip := net.ParseIP(host); ip != nil {
+		host = ip.String()
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	port := u.Port()
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	return scheme + "://" + host
+}
+
+// Path is case sensitive, empty for the root
+func normalizedPath(u *url.URL) string {
+	p := u.EscapedPath()
+	if p == "" {
+		return ""
+	}
+	return strings.TrimRight(path.Clean("/"+p), "/")
+}
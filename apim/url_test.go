@@ -0,0 +1,101 @@
+package apim
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://a.com", "https://a.com"},
+		{"https://a.com/", "https://a.com"},
+		{"https://a.com/api/", "https://a.com/api"},
+		{"HTTPS://A.COM/Api", "https://a.com/Api"},
+		{"https://a.com:443/api", "https://a.com/api"},
+		{"http://a.com:80/api", "http://a.com/api"},
+		{"http://a.com:443/api", "http://a.com:443/api"},
+		{"https://a.com:8443", "https://a.com:8443"},
+		{"https://a.com./api", "https://a.com/api"},
+		{"https://a.com/api/./v1/../v2", "https://a.com/api/v2"},
+		{"https://a.com/api?x=1#top", "https://a.com/api"},
+		{"http://[2001:DB8:0::1]:8080/", "http://[2001:db8::1]:8080"},
+		{"  https://a.com/api  ", "https://a.com/api"},
+		{"not a url/", "not a url"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeURL(tt.url); got != tt.want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestMatchURL(t *testing.T) {
+	tests := []struct {
+		backend string
+		url     string
+		mode    string
+		want    bool
+	}{
+		{"https://a.com", "https://a.com", URLMatchExact, true},
+		{"https://a.com/", "https://a.com", URLMatchExact, true},
+		{"https://a.com/api", "https://a.com/api/", URLMatchExact, true},
+		{"https://a.com:443/api", "HTTPS://A.com/api", URLMatchExact, true},
+		{"https://a.com", "https://a.com/api", URLMatchExact, false},
+		{"https://a.com/api", "https://a.com/API", URLMatchExact, false},
+
+		{"https://a.com", "https://a.com/api/v1", URLMatchPrefix, true},
+		{"https://a.com/api", "https://a.com/api", URLMatchPrefix, true},
+		{"https://a.com/api/", "https://a.com/api/v1", URLMatchPrefix, true},
+		{"https://a.com/api", "https://a.com/apiv1", URLMatchPrefix, false},
+		{"https://a.com/api/v1", "https://a.com/api", URLMatchPrefix, false},
+		{"https://a.com", "https://a.com.evil", URLMatchPrefix, false},
+		{"https://a.com", "https://a.com.evil/api", URLMatchPrefix, false},
+		{"https://a.com", "https://a.com:8443/api", URLMatchPrefix, false},
+		{"https://a.com", "http://a.com/api", URLMatchPrefix, false},
+		{"https://a.com:443", "https://a.com/api", URLMatchPrefix, true},
+		{"https://a.com", "https://evil.com/https://a.com", URLMatchPrefix, false},
+		{"https://a.com/api", "https://a.com/api/v1", "", true},
+	}
+	for _, tt := range tests {
+		if got := MatchURL(tt.backend, tt.url, tt.mode); got != tt.want {
+			t.Errorf("MatchURL(%q, %q, %q) = %v, want %v", tt.backend, tt.url, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestMostSpecificMatches(t *testing.T) {
+	backends := []string{"https://a.com", "https://a.com/api", "https://b.com", "https://a.com/api/", "https://a.com/apiv1"}
+	tests := []struct {
+		url  string
+		mode string
+		want []int
+	}{
+		{"https://a.com/api/v1", URLMatchPrefix, []int{1, 3}},
+		{"https://a.com/other", URLMatchPrefix, []int{0}},
+		{"https://a.com/api", URLMatchExact, []int{1, 3}},
+		{"https://a.com/api/v1", URLMatchExact, []int{}},
+		{"https://c.com", URLMatchPrefix, []int{}},
+	}
+	for _, tt := range tests {
+		if got := MostSpecificMatches(backends, tt.url, tt.mode); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("MostSpecificMatches(%q, %q) = %v, want %v", tt.url, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestBackendIndexIDs(t *testing.T) {
+	index := NewBackendIndex("sub", "rg", "svc", []Backend{
+		{Name: "root", URL: "https://a.com"},
+		{Name: "api", URL: "https://a.com/api"},
+		{Name: "api-2", URL: "https://a.com:443/api/"},
+	})
+	if got, want := index.IDs("https://a.com/api/v1", URLMatchPrefix), []string{"api", "api-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IDs prefix = %v, want %v", got, want)
+	}
+	if got, want := index.IDs("https://a.com/", URLMatchExact), []string{"root"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IDs exact = %v, want %v", got, want)
+	}
+}
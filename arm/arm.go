@@ -3,57 +3,78 @@ package arm
 import (
 	"context"
 	"encoding/json"
-	"io/ioutil"
-	"log"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
+	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	azarm "github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 )
 
 type ARM struct {
 	SubscriptionID string
 	Location       string
-	Credential     *azidentity.DefaultAzureCredential
+	Credential     azcore.TokenCredential
+	Cloud          cloud.Configuration
 	Context        context.Context
 }
 
-func Env() struct {
+func Env() (struct {
 	SubscriptionID string
 	Location       string
-} {
-	subscriptionID := os.Getenv("APIMTOOL_AZURE_SUBSCRIPTION_ID")
-	subscriptionID = "24750e68-d6c2-40b7-90f9-f55b5009e909"
+}, error) {
+	env := struct {
+		SubscriptionID string
+		Location       string
+	}{}
 
-	if len(subscriptionID) == 0 {
-		log.Fatal("APIMTOOL_AZURE_SUBSCRIPTION_ID is not set.")
+	env.SubscriptionID = os.Getenv("APIMTOOL_AZURE_SUBSCRIPTION_ID")
+	if len(env.SubscriptionID) == 0 {
+		return env, errors.New("APIMTOOL_AZURE_SUBSCRIPTION_ID is not set")
 	}
-	location := os.Getenv("APIMTOOL_AZURE_LOCATION")
-	location = "southeastasia"
-	if len(location) == 0 {
-		log.Fatal("APIMTOOL_AZURE_LOCATION is not set.")
+
+	env.Location = os.Getenv("APIMTOOL_AZURE_LOCATION")
+	if len(env.Location) == 0 {
+		return env, errors.New("APIMTOOL_AZURE_LOCATION is not set")
 	}
 
-	return struct {
-		SubscriptionID string
-		Location       string
-	}{SubscriptionID: subscriptionID, Location: location}
+	return env, nil
 }
 
 func readJSON(path string) (map[string]interface{}, error) {
-	data, err := ioutil.ReadFile(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatalf("failed to read file: %v", err)
+		return nil, err
 	}
 	contents := make(map[string]interface{})
-	_ = json.Unmarshal(data, &contents)
+	if err := json.Unmarshal(data, &contents); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", path, err)
+	}
 	return contents, nil
 }
 
-func (arm ARM) GetTemplate(resourceGroupName, resourceGroupLocation, deploymentName, templateFile string) {
-	_, err := armresources.NewResourceGroupsClient(arm.SubscriptionID, arm.Credential, nil)
-	if err != nil {
-		log.Fatalf("failed to create client: %v", err)
+// retry with exponential backoff on throttling (429) and transient errors from ARM, same as the apim package
+func (a ARM) clientOptions() *azarm.ClientOptions {
+	return &azarm.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			Cloud: a.Cloud,
+			Retry: policy.RetryOptions{
+				MaxRetries:    6,
+				RetryDelay:    2 * time.Second,
+				MaxRetryDelay: 60 * time.Second,
+				StatusCodes: []int{
+					http.StatusRequestTimeout,
+					http.StatusTooManyRequests,
+					http.StatusInternalServerError,
+					http.StatusBadGateway,
+					http.StatusServiceUnavailable,
+					http.StatusGatewayTimeout,
+				},
+			},
+		},
 	}
-
 }
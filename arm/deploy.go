@@ -0,0 +1,189 @@
+package arm
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+)
+
+// Status of a resource of the deployment, Error is set when it failed
+type OperationStatus struct {
+	Deployment        string
+	ResourceType      string
+	ResourceName      string
+	ProvisioningState string
+	StatusCode        string
+	Error             *ErrorDetail
+}
+
+// Error of ARM with its details
+type ErrorDetail struct {
+	Code    string        `json:"code"`
+	Message string        `json:"message"`
+	Target  string        `json:"target,omitempty"`
+	Details []ErrorDetail `json:"details,omitempty"`
+}
+
+func (e ErrorDetail) String() string {
+	s := e.Code + ": " + e.Message
+	if e.Target != "" {
+		s += " (" + e.Target + ")"
+	}
+	for _, detail := range e.Details {
+		s += "; " + detail.String()
+	}
+	return s
+}
+
+// Failure of a deployment with the failed resources
+type DeploymentError struct {
+	Name     string
+	Failures []OperationStatus
+	Err      error
+}
+
+func (e *DeploymentError) Error() string {
+	messages := []string{}
+	for _, failure := range e.Failures {
+		if failure.Error != nil {
+			messages = append(messages, failure.ResourceType+" "+failure.ResourceName+": "+failure.Error.String())
+		}
+	}
+	if len(messages) == 0 && e.Err != nil {
+		messages = append(messages, e.Err.Error())
+	}
+	return "deployment " + e.Name + " failed: " + strings.Join(messages, ", ")
+}
+
+func (e *DeploymentError) Unwrap() error {
+	return e.Err
+}
+
+func errorDetail(e *armresources.ErrorResponse) *ErrorDetail {
+	if e == nil {
+		return nil
+	}
+	detail := &ErrorDetail{Code: safeString(e.Code), Message: safeString(e.Message), Target: safeString(e.Target)}
+	for _, d := range e.Details {
+		if d := errorDetail(d); d != nil {
+			detail.Details = append(detail.Details, *d)
+		}
+	}
+	return detail
+}
+
+func safeString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// interval of polling the deployment and its operations
+const pollInterval = 5 * time.Second
+
+// Submit the deployment to the resource group and wait until it is done. progress is called when
+// the provisioning state of a resource of the master or nested deployments changes.
+// DeploymentError has the failed resources with the error details of ARM
+func (a ARM) Deploy(resourceGroup string, deployment Deployment, progress func(OperationStatus)) error {
+	client, err := armresources.NewDeploymentsClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return err
+	}
+	operations, err := armresources.NewDeploymentOperationsClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return err
+	}
+
+	poller, err := client.BeginCreateOrUpdate(a.Context, resourceGroup, deployment.Name, armresources.Deployment{
+		Properties: &armresources.DeploymentProperties{
+			Mode:       to.Ptr(armresources.DeploymentModeIncremental),
+			Template:   deployment.Template,
+			Parameters: deployment.Parameters,
+		},
+	}, nil)
+	if err != nil {
+		return &DeploymentError{Name: deployment.Name, Err: err}
+	}
+
+	states := map[string]string{}
+	failures := map[string]OperationStatus{}
+	track := func() {
+		for _, name := range append([]string{deployment.Name}, deployment.Nested...) {
+			for _, status := range a.operationStatuses(operations, resourceGroup, name) {
+				key := status.Deployment + "/" + status.ResourceType + "/" + status.ResourceName
+				if status.Error != nil {
+					failures[key] = status
+				}
+				if states[key] != status.ProvisioningState {
+					states[key] = status.ProvisioningState
+					if progress != nil {
+						progress(status)
+					}
+				}
+			}
+		}
+	}
+
+	for !poller.Done() {
+		select {
+		case <-a.Context.Done():
+			return a.Context.Err()
+		case <-time.After(pollInterval):
+		}
+		if _, err := poller.Poll(a.Context); err != nil {
+			break
+		}
+		track()
+	}
+	_, err = poller.Result(a.Context)
+	track()
+
+	if err == nil && len(failures) == 0 {
+		return nil
+	}
+	deploymentErr := &DeploymentError{Name: deployment.Name, Err: err}
+	keys := []string{}
+	for key := range failures {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		deploymentErr.Failures = append(deploymentErr.Failures, failures[key])
+	}
+	return deploymentErr
+}
+
+// Statuses of the resources of a deployment, empty if the deployment is not started yet.
+// Errors of listing are ignored, the result of the deployment reports its failure
+func (a ARM) operationStatuses(client *armresources.DeploymentOperationsClient, resourceGroup, deploymentName string) []OperationStatus {
+	statuses := []OperationStatus{}
+	pager := client.NewListPager(resourceGroup, deploymentName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(a.Context)
+		if err != nil {
+			return statuses
+		}
+		for _, operation := range page.Value {
+			if operation == nil || operation.Properties == nil || operation.Properties.TargetResource == nil {
+				continue
+			}
+			p := operation.Properties
+			status := OperationStatus{
+				Deployment:        deploymentName,
+				ResourceType:      safeString(p.TargetResource.ResourceType),
+				ResourceName:      safeString(p.TargetResource.ResourceName),
+				ProvisioningState: safeString(p.ProvisioningState),
+				StatusCode:        safeString(p.StatusCode),
+			}
+			if p.StatusMessage != nil && p.StatusMessage.Error != nil && strings.EqualFold(status.ProvisioningState, "Failed") {
+				status.Error = errorDetail(p.StatusMessage.Error)
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
@@ -0,0 +1,250 @@
+package arm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	deploymentTemplateSchema = "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#"
+	deploymentsAPIVersion    = "2021-04-01"
+
+	// parameter of every generated template, set to the name of the service
+	ServiceNameParameter = "ApimServiceName"
+)
+
+// Master deployment of a templates directory, a nested deployment per template file
+type Deployment struct {
+	Name       string
+	Template   map[string]interface{}
+	Parameters map[string]interface{}
+	// template files relative to the directory and the names of their nested deployments
+	Files  []string
+	Nested []string
+}
+
+// Options of building the master deployment
+type DeploymentOptions struct {
+	Name        string
+	ServiceName string
+	// Parameters of templates other than ApimServiceName
+	Parameters map[string]string
+	// Base URL where the templates directory is hosted, templates are linked instead of inlined when set.
+	// Query string of the URL (e.g. SAS token) is appended to each template URL
+	LinkedBaseURL string
+}
+
+var deploymentNamePattern = regexp.MustCompile(`[^-\w._()]`)
+
+// Max length of deployment names
+const maxDeploymentNameLength = 64
+
+// Name of nested deployment of a template file. Names longer than 64 characters are cut and suffixed with a hash of the
+// file so that templates of the same beginning keep their own deployment
+func nestedDeploymentName(master, file string) string {
+	stem := strings.TrimSuffix(filepath.ToSlash(file), ".template.json")
+	name := master + "-" + deploymentNamePattern.ReplaceAllString(strings.ReplaceAll(stem, "/", "-"), "")
+	if len(name) > maxDeploymentNameLength {
+		sum := sha256.Sum256([]byte(filepath.ToSlash(file)))
+		hash := hex.EncodeToString(sum[:4])
+		name = name[:maxDeploymentNameLength-len(hash)-1] + "-" + hash
+	}
+	return name
+}
+
+// Templates deployed before the others, other templates depend on them. The file name starts with backends,
+// namedValues or versionSets
+func isFoundationTemplate(file string) bool {
+	name := strings.ToLower(filepath.Base(file))
+	for _, prefix := range []string{"backends", "namedvalues", "versionsets"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Value of a parameter given as string for its declared type, e.g. 5 of int or ["a"] of array
+func parameterValue(name, parameterType, value string) (interface{}, error) {
+	switch strings.ToLower(parameterType) {
+	case "int":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s is of type int: %w", name, err)
+		}
+		return n, nil
+	case "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s is of type bool: %w", name, err)
+		}
+		return b, nil
+	case "object", "secureobject", "array":
+		var v interface{}
+		if err := json.Unmarshal([]byte(value), &v); err != nil {
+			return nil, fmt.Errorf("parameter %s is of type %s, expected JSON: %w", name, parameterType, err)
+		}
+		return v, nil
+	}
+	return value, nil
+}
+
+// Template files of dir, *.template.json except master templates, foundation templates first
+func templateFiles(dir string) ([]string, error) {
+	files := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name := strings.ToLower(info.Name())
+		if !strings.HasSuffix(name, ".template.json") || strings.Contains(name, "master") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if isFoundationTemplate(files[i]) != isFoundationTemplate(files[j]) {
+			return isFoundationTemplate(files[i])
+		}
+		return files[i] < files[j]
+	})
+	return files, nil
+}
+
+// Build master deployment of all templates in dir. Each template is a nested deployment with inner scope,
+// receiving ApimServiceName and the parameters it declares. Templates of backends, named values and
+// version sets are deployed first and the others depend on them
+func BuildDeployment(dir string, options DeploymentOptions) (Deployment, error) {
+	deployment := Deployment{Name: options.Name, Files: []string{}, Nested: []string{}}
+
+	files, err := templateFiles(dir)
+	if err != nil {
+		return deployment, err
+	}
+	if len(files) == 0 {
+		return deployment, fmt.Errorf("no *.template.json found in %s", dir)
+	}
+
+	templates := make([]map[string]interface{}, len(files))
+	for i, file := range files {
+		if templates[i], err = readJSON(filepath.Join(dir, file)); err != nil {
+			return deployment, err
+		}
+	}
+
+	// master parameters are of the type declared by the templates, string if no template declares them
+	types := map[string]string{}
+	for i, template := range templates {
+		declared, _ := template["parameters"].(map[string]interface{})
+		for name, definition := range declared {
+			d, _ := definition.(map[string]interface{})
+			parameterType, _ := d["type"].(string)
+			if parameterType == "" {
+				continue
+			}
+			if t, ok := types[name]; ok && !strings.EqualFold(t, parameterType) {
+				return deployment, fmt.Errorf("parameter %s of %s is of type %s, other templates declare %s", name, files[i], parameterType, t)
+			}
+			types[name] = parameterType
+		}
+	}
+
+	masterParameters := map[string]interface{}{ServiceNameParameter: map[string]interface{}{"type": "string"}}
+	deployment.Parameters = map[string]interface{}{ServiceNameParameter: map[string]interface{}{"value": options.ServiceName}}
+	for name, value := range options.Parameters {
+		parameterType, ok := types[name]
+		if !ok {
+			parameterType = "string"
+		}
+		v, err := parameterValue(name, parameterType, value)
+		if err != nil {
+			return deployment, err
+		}
+		masterParameters[name] = map[string]interface{}{"type": parameterType}
+		deployment.Parameters[name] = map[string]interface{}{"value": v}
+	}
+
+	resources := []interface{}{}
+	foundations := []interface{}{}
+	for i, file := range files {
+		template := templates[i]
+
+		// pass the parameters declared by the template, required parameters must be given
+		parameters := map[string]interface{}{}
+		declared, _ := template["parameters"].(map[string]interface{})
+		for name, definition := range declared {
+			if _, ok := masterParameters[name]; ok {
+				parameters[name] = map[string]interface{}{"value": "[parameters('" + name + "')]"}
+				continue
+			}
+			if d, ok := definition.(map[string]interface{}); ok {
+				if _, ok := d["defaultValue"]; ok {
+					continue
+				}
+			}
+			return deployment, fmt.Errorf("parameter %s of %s is required, set it with --parameter %s=value", name, file, name)
+		}
+
+		name := nestedDeploymentName(options.Name, file)
+		properties := map[string]interface{}{
+			"mode":                        "Incremental",
+			"expressionEvaluationOptions": map[string]interface{}{"scope": "inner"},
+			"parameters":                  parameters,
+		}
+		if options.LinkedBaseURL != "" {
+			delete(properties, "expressionEvaluationOptions")
+			properties["templateLink"] = map[string]interface{}{"uri": linkedTemplateURL(options.LinkedBaseURL, file)}
+		} else {
+			properties["template"] = template
+		}
+
+		resource := map[string]interface{}{
+			"type":       "Microsoft.Resources/deployments",
+			"apiVersion": deploymentsAPIVersion,
+			"name":       name,
+			"properties": properties,
+		}
+		if isFoundationTemplate(file) {
+			foundations = append(foundations, "[resourceId('Microsoft.Resources/deployments', '"+name+"')]")
+		} else if len(foundations) > 0 {
+			resource["dependsOn"] = foundations
+		}
+		resources = append(resources, resource)
+		deployment.Files = append(deployment.Files, file)
+		deployment.Nested = append(deployment.Nested, name)
+	}
+
+	deployment.Template = map[string]interface{}{
+		"$schema":        deploymentTemplateSchema,
+		"contentVersion": "1.0.0.0",
+		"parameters":     masterParameters,
+		"resources":      resources,
+	}
+	return deployment, nil
+}
+
+// URL of template file under base URL, query string of base URL is kept at the end
+func linkedTemplateURL(baseURL, file string) string {
+	base, query, _ := strings.Cut(baseURL, "?")
+	url := strings.TrimRight(base, "/") + "/" + filepath.ToSlash(file)
+	if query != "" {
+		url += "?" + query
+	}
+	return url
+}
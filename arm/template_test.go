@@ -0,0 +1,100 @@
+package arm
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNestedDeploymentName(t *testing.T) {
+	short := nestedDeploymentName("deploy", "apis/echo.template.json")
+	if short != "deploy-apis-echo" {
+		t.Errorf("nestedDeploymentName = %s, want deploy-apis-echo", short)
+	}
+
+	long := strings.Repeat("payment-gateway-", 5)
+	a := nestedDeploymentName("deploy", long+"orders.template.json")
+	b := nestedDeploymentName("deploy", long+"refunds.template.json")
+	if len(a) != maxDeploymentNameLength || len(b) != maxDeploymentNameLength {
+		t.Errorf("length of long names = %d, %d, want %d", len(a), len(b), maxDeploymentNameLength)
+	}
+	if a == b {
+		t.Errorf("long templates have the same nested deployment name %s", a)
+	}
+	if a != nestedDeploymentName("deploy", long+"orders.template.json") {
+		t.Error("nested deployment name of the same file changes")
+	}
+}
+
+func TestIsFoundationTemplate(t *testing.T) {
+	tests := map[string]bool{
+		"backends.template.json":             true,
+		"sub/namedValues.template.json":      true,
+		"versionSets.template.json":          true,
+		"apis/echo.template.json":            false,
+		"apis/legacy-backends.template.json": false,
+		"my-namedvalues-api.template.json":   false,
+	}
+	for file, want := range tests {
+		if got := isFoundationTemplate(file); got != want {
+			t.Errorf("isFoundationTemplate(%s) = %v, want %v", file, got, want)
+		}
+	}
+}
+
+func writeTemplate(t *testing.T, dir, file, parameters string) {
+	t.Helper()
+	path := filepath.Join(dir, file)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := `{"contentVersion": "1.0.0.0", "parameters": {"ApimServiceName": {"type": "string"}` + parameters + `}, "resources": []}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildDeployment(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "apis/legacy-backends.template.json", `, "timeout": {"type": "int"}, "tags": {"type": "array"}`)
+	writeTemplate(t, dir, "backends.template.json", `, "enabled": {"type": "bool"}`)
+	writeTemplate(t, dir, "master.template.json", "")
+
+	deployment, err := BuildDeployment(dir, DeploymentOptions{Name: "deploy", ServiceName: "svc",
+		Parameters: map[string]string{"timeout": "30", "tags": `["a","b"]`, "enabled": "true", "owner": "team"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"backends.template.json", filepath.Join("apis", "legacy-backends.template.json")}; !reflect.DeepEqual(deployment.Files, want) {
+		t.Errorf("files = %v, want %v", deployment.Files, want)
+	}
+
+	parameters := deployment.Template["parameters"].(map[string]interface{})
+	for name, want := range map[string]string{"ApimServiceName": "string", "timeout": "int", "tags": "array", "enabled": "bool", "owner": "string"} {
+		if got := parameters[name].(map[string]interface{})["type"]; got != want {
+			t.Errorf("type of master parameter %s = %v, want %s", name, got, want)
+		}
+	}
+	values := map[string]interface{}{}
+	for name, value := range deployment.Parameters {
+		values[name] = value.(map[string]interface{})["value"]
+	}
+	want := map[string]interface{}{"ApimServiceName": "svc", "timeout": 30, "tags": []interface{}{"a", "b"}, "enabled": true, "owner": "team"}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("parameter values = %v, want %v", values, want)
+	}
+
+	// the API template depends on the foundation template
+	resources := deployment.Template["resources"].([]interface{})
+	if dependsOn := resources[1].(map[string]interface{})["dependsOn"]; !reflect.DeepEqual(dependsOn,
+		[]interface{}{"[resourceId('Microsoft.Resources/deployments', 'deploy-backends')]"}) {
+		t.Errorf("dependsOn = %v", dependsOn)
+	}
+
+	if _, err := BuildDeployment(dir, DeploymentOptions{Name: "deploy", ServiceName: "svc",
+		Parameters: map[string]string{"timeout": "soon", "tags": "[]", "enabled": "true"}}); err == nil || !strings.Contains(err.Error(), "timeout is of type int") {
+		t.Errorf("error of invalid int parameter = %v", err)
+	}
+}
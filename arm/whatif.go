@@ -0,0 +1,110 @@
+package arm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+)
+
+// Change types of what-if
+const (
+	ChangeCreate      = "Create"
+	ChangeDelete      = "Delete"
+	ChangeModify      = "Modify"
+	ChangeNoChange    = "NoChange"
+	ChangeIgnore      = "Ignore"
+	ChangeDeploy      = "Deploy"
+	ChangeUnsupported = "Unsupported"
+)
+
+// Change of a resource reported by what-if, Before and After are the resource payloads
+type Change struct {
+	ResourceID string           `json:"resourceId"`
+	ChangeType string           `json:"changeType"`
+	Before     interface{}      `json:"before,omitempty"`
+	After      interface{}      `json:"after,omitempty"`
+	Delta      []PropertyChange `json:"delta,omitempty"`
+}
+
+// Change of a property of a resource, children are changes of nested properties
+type PropertyChange struct {
+	Path       string           `json:"path"`
+	ChangeType string           `json:"changeType"`
+	Before     interface{}      `json:"before,omitempty"`
+	After      interface{}      `json:"after,omitempty"`
+	Children   []PropertyChange `json:"children,omitempty"`
+}
+
+// Preview changes of the deployment on the resource group with ARM what-if
+func (a ARM) WhatIf(resourceGroup string, deployment Deployment) ([]Change, error) {
+	client, err := armresources.NewDeploymentsClient(a.SubscriptionID, a.Credential, a.clientOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	poller, err := client.BeginWhatIf(a.Context, resourceGroup, deployment.Name, armresources.DeploymentWhatIf{
+		Properties: &armresources.DeploymentWhatIfProperties{
+			Mode:           to.Ptr(armresources.DeploymentModeIncremental),
+			Template:       deployment.Template,
+			Parameters:     deployment.Parameters,
+			WhatIfSettings: &armresources.DeploymentWhatIfSettings{ResultFormat: to.Ptr(armresources.WhatIfResultFormatFullResourcePayloads)},
+		},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	result, err := poller.PollUntilDone(a.Context, nil)
+	if err != nil {
+		return nil, err
+	}
+	return whatIfChanges(deployment.Name, result.WhatIfOperationResult)
+}
+
+// Changes of a what-if response of ARM, e.g. saved by az deployment group what-if --no-pretty-print
+func ParseWhatIf(data []byte) ([]Change, error) {
+	result := armresources.WhatIfOperationResult{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("cannot parse what-if result: %w", err)
+	}
+	return whatIfChanges("what-if", result)
+}
+
+func whatIfChanges(name string, result armresources.WhatIfOperationResult) ([]Change, error) {
+	if result.Error != nil {
+		return nil, &DeploymentError{Name: name, Err: errors.New(errorDetail(result.Error).String())}
+	}
+
+	changes := []Change{}
+	if result.Properties == nil {
+		return changes, nil
+	}
+	for _, change := range result.Properties.Changes {
+		if change == nil {
+			continue
+		}
+		c := Change{ResourceID: safeString(change.ResourceID), Before: change.Before, After: change.After, Delta: propertyChanges(change.Delta)}
+		if change.ChangeType != nil {
+			c.ChangeType = string(*change.ChangeType)
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+func propertyChanges(changes []*armresources.WhatIfPropertyChange) []PropertyChange {
+	result := []PropertyChange{}
+	for _, change := range changes {
+		if change == nil {
+			continue
+		}
+		c := PropertyChange{Path: safeString(change.Path), Before: change.Before, After: change.After, Children: propertyChanges(change.Children)}
+		if change.PropertyChangeType != nil {
+			c.ChangeType = string(*change.PropertyChangeType)
+		}
+		result = append(result, c)
+	}
+	return result
+}
@@ -0,0 +1,189 @@
+package arm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+type staticCredential struct{}
+
+func (staticCredential) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// Canned what-if result of testdata/whatif.json: a backend created, an API modified with its policy, a backend deleted
+// and an API of no change
+func whatIfResult(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "whatif.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// Stand-in ARM serving what-if of deployment "deploy" on resource group "rg", accepted then polled at its location
+func whatIfServer(t *testing.T, status int, body string) (*httptest.Server, *map[string]interface{}) {
+	request := map[string]interface{}{}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/subscriptions/sub/resourcegroups/rg/providers/Microsoft.Resources/deployments/deploy/whatIf":
+			data, _ := io.ReadAll(r.Body)
+			if err := json.Unmarshal(data, &request); err != nil {
+				t.Errorf("what-if request: %v", err)
+			}
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte(body))
+				return
+			}
+			w.Header().Set("Location", server.URL+"/operationResults/1")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodGet && r.URL.Path == "/operationResults/1":
+			_, _ = w.Write([]byte(body))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &request
+}
+
+func testARM(endpoint string) ARM {
+	return ARM{
+		SubscriptionID: "sub",
+		Credential:     staticCredential{},
+		Context:        context.Background(),
+		Cloud: cloud.Configuration{
+			ActiveDirectoryAuthorityHost: endpoint,
+			Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+				cloud.ResourceManager: {Audience: "https://management.core.windows.net/", Endpoint: endpoint},
+			},
+		},
+	}
+}
+
+func testDeployment() Deployment {
+	return Deployment{
+		Name:       "deploy",
+		Template:   map[string]interface{}{"$schema": deploymentTemplateSchema, "contentVersion": "1.0.0.0", "resources": []interface{}{}},
+		Parameters: map[string]interface{}{ServiceNameParameter: map[string]interface{}{"value": "svc"}},
+	}
+}
+
+func TestWhatIf(t *testing.T) {
+	server, request := whatIfServer(t, http.StatusOK, whatIfResult(t))
+
+	changes, err := testARM(server.URL).WhatIf("rg", testDeployment())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	properties, _ := (*request)["properties"].(map[string]interface{})
+	if properties["mode"] != "Incremental" {
+		t.Errorf("mode = %v, want Incremental", properties["mode"])
+	}
+	if settings, _ := properties["whatIfSettings"].(map[string]interface{}); settings["resultFormat"] != "FullResourcePayloads" {
+		t.Errorf("whatIfSettings = %v, want resultFormat FullResourcePayloads", properties["whatIfSettings"])
+	}
+	if parameters, _ := properties["parameters"].(map[string]interface{}); parameters[ServiceNameParameter] == nil {
+		t.Errorf("parameters = %v, want %s", properties["parameters"], ServiceNameParameter)
+	}
+
+	types := []string{}
+	for _, change := range changes {
+		types = append(types, change.ChangeType)
+	}
+	if want := []string{ChangeCreate, ChangeModify, ChangeDelete, ChangeNoChange}; !reflect.DeepEqual(types, want) {
+		t.Fatalf("change types = %v, want %v", types, want)
+	}
+
+	create := changes[0]
+	if !strings.HasSuffix(create.ResourceID, "/backends/be1") || create.Before != nil {
+		t.Errorf("create = %+v", create)
+	}
+	if after, _ := create.After.(map[string]interface{}); after["name"] != "be1" {
+		t.Errorf("create after = %v", create.After)
+	}
+
+	modify := changes[1]
+	if len(modify.Delta) != 2 {
+		t.Fatalf("modify delta = %+v", modify.Delta)
+	}
+	if d := modify.Delta[0]; d.Path != "properties.serviceUrl" || d.ChangeType != ChangeModify || d.Before != "https://a.com" || d.After != "https://b.com" {
+		t.Errorf("modify delta = %+v", d)
+	}
+	if children := modify.Delta[1].Children; len(children) != 1 || children[0].Path != "value" || !strings.Contains(children[0].After.(string), "set-backend-service") {
+		t.Errorf("modify children = %+v", children)
+	}
+
+	if before, _ := changes[2].Before.(map[string]interface{}); before["name"] != "old" || changes[2].After != nil {
+		t.Errorf("delete = %+v", changes[2])
+	}
+}
+
+func TestWhatIfErrorResponse(t *testing.T) {
+	server, _ := whatIfServer(t, http.StatusBadRequest,
+		`{"error": {"code": "InvalidTemplate", "message": "Deployment template validation failed"}}`)
+
+	_, err := testARM(server.URL).WhatIf("rg", testDeployment())
+	var responseError *azcore.ResponseError
+	if !errors.As(err, &responseError) {
+		t.Fatalf("error = %v, want azcore.ResponseError", err)
+	}
+	if responseError.StatusCode != http.StatusBadRequest || responseError.ErrorCode != "InvalidTemplate" {
+		t.Errorf("error = %d %s, want 400 InvalidTemplate", responseError.StatusCode, responseError.ErrorCode)
+	}
+}
+
+func TestWhatIfFailedResult(t *testing.T) {
+	server, _ := whatIfServer(t, http.StatusOK, `{
+		"status": "Failed",
+		"error": {"code": "DeploymentWhatIfResourceError", "message": "resource error",
+			"details": [{"code": "ValidationError", "message": "invalid url", "target": "backends/be1"}]}
+	}`)
+
+	_, err := testARM(server.URL).WhatIf("rg", testDeployment())
+	var deploymentError *DeploymentError
+	if !errors.As(err, &deploymentError) {
+		t.Fatalf("error = %v, want DeploymentError", err)
+	}
+	want := "deployment deploy failed: DeploymentWhatIfResourceError: resource error; ValidationError: invalid url (backends/be1)"
+	if err.Error() != want {
+		t.Errorf("error = %s, want %s", err, want)
+	}
+}
+
+func TestParseWhatIf(t *testing.T) {
+	changes, err := ParseWhatIf([]byte(whatIfResult(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 4 || changes[1].Delta[0].Path != "properties.serviceUrl" {
+		t.Errorf("changes = %+v", changes)
+	}
+
+	if changes, err := ParseWhatIf([]byte(`{"status": "Succeeded"}`)); err != nil || len(changes) != 0 {
+		t.Errorf("changes of empty result = %v, %v", changes, err)
+	}
+	if _, err := ParseWhatIf([]byte(`{`)); err == nil || !strings.Contains(err.Error(), "cannot parse what-if result") {
+		t.Errorf("error of invalid JSON = %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tarathep/apimtool/apim"
+)
+
+// Record of a change made by apimtool, appended to the audit log as a JSON line
+type AuditRecord struct {
+	Time          time.Time   `json:"time"`
+	User          string      `json:"user,omitempty"`
+	Principal     string      `json:"principal,omitempty"`
+	Subscription  string      `json:"subscription,omitempty"`
+	ResourceGroup string      `json:"resourceGroup,omitempty"`
+	Service       string      `json:"service,omitempty"`
+	Command       string      `json:"command"`
+	Action        string      `json:"action"`
+	Entity        string      `json:"entity"`
+	Before        interface{} `json:"before,omitempty"`
+	After         interface{} `json:"after,omitempty"`
+	Diff          string      `json:"diff,omitempty"`
+}
+
+// command being executed, set by main for audit records
+var currentCommand string
+
+// Record of a change on the service of a, principal is read from the token of the credential
+func serviceRecord(a apim.APIM, resourceGroup, serviceName, action, entity string) AuditRecord {
+	record := fileRecord(action, entity)
+	record.Subscription = a.SubscriptionID
+	record.ResourceGroup = resourceGroup
+	record.Service = serviceName
+
+	principal, err := a.Principal()
+	if err != nil {
+		log.Warn().Err(err).Msg("cannot get principal for audit log")
+	}
+	record.Principal = principal
+	return record
+}
+
+// Record of a change on local files
+func fileRecord(action, entity string) AuditRecord {
+	record := AuditRecord{Time: time.Now().UTC(), Command: currentCommand, Action: action, Entity: entity}
+	if u, err := user.Current(); err == nil {
+		record.User = u.Username
+	}
+	return record
+}
+
+// Append the record to the audit log file and post it to the sink of config,
+// the change is already made so failures are logged and not returned
+func writeAudit(record AuditRecord) {
+	config, err := loadConfig()
+	if err != nil {
+		log.Error().Err(err).Msg("cannot load config for audit log")
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Error().Err(err).Msg("cannot write audit log")
+		return
+	}
+
+	path := config.Audit.File
+	if path == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			path = filepath.Join(dir, "apimtool", "audit.jsonl")
+		}
+	}
+	if path != "" {
+		if err := appendLine(path, data); err != nil {
+			log.Error().Err(err).Msg("cannot write audit log " + path)
+		}
+	}
+
+	if config.Audit.Sink != "" {
+		client := http.Client{Timeout: 10 * time.Second}
+		response, err := client.Post(config.Audit.Sink, "application/json", bytes.NewReader(data))
+		if err != nil {
+			log.Error().Err(err).Msg("cannot post audit record to " + config.Audit.Sink)
+			return
+		}
+		response.Body.Close()
+		if response.StatusCode >= 300 {
+			log.Error().Msg("cannot post audit record to " + config.Audit.Sink + ": " + response.Status)
+		}
+	}
+}
+
+func appendLine(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,1330 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/rs/zerolog/log"
+	"github.com/tarathep/apimtool/apim"
+	"github.com/tarathep/apimtool/arm"
+	"github.com/tarathep/apimtool/engine"
+)
+
+// Options of the API Management service, required by commands which connect to APIM
+type ServiceOptions struct {
+	ResourceGroup string `short:"g" long:"resource-group" description:"Resource group" required:"true"`
+	ServiceName   string `short:"n" long:"service-name" description:"Name of API Management service" required:"true"`
+}
+
+// Option of mutating commands to print the change without applying it
+type DryRunOptions struct {
+	DryRun bool `long:"dry-run" description:"Print the request to Azure or the diff of the file without changing"`
+}
+
+type ParseCommand struct {
+	ServiceOptions
+	Environment           string `long:"env" description:"Environment" required:"true"`
+	ApiID                 string `long:"api-id" description:"API ID, config file is ./apim-apis-{env}/{api-id}/{api-id}.json. A glob (e.g. payment-*) parses the matching APIs"`
+	All                   bool   `long:"all" description:"Parse all APIs of ./apim-apis-{env}/*/*.json"`
+	FilePath              string `long:"file-path" description:"Path to API config file"`
+	ChangedSince          string `long:"changed-since" description:"Parse only the API config files changed since the git ref (e.g. origin/main)"`
+	Force                 bool   `long:"force" description:"Parse APIs even if their inputs are unchanged since the last parse"`
+	CreateMissingBackends bool   `long:"create-missing-backends" description:"Add backends not found on APIM and backends.template.json to backends.template.json instead of failing"`
+	CreateInAPIM          bool   `long:"create-in-apim" description:"Also create the missing backends on APIM, implies --create-missing-backends"`
+	BackendNaming         string `long:"backend-naming" description:"Naming convention of created backend IDs with {scheme}, {host}, {port} and {apiname}, default of config or {host}-{port}"`
+	BackendProtocol       string `long:"backend-protocol" description:"Protocol of created backends" choice:"http" choice:"soap" default:"http"`
+	ChooseBackend         bool   `long:"choose-backend" description:"Ask which backend to use when the backend URL is used by more than one backend and no preference selects one"`
+}
+
+func (c *ParseCommand) Execute(args []string) error {
+	pattern := c.ApiID
+	if c.All {
+		pattern = "*"
+	}
+	if pattern == "" {
+		return &flags.Error{Type: flags.ErrRequired, Message: "the required flag `--api-id' or `--all' was not specified"}
+	}
+	if err := c.checkFlags(); err != nil {
+		return err
+	}
+	a, err := newAPIM()
+	if err != nil {
+		return err
+	}
+	e, err := c.engine(a)
+	if err != nil {
+		return err
+	}
+	if c.FilePath == "" && (strings.ContainsAny(pattern, "*?[") || c.ChangedSince != "") {
+		return c.parseAll(e, pattern)
+	}
+	printTitle("Parser JSON API to source files")
+	color.New(color.Italic).Print("API ID \t: ", c.ApiID, "\n\n")
+
+	result, err := e.ConfigParser(c.Environment, c.ApiID, c.ResourceGroup, c.ServiceName, c.FilePath)
+	c.auditCreatedBackends(a, result.CreatedBackends)
+	if err != nil {
+		return err
+	}
+	printParseResult(result)
+	return nil
+}
+
+// Usage error of flags which cannot be used together, --file-path is the config file of a single API
+func (c *ParseCommand) checkFlags() error {
+	conflict := func(a, b string) error {
+		return &flags.Error{Type: flags.ErrInvalidChoice, Message: "`" + a + "' cannot be used with `" + b + "'"}
+	}
+	switch {
+	case c.All && c.ApiID != "":
+		return conflict("--all", "--api-id")
+	case c.FilePath != "" && c.All:
+		return conflict("--file-path", "--all")
+	case c.FilePath != "" && strings.ContainsAny(c.ApiID, "*?["):
+		return conflict("--file-path", "--api-id "+c.ApiID)
+	case c.FilePath != "" && c.ChangedSince != "":
+		return conflict("--file-path", "--changed-since")
+	}
+	return nil
+}
+
+// Engine of the options of backend selection and missing backends, asks to confirm when backends may be created on APIM
+func (c *ParseCommand) engine(a apim.APIM) (engine.Engine, error) {
+	e := engine.Engine{APIM: a}
+	preference, err := backendPreference()
+	if err != nil {
+		return e, err
+	}
+	e.BackendPreference = preference
+	if c.ChooseBackend {
+		e.ChooseBackend = chooseBackend
+	}
+	if !c.CreateMissingBackends && !c.CreateInAPIM {
+		return e, nil
+	}
+	template, err := templateOptions()
+	if err != nil {
+		return e, err
+	}
+	naming, err := backendNaming(c.BackendNaming)
+	if err != nil {
+		return e, err
+	}
+	e.Template = template
+	e.MissingBackends = engine.MissingBackendOptions{Create: true, CreateInAPIM: c.CreateInAPIM, Naming: naming, Protocol: c.BackendProtocol}
+	if err := e.MissingBackends.Validate(); err != nil {
+		return e, &flags.Error{Type: flags.ErrInvalidChoice, Message: err.Error()}
+	}
+	if c.CreateInAPIM {
+		if err := confirmService(c.ResourceGroup, c.ServiceName, "Create missing backends on "+c.ServiceName); err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
+
+// Write audit records of the backends created by parse
+func (c *ParseCommand) auditCreatedBackends(a apim.APIM, backends []engine.CreatedBackend) {
+	for _, backend := range backends {
+		if backend.Change != nil {
+			record := fileRecord("create", backend.Change.Path+"#"+backend.Backend.Name)
+			record.After = backend.Backend
+			record.Diff = backend.Change.Diff()
+			writeAudit(record)
+		}
+		if backend.InAPIM {
+			record := serviceRecord(a, c.ResourceGroup, c.ServiceName, "create", "backend/"+backend.Backend.Name)
+			record.After = backend.Backend
+			writeAudit(record)
+		}
+	}
+}
+
+// Parse the APIs matching pattern and print the summary, error if any API failed
+func (c *ParseCommand) parseAll(e engine.Engine, pattern string) error {
+	start := time.Now()
+	printTitle("Parser JSON API to source files {apim-apis-" + c.Environment + "/" + pattern + "}")
+
+	outcomes, err := e.ParseAll(c.Environment, c.ResourceGroup, c.ServiceName, engine.ParseOptions{
+		Pattern:      pattern,
+		ChangedSince: c.ChangedSince,
+		Force:        c.Force,
+	})
+	for _, outcome := range outcomes {
+		c.auditCreatedBackends(e.APIM, outcome.Result.CreatedBackends)
+	}
+	if err != nil {
+		return err
+	}
+	printParseSummary(outcomes)
+	printTimeUsed(start)
+
+	failed := 0
+	for _, outcome := range outcomes {
+		if outcome.Status == engine.ParseFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d API(s) failed to parse", failed, len(outcomes))
+	}
+	return nil
+}
+
+type APIListCommand struct {
+	ServiceOptions
+	FilterDisplayName string `long:"filter-display-name" description:"Filter of APIs by displayName"`
+	Option            string `short:"o" long:"option" description:"Option to view" choice:"table" choice:"list" default:"table"`
+}
+
+func (c *APIListCommand) Execute(args []string) error {
+	a, err := newAPIM()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	printTitle("List API Management API's")
+
+	if c.Option == "list" {
+		apiModels, err := a.ListAPIModel(c.ResourceGroup, c.ServiceName, c.FilterDisplayName)
+		if err != nil {
+			return err
+		}
+		printAPIModels(apiModels)
+	} else {
+		apis, err := a.ListAPI(c.ResourceGroup, c.ServiceName, c.FilterDisplayName)
+		if err != nil {
+			return err
+		}
+		printAPIs(apis)
+	}
+	printTimeUsed(start)
+	return nil
+}
+
+type APIRevisionListCommand struct {
+	ServiceOptions
+	ApiID apiID `long:"api-id" description:"API ID on APIM" required:"true"`
+}
+
+func (c *APIRevisionListCommand) Execute(args []string) error {
+	a, err := newAPIM()
+	if err != nil {
+		return err
+	}
+	printTitle("List API Management API Revision's")
+
+	revisions, err := a.ListAPIRevisions(c.ResourceGroup, c.ServiceName, string(c.ApiID))
+	if err != nil {
+		return err
+	}
+	printRevisions(revisions)
+	return nil
+}
+
+type APIRevisionCreateCommand struct {
+	ServiceOptions
+	ApiID       apiID  `long:"api-id" description:"API ID on APIM" required:"true"`
+	Description string `long:"description" description:"Revision description"`
+	SourcePath  string `long:"source-path" description:"Path to source files of the API generated by parse, default ./sources/{api-id}"`
+	DryRunOptions
+}
+
+func (c *APIRevisionCreateCommand) Execute(args []string) error {
+	a, err := newAPIM()
+	if err != nil {
+		return err
+	}
+	printTitle("Create a new API revision in Api Management.")
+
+	config, err := engine.LoadRevisionConfig(string(c.ApiID), c.SourcePath)
+	if err != nil {
+		return err
+	}
+	next, err := a.NextAPIRevision(c.ResourceGroup, c.ServiceName, string(c.ApiID))
+	if err != nil {
+		return err
+	}
+	fmt.Print("API ID \t\t: ", c.ApiID, "\nRevision \t: ", next, "\nDescription \t: ", c.Description, "\n\n")
+
+	if c.DryRun {
+		requests, err := a.CreateAPIRevisionRequests(c.ResourceGroup, c.ServiceName, string(c.ApiID), next, c.Description, config)
+		if err != nil {
+			return err
+		}
+		return printRequests(requests)
+	}
+	if err := confirmService(c.ResourceGroup, c.ServiceName, "Create revision "+next+" of API "+string(c.ApiID)); err != nil {
+		return err
+	}
+
+	record := serviceRecord(a, c.ResourceGroup, c.ServiceName, "create", "api/"+string(c.ApiID)+";rev="+next)
+	if err := step("Creating", func() error {
+		record.After, err = a.CreateAPIRevision(c.ResourceGroup, c.ServiceName, string(c.ApiID), next, c.Description, config)
+		return err
+	}); err != nil {
+		return err
+	}
+	writeAudit(record)
+	return nil
+}
+
+type APIRevisionReleaseCommand struct {
+	ServiceOptions
+	ApiID    apiID  `long:"api-id" description:"API ID on APIM" required:"true"`
+	Revision string `long:"revision" description:"API revision number to make current" required:"true"`
+	Notes    string `long:"notes" description:"Release notes"`
+	DryRunOptions
+}
+
+func (c *APIRevisionReleaseCommand) Execute(args []string) error {
+	a, err := newAPIM()
+	if err != nil {
+		return err
+	}
+	printTitle("Make an API revision current in Api Management.")
+	fmt.Print("API ID \t\t: ", c.ApiID, "\nRevision \t: ", c.Revision, "\nNotes \t\t: ", c.Notes, "\n\n")
+
+	if c.DryRun {
+		request, err := a.ReleaseAPIRevisionRequest(c.ResourceGroup, c.ServiceName, string(c.ApiID), c.Revision, c.Notes)
+		if err != nil {
+			return err
+		}
+		return printRequest(request)
+	}
+	if err := confirmService(c.ResourceGroup, c.ServiceName, "Make revision "+c.Revision+" of API "+string(c.ApiID)+" current"); err != nil {
+		return err
+	}
+
+	record := serviceRecord(a, c.ResourceGroup, c.ServiceName, "release", "api/"+string(c.ApiID))
+	if current, err := a.ListAPIRevisions(c.ResourceGroup, c.ServiceName, string(c.ApiID)); err == nil {
+		for _, revision := range current {
+			if revision.IsCurrent {
+				record.Before = map[string]string{"revision": revision.Revision}
+			}
+		}
+	}
+	record.After = map[string]string{"revision": c.Revision, "notes": c.Notes}
+
+	if err := step("Releasing", func() error {
+		return a.ReleaseAPIRevision(c.ResourceGroup, c.ServiceName, string(c.ApiID), c.Revision, c.Notes)
+	}); err != nil {
+		return err
+	}
+	writeAudit(record)
+	return nil
+}
+
+type APIVersionSetListCommand struct {
+	ServiceOptions
+}
+
+func (c *APIVersionSetListCommand) Execute(args []string) error {
+	a, err := newAPIM()
+	if err != nil {
+		return err
+	}
+	printTitle("List API Management API Version Set's")
+
+	versionSets, err := a.ListAPIVersionSets(c.ResourceGroup, c.ServiceName)
+	if err != nil {
+		return err
+	}
+	printVersionSets(versionSets)
+	return nil
+}
+
+type BackendListCommand struct {
+	ServiceOptions
+	FilterDisplayName string `long:"filter-display-name" description:"Filter of backends by name"`
+	Option            string `short:"o" long:"option" description:"Option to view" choice:"table" choice:"list" default:"table"`
+}
+
+func (c *BackendListCommand) Execute(args []string) error {
+	a, err := newAPIM()
+	if err != nil {
+		return err
+	}
+	printTitle("List Backend's")
+
+	backends, err := a.ListBackend(c.ResourceGroup, c.ServiceName, c.FilterDisplayName)
+	if err != nil {
+		return err
+	}
+	printBackends(backends, c.Option)
+	return nil
+}
+
+type BackendCreateCommand struct {
+	ServiceOptions
+	BackendID string `long:"backend-id" description:"Backend ID on APIM" required:"true"`
+	URL       string `long:"url" description:"URL endpoint" required:"true"`
+	Protocol  string `long:"protocol" description:"Protocol to communicate" choice:"http" choice:"soap" required:"true"`
+	DryRunOptions
+}
+
+func (c *BackendCreateCommand) Execute(args []string) error {
+	a, err := newAPIM()
+	if err != nil {
+		return err
+	}
+	printTitle("Create a new backend entity in Api Management.")
+	fmt.Print("Backend ID \t: ", c.BackendID, "\nURL \t\t: ", c.URL, "\nProtocol \t: ", c.Protocol, "\n\n")
+
+	if c.DryRun {
+		request, err := a.CreateOrUpdateBackendRequest(c.ResourceGroup, c.ServiceName, c.BackendID, c.URL, c.Protocol)
+		if err != nil {
+			return err
+		}
+		return printRequest(request)
+	}
+	if err := confirmService(c.ResourceGroup, c.ServiceName, "Create or update backend "+c.BackendID+" on "+c.ServiceName); err != nil {
+		return err
+	}
+
+	record := serviceRecord(a, c.ResourceGroup, c.ServiceName, "create", "backend/"+c.BackendID)
+	before, err := a.GetBackend(c.ResourceGroup, c.ServiceName, c.BackendID)
+	switch {
+	case err == nil:
+		record.Action, record.Before = "update", before
+	case !errors.Is(err, apim.ErrNotFound):
+		return err
+	}
+
+	if err := step("Creating", func() error {
+		record.After, err = a.CreateOrUpdateBackend(c.ResourceGroup, c.ServiceName, c.BackendID, c.URL, c.Protocol)
+		return err
+	}); err != nil {
+		return err
+	}
+	writeAudit(record)
+	return nil
+}
+
+type BackendAuditCommand struct {
+	ServiceOptions
+	FilePath string `long:"file-path" description:"Path to backends template, audit APIM only if the default ./templates/backends.template.json does not exist"`
+}
+
+func (c *BackendAuditCommand) Execute(args []string) error {
+	a, err := newAPIM()
+	if err != nil {
+		return err
+	}
+	printTitle("Audit Backend's")
+
+	e := engine.Engine{APIM: a}
+	report, err := e.AuditBackends(c.ResourceGroup, c.ServiceName, c.FilePath)
+	if err != nil {
+		return err
+	}
+	if len(report.Sources) == 1 {
+		color.New(color.FgYellow).Print("./templates/backends.template.json not found, audit APIM only\n\n")
+	}
+	printFindings(report.Findings)
+	return nil
+}
+
+type BackendAPIDependListCommand struct {
+	ServiceOptions
+	BackendID backendID `long:"backend-id" description:"Backend ID on APIM"`
+	URL       string    `long:"url" description:"Backend URL"`
+}
+
+func (c *BackendAPIDependListCommand) Execute(args []string) error {
+	if c.BackendID == "" && c.URL == "" {
+		return &flags.Error{Type: flags.ErrRequired, Message: "the required flag `--backend-id' or `--url' was not specified"}
+	}
+	a, err := newAPIM()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	printTitle("List API Management API's depending Backend")
+
+	apiModels, err := a.ListAPIsDependingOnBackend(c.ResourceGroup, c.ServiceName, string(c.BackendID), c.URL)
+	if err != nil {
+		return err
+	}
+	printAPIModelTable(apiModels)
+	printTimeUsed(start)
+	return nil
+}
+
+type TemplateBackendExportCommand struct {
+	ServiceOptions
+	FilePath string `long:"file-path" description:"Directory to write backends.template.json or backends.bicep"`
+	Format   string `long:"format" description:"Template format" choice:"arm" choice:"bicep" default:"arm"`
+	DryRunOptions
+}
+
+func (c *TemplateBackendExportCommand) Execute(args []string) error {
+	a, err := newAPIM()
+	if err != nil {
+		return err
+	}
+
+	var change engine.FileChange
+	if c.Format == apim.TemplateFormatBicep {
+		printTitle("Export Backends Bicep module {backends.bicep}")
+		change.Path = apim.BackendsBicepPath(c.FilePath)
+		change.After, err = a.BackendsBicep(c.ResourceGroup, c.ServiceName)
+	} else {
+		printTitle("Export Backends ARM template {backends.template.json}")
+		change.Path = apim.BackendsTemplatePath(c.FilePath)
+		change.After, err = a.BackendsTemplate(c.ResourceGroup, c.ServiceName)
+	}
+	if err != nil {
+		return err
+	}
+	change.Before, _ = os.ReadFile(change.Path)
+
+	if c.DryRun {
+		printDiff(change.Diff())
+		return nil
+	}
+	if err := step("Exporting", change.Apply); err != nil {
+		return err
+	}
+
+	record := serviceRecord(a, c.ResourceGroup, c.ServiceName, "export", change.Path)
+	record.Diff = change.Diff()
+	writeAudit(record)
+	return nil
+}
+
+type TemplateAPIExportCommand struct {
+	ServiceOptions
+	ApiID    string `long:"api-id" description:"API ID on APIM" required:"true"`
+	FilePath string `long:"file-path" description:"Directory to write {api-id}.template.json or {api-id}.bicep" default:"./templates"`
+	Format   string `long:"format" description:"Template format" choice:"arm" choice:"bicep" default:"arm"`
+	DryRunOptions
+}
+
+func (c *TemplateAPIExportCommand) Execute(args []string) error {
+	a, err := newAPIM()
+	if err != nil {
+		return err
+	}
+	change := engine.FileChange{Path: apim.APITemplatePath(c.FilePath, c.ApiID, c.Format)}
+	printTitle("Export API template {" + filepath.Base(change.Path) + "}")
+	color.New(color.Italic).Print("API ID \t: ", c.ApiID, "\n\n")
+
+	api, err := a.ExportAPI(c.ResourceGroup, c.ServiceName, c.ApiID)
+	if err != nil {
+		return err
+	}
+	if c.Format == apim.TemplateFormatBicep {
+		change.After = a.Template.APIBicep(api)
+	} else if change.After, err = a.Template.APITemplate(api); err != nil {
+		return err
+	}
+	change.Before, _ = os.ReadFile(change.Path)
+
+	if c.DryRun {
+		printDiff(change.Diff())
+		return nil
+	}
+	if err := step("Exporting", change.Apply); err != nil {
+		return err
+	}
+
+	record := serviceRecord(a, c.ResourceGroup, c.ServiceName, "export", change.Path)
+	record.Diff = change.Diff()
+	writeAudit(record)
+	return nil
+}
+
+type TemplateBackendCreateCommand struct {
+	BackendID string `long:"backend-id" description:"Backend ID" required:"true"`
+	URL       string `long:"url" description:"URL endpoint" required:"true"`
+	Protocol  string `long:"protocol" description:"Protocol to communicate" choice:"http" choice:"soap" required:"true"`
+	Format    string `long:"format" description:"Template format, backends.template.json or backends.bicep" choice:"arm" choice:"bicep" default:"arm"`
+	DryRunOptions
+}
+
+func (c *TemplateBackendCreateCommand) Execute(args []string) error {
+	printTitle("Create a new backend entity in " + backendsTemplateName(c.Format))
+	fmt.Print("Backend ID \t: ", c.BackendID, "\nURL \t\t: ", c.URL, "\nProtocol \t: ", c.Protocol, "\n\n")
+
+	template, err := templateOptions()
+	if err != nil {
+		return err
+	}
+	e := engine.Engine{APIM: apim.APIM{Template: template}}
+	plan := e.PlanAddBackendTemplateJSON
+	if c.Format == apim.TemplateFormatBicep {
+		plan = e.PlanAddBackendBicep
+	}
+	change, err := plan(c.BackendID, c.URL, c.Protocol)
+	if err != nil {
+		return err
+	}
+	if c.DryRun {
+		printDiff(change.Diff())
+		return nil
+	}
+	if err := step("Creating", change.Apply); err != nil {
+		return err
+	}
+
+	record := fileRecord("create", change.Path+"#"+c.BackendID)
+	record.After = apim.Backend{Name: c.BackendID, URL: c.URL, Protocol: c.Protocol}
+	record.Diff = change.Diff()
+	writeAudit(record)
+	return nil
+}
+
+type TemplateBackendDeleteCommand struct {
+	BackendID templateBackendID `long:"backend-id" description:"Backend ID in backends.template.json or backends.bicep" required:"true"`
+	Format    string            `long:"format" description:"Template format, backends.template.json or backends.bicep" choice:"arm" choice:"bicep" default:"arm"`
+	DryRunOptions
+}
+
+func (c *TemplateBackendDeleteCommand) Execute(args []string) error {
+	color.New(color.Italic, color.FgHiYellow, color.Bold).Print("Delete a backend entity in " + backendsTemplateName(c.Format) + "\n\n")
+	fmt.Print("Backend ID \t: ", c.BackendID, "\n\n")
+
+	e := engine.Engine{}
+	plan := e.PlanDeleteBackendTemplateJSONByID
+	if c.Format == apim.TemplateFormatBicep {
+		plan = e.PlanDeleteBackendBicepByID
+	}
+	change, err := plan(string(c.BackendID))
+	if err != nil {
+		return err
+	}
+	if c.DryRun {
+		printDiff(change.Diff())
+		return nil
+	}
+	if err := confirm("Delete backend " + string(c.BackendID) + " from " + backendsTemplateName(c.Format)); err != nil {
+		return err
+	}
+	if err := step("Deleting", change.Apply); err != nil {
+		return err
+	}
+
+	record := fileRecord("delete", change.Path+"#"+string(c.BackendID))
+	record.Diff = change.Diff()
+	writeAudit(record)
+	return nil
+}
+
+type TemplateUpgradeCommand struct {
+	APIVersion string `long:"api-version" description:"API version of Microsoft.ApiManagement resources to upgrade to" required:"true"`
+	Schema     string `long:"schema" description:"Deployment template schema, default of config or 2019-04-01"`
+	FilePath   string `long:"file-path" description:"Templates directory or a template file" default:"./templates"`
+	DryRunOptions
+}
+
+func (c *TemplateUpgradeCommand) Execute(args []string) error {
+	template, err := templateOptions()
+	if err != nil {
+		return err
+	}
+	template.APIVersion = c.APIVersion
+	if c.Schema != "" {
+		template.Schema = c.Schema
+	}
+	if err := template.Validate(); err != nil {
+		return &flags.Error{Type: flags.ErrInvalidChoice, Message: err.Error()}
+	}
+	printTitle("Upgrade templates to API version " + c.APIVersion)
+
+	e := engine.Engine{APIM: apim.APIM{Template: template}}
+	changes, err := e.PlanUpgradeTemplates(c.FilePath)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		color.New(color.FgHiGreen).Println("Templates are up to date")
+		return nil
+	}
+	if c.DryRun {
+		for _, change := range changes {
+			printDiff(change.Diff())
+		}
+		return nil
+	}
+
+	for _, change := range changes {
+		if err := step("Upgrading "+change.Path, change.Apply); err != nil {
+			return err
+		}
+		record := fileRecord("upgrade", change.Path)
+		record.Diff = change.Diff()
+		writeAudit(record)
+	}
+	color.New(color.FgHiBlack).Print("\nSet templates.apiVersion: " + c.APIVersion + " in " + projectConfigFile + " to generate templates of the version\n")
+	return nil
+}
+
+// File name of backends template of format
+func backendsTemplateName(format string) string {
+	if format == apim.TemplateFormatBicep {
+		return "backends.bicep"
+	}
+	return "backends.template.json"
+}
+
+type GraphCommand struct {
+	ServiceOptions
+	Format   string `long:"format" description:"Output format" choice:"dot" choice:"mermaid" choice:"json" default:"dot"`
+	FilePath string `long:"file-path" description:"Output file, default is stdout"`
+}
+
+func (c *GraphCommand) Execute(args []string) error {
+	a, err := newAPIM()
+	if err != nil {
+		return err
+	}
+
+	g, err := a.Graph(c.ResourceGroup, c.ServiceName)
+	if err != nil {
+		return err
+	}
+
+	var out string
+	switch c.Format {
+	case "mermaid":
+		out = g.Mermaid()
+	case "json":
+		if out, err = g.JSON(); err != nil {
+			return err
+		}
+	default:
+		out = g.DOT()
+	}
+
+	if c.FilePath == "" {
+		fmt.Print(out)
+		return nil
+	}
+	return step("Exporting "+c.FilePath, func() error {
+		return os.WriteFile(c.FilePath, []byte(out), 0644)
+	})
+}
+
+type SnapshotCreateCommand struct {
+	ServiceOptions
+	Dir            string `long:"dir" description:"Directory to write the snapshot, it is written to {dir}/{service}-{timestamp}" default:"./snapshots"`
+	Archive        bool   `long:"archive" description:"Write the snapshot as a .tar.gz archive"`
+	IncludeSecrets bool   `long:"include-secrets" description:"Capture values of secret named values, they are written in plain text"`
+}
+
+func (c *SnapshotCreateCommand) Execute(args []string) error {
+	a, err := newAPIM()
+	if err != nil {
+		return err
+	}
+	printTitle("Create snapshot of backends, APIs, policies and named values")
+	start := time.Now()
+
+	var snapshot apim.Snapshot
+	if err := step("Capturing", func() error {
+		snapshot, err = a.CreateSnapshot(c.ResourceGroup, c.ServiceName, c.IncludeSecrets)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	var path string
+	if err := step("Writing", func() error {
+		path, err = apim.WriteSnapshot(snapshot, apim.SnapshotPath(c.Dir, c.ServiceName, snapshot.CreatedAt), c.Archive)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	fmt.Print("\n")
+	printSnapshot(path, snapshot)
+	if c.IncludeSecrets {
+		color.New(color.FgHiYellow).Print("\nSnapshot contains values of secrets, keep it safe\n")
+	}
+	printTimeUsed(start)
+	return nil
+}
+
+type SnapshotRestoreCommand struct {
+	ServiceOptions
+	Path     string   `long:"path" description:"Snapshot directory or .tar.gz archive" required:"true"`
+	Entities []string `long:"entity" description:"Entity to restore, backends, apis, namedvalues, versionsets or {backend|api|namedvalue|versionset}/{id}, can be repeated. Default is all"`
+	DryRunOptions
+}
+
+func (c *SnapshotRestoreCommand) Execute(args []string) error {
+	match, err := apim.MatchEntities(c.Entities)
+	if err != nil {
+		return err
+	}
+	snapshot, err := apim.ReadSnapshot(c.Path)
+	if err != nil {
+		return err
+	}
+	a, err := newAPIM()
+	if err != nil {
+		return err
+	}
+	printTitle("Restore snapshot to Api Management.")
+	printSnapshot(c.Path, snapshot)
+	fmt.Print("\n")
+
+	entities := []string{}
+	for _, entity := range snapshot.Entities() {
+		kind, id, _ := strings.Cut(entity, "/")
+		if match(kind, id) {
+			entities = append(entities, entity)
+		}
+	}
+	if len(entities) == 0 {
+		printNotFound()
+		return nil
+	}
+
+	if c.DryRun {
+		color.New(color.FgHiYellow).Print("Dry run, nothing is restored\n\n")
+		for _, entity := range entities {
+			fmt.Println(entity)
+		}
+		color.New(color.FgHiBlack).Print("\nOperations of restored APIs which are not in the snapshot are deleted\n")
+		return nil
+	}
+	action := fmt.Sprintf("Restore %d entities of snapshot to %s", len(entities), c.ServiceName)
+	if err := confirmService(c.ResourceGroup, c.ServiceName, action); err != nil {
+		return err
+	}
+
+	record := serviceRecord(a, c.ResourceGroup, c.ServiceName, "restore", c.Path)
+	var result apim.RestoreResult
+	err = step("Restoring", func() error {
+		result, err = a.RestoreSnapshot(c.ResourceGroup, c.ServiceName, snapshot, match)
+		return err
+	})
+	// entities restored before a failure are changed, they are recorded either way
+	if len(result.Restored) > 0 || len(result.Deleted) > 0 {
+		record.After = result
+		writeAudit(record)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Print("\n")
+	for _, entity := range result.Restored {
+		color.New(color.FgHiGreen).Print("Restored ")
+		fmt.Println(entity)
+	}
+	for _, entity := range result.Deleted {
+		color.New(color.FgHiRed).Print("Deleted  ")
+		fmt.Println(entity)
+	}
+	for _, entity := range result.Skipped {
+		color.New(color.FgHiYellow).Print("Skipped  ")
+		fmt.Println(entity)
+	}
+	return nil
+}
+
+// Options of building the master deployment of templates
+type TemplateDeploymentOptions struct {
+	FilePath      string   `long:"file-path" description:"Templates directory" default:"./templates"`
+	Name          string   `long:"name" description:"Name of the deployment, default is apimtool-{timestamp}"`
+	LinkedBaseURL string   `long:"linked-base-url" description:"URL where the templates directory is hosted to link templates instead of inlining them, query string (e.g. SAS token) is kept"`
+	Parameters    []string `long:"parameter" description:"Template parameter name=value, can be repeated"`
+}
+
+// Master deployment of the templates directory for the service
+func (o *TemplateDeploymentOptions) deployment(serviceName string) (arm.Deployment, error) {
+	parameters := map[string]string{}
+	for _, parameter := range o.Parameters {
+		name, value, ok := strings.Cut(parameter, "=")
+		if !ok || name == "" {
+			return arm.Deployment{}, &flags.Error{Type: flags.ErrMarshal, Message: "invalid --parameter " + parameter + ", expected name=value"}
+		}
+		parameters[name] = value
+	}
+	if o.Name == "" {
+		o.Name = "apimtool-" + time.Now().UTC().Format("20060102T150405Z")
+	}
+	return arm.BuildDeployment(o.FilePath, arm.DeploymentOptions{
+		Name:          o.Name,
+		ServiceName:   serviceName,
+		Parameters:    parameters,
+		LinkedBaseURL: o.LinkedBaseURL,
+	})
+}
+
+type DeployCommand struct {
+	ServiceOptions
+	TemplateDeploymentOptions
+	DryRunOptions
+}
+
+func (c *DeployCommand) Execute(args []string) error {
+	deployment, err := c.deployment(c.ServiceName)
+	if err != nil {
+		return err
+	}
+	a, err := newAPIM()
+	if err != nil {
+		return err
+	}
+	ar := newARM(a)
+	printTitle("Deploy templates to Api Management with ARM deployment")
+	fmt.Print("Deployment \t: ", deployment.Name, "\nResource Group \t: ", c.ResourceGroup, "\nService \t: ", c.ServiceName, "\n")
+	for _, file := range deployment.Files {
+		fmt.Print("Template \t: ", file, "\n")
+	}
+	fmt.Print("\n")
+
+	var changes []arm.Change
+	if err := step("What-if", func() error {
+		changes, err = ar.WhatIf(c.ResourceGroup, deployment)
+		return err
+	}); err != nil {
+		return err
+	}
+	fmt.Print("\n")
+	printChanges(changes)
+
+	if c.DryRun {
+		color.New(color.FgHiYellow).Print("\nDry run, deployment is not submitted\n")
+		return nil
+	}
+	fmt.Print("\n")
+	if err := confirmService(c.ResourceGroup, c.ServiceName, "Deploy "+strconv.Itoa(len(deployment.Files))+" template(s) to "+c.ServiceName); err != nil {
+		return err
+	}
+
+	record := serviceRecord(a, c.ResourceGroup, c.ServiceName, "deploy", "deployment/"+deployment.Name)
+	record.After = changes
+	start := time.Now()
+	err = ar.Deploy(c.ResourceGroup, deployment, printOperationStatus)
+	if err != nil {
+		record.Action = "deploy-failed"
+	}
+	writeAudit(record)
+
+	var deploymentErr *arm.DeploymentError
+	if errors.As(err, &deploymentErr) {
+		printDeploymentFailures(deploymentErr)
+	}
+	if err != nil {
+		return err
+	}
+	color.New(color.FgHiGreen).Print("\nDeployment " + deployment.Name + " succeeded\n")
+	printTimeUsed(start)
+	return nil
+}
+
+type TemplateWhatIfCommand struct {
+	ResourceGroup string `short:"g" long:"resource-group" description:"Resource group, required unless --from-file"`
+	ServiceName   string `short:"n" long:"service-name" description:"Name of API Management service, required unless --from-file"`
+	TemplateDeploymentOptions
+	FromFile string `long:"from-file" description:"Render a saved what-if response of ARM instead of submitting the templates"`
+	Format   string `long:"format" description:"Output format" choice:"text" choice:"json" choice:"markdown" default:"text"`
+	Output   string `long:"output" description:"File to write json or markdown output, default is stdout"`
+}
+
+func (c *TemplateWhatIfCommand) Execute(args []string) error {
+	title := "What-if of " + c.FilePath
+	var changes []arm.Change
+
+	if c.FromFile != "" {
+		data, err := os.ReadFile(c.FromFile)
+		if err != nil {
+			return apim.NewError(apim.ErrNotFound, c.FromFile+" not found", err)
+		}
+		if changes, err = arm.ParseWhatIf(data); err != nil {
+			return err
+		}
+		title = "What-if of " + c.FromFile
+	} else {
+		if c.ResourceGroup == "" || c.ServiceName == "" {
+			return &flags.Error{Type: flags.ErrRequired, Message: "--resource-group and --service-name are required unless --from-file"}
+		}
+		deployment, err := c.deployment(c.ServiceName)
+		if err != nil {
+			return err
+		}
+		a, err := newAPIM()
+		if err != nil {
+			return err
+		}
+		title = "What-if of " + c.FilePath + " on " + c.ResourceGroup + "/" + c.ServiceName
+		if c.Format == "text" {
+			printTitle(title)
+			if err := step("What-if", func() error {
+				changes, err = newARM(a).WhatIf(c.ResourceGroup, deployment)
+				return err
+			}); err != nil {
+				return err
+			}
+			fmt.Print("\n")
+		} else if changes, err = newARM(a).WhatIf(c.ResourceGroup, deployment); err != nil {
+			return err
+		}
+	}
+
+	var out string
+	switch c.Format {
+	case "json":
+		data, err := json.MarshalIndent(changes, "", "  ")
+		if err != nil {
+			return err
+		}
+		out = string(data) + "\n"
+	case "markdown":
+		out = changesMarkdown(title, changes)
+	default:
+		printChanges(changes)
+		return nil
+	}
+
+	if c.Output == "" {
+		fmt.Print(out)
+		return nil
+	}
+	return step("Writing "+c.Output, func() error {
+		return os.WriteFile(c.Output, []byte(out), 0644)
+	})
+}
+
+// Returned by template validate when templates have issues, to fail pipelines
+var errInvalid = errors.New("templates are invalid")
+
+type TemplateValidateCommand struct {
+	FilePath string `long:"file-path" description:"Templates directory or a template file" default:"./templates"`
+	Format   string `long:"format" description:"Output format" choice:"text" choice:"json" default:"text"`
+}
+
+func (c *TemplateValidateCommand) Execute(args []string) error {
+	report, err := engine.ValidateTemplates(c.FilePath)
+	if err != nil {
+		return err
+	}
+	if c.Format == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		printTitle("Validate templates {" + c.FilePath + "}")
+		printValidationReport(report)
+	}
+
+	if len(report.Issues) > 0 {
+		return errInvalid
+	}
+	return nil
+}
+
+// Returned by diff when the two sides are different, to fail scripts which expect them equivalent
+var errDifferent = errors.New("differences found")
+
+type DiffCommand struct {
+	ResourceGroup string `short:"g" long:"resource-group" description:"Resource group of live service as side A"`
+	ServiceName   string `short:"n" long:"service-name" description:"Name of live service as side A"`
+	IgnoreURLs    bool   `long:"ignore-urls" description:"Ignore backend URLs and serviceUrl of APIs, e.g. to compare environments"`
+	Format        string `long:"format" description:"Output format" choice:"text" choice:"json" default:"text"`
+	Args          struct {
+		A string `positional-arg-name:"a" description:"Side A: apim://{resource-group}/{service-name}, snapshot directory or archive, or templates directory"`
+		B string `positional-arg-name:"b" description:"Side B, same as side A"`
+	} `positional-args:"yes"`
+}
+
+func (c *DiffCommand) Execute(args []string) error {
+	sides := []string{}
+	if c.ResourceGroup != "" || c.ServiceName != "" {
+		if c.ResourceGroup == "" || c.ServiceName == "" {
+			return &flags.Error{Type: flags.ErrRequired, Message: "both --resource-group and --service-name are required for a live service"}
+		}
+		sides = append(sides, "apim://"+c.ResourceGroup+"/"+c.ServiceName)
+	}
+	for _, side := range []string{c.Args.A, c.Args.B} {
+		if side != "" {
+			sides = append(sides, side)
+		}
+	}
+	if len(sides) != 2 {
+		return &flags.Error{Type: flags.ErrRequired, Message: "two sides are required, e.g. apimtool diff apim://rg/dev apim://rg/prod"}
+	}
+
+	states := make([]apim.State, 2)
+	for i, side := range sides {
+		state, err := loadState(side)
+		if err != nil {
+			return err
+		}
+		states[i] = state
+	}
+
+	differences := apim.Compare(states[0], states[1], apim.CompareOptions{IgnoreURLs: c.IgnoreURLs})
+	if c.Format == "json" {
+		data, err := json.MarshalIndent(struct {
+			A           string            `json:"a"`
+			B           string            `json:"b"`
+			Differences []apim.Difference `json:"differences"`
+		}{states[0].Source, states[1].Source, differences}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		printDifferences(states[0].Source, states[1].Source, differences)
+	}
+
+	if len(differences) > 0 {
+		return errDifferent
+	}
+	return nil
+}
+
+// State of a side of diff, live service of apim://{resource-group}/{service-name}, snapshot or templates directory
+func loadState(side string) (apim.State, error) {
+	if strings.HasPrefix(side, "apim://") {
+		resourceGroup, serviceName, ok := strings.Cut(strings.TrimPrefix(side, "apim://"), "/")
+		if !ok || resourceGroup == "" || serviceName == "" {
+			return apim.State{}, &flags.Error{Type: flags.ErrInvalidChoice, Message: "invalid service " + side + ", expected apim://{resource-group}/{service-name}"}
+		}
+		a, err := newAPIM()
+		if err != nil {
+			return apim.State{}, err
+		}
+		return a.State(resourceGroup, serviceName)
+	}
+
+	info, err := os.Stat(side)
+	if err != nil {
+		return apim.State{}, apim.NewError(apim.ErrNotFound, side+" not found", err)
+	}
+	if _, err := os.Stat(filepath.Join(side, "manifest.json")); !info.IsDir() || err == nil {
+		snapshot, err := apim.ReadSnapshot(side)
+		if err != nil {
+			return apim.State{}, err
+		}
+		state := apim.SnapshotState(snapshot)
+		state.Source = side
+		return state, nil
+	}
+	return engine.TemplateState(side)
+}
+
+// group of sub commands without execution of its own
+type group struct{}
+
+func addCommand(parent *flags.Command, command, shortDescription, longDescription string, data interface{}) *flags.Command {
+	cmd, err := parent.AddCommand(command, shortDescription, longDescription, data)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot add command " + command)
+	}
+	return cmd
+}
+
+func addCommands(parser *flags.Parser) {
+	root := parser.Command
+
+	addCommand(root, "parse", "Parsing Configuration files to Source files to support Azure API Management DevOps Resource Kit",
+		"Parsing Configuration files to Source files to support Azure API Management DevOps Resource Kit,\n"+
+			"please refer https://github.com/Azure/azure-api-management-devops-resource-kit\n\n"+
+			"the directories and config files are required: ./apim-apis-{env}/{api-id}/{api-id}.json ./sources/ ./templates/backends.template.json or use --file-path\n\n"+
+			"Examples:\n"+
+			"  apimtool parse -g myresourcegroup -n myservice --env dev --api-id api-name-id\n"+
+			"  apimtool parse -g myresourcegroup -n myservice --env dev --api-id api-name-id --file-path ./path-to-api/api.json\n"+
+			"  apimtool parse -g myresourcegroup -n myservice --env dev --all\n"+
+			"  apimtool parse -g myresourcegroup -n myservice --env dev --api-id 'payment-*'",
+		&ParseCommand{})
+
+	apimCmd := addCommand(root, "apim", "Manage Azure API Management services", "Manage Azure API Management services.", &group{})
+
+	apiCmd := addCommand(apimCmd, "api", "Manage APIs", "Manage APIs of Azure API Management.", &group{})
+	addCommand(apiCmd, "list", "List APIs",
+		"List all API on Azure API Management.\n\n"+
+			"Examples:\n"+
+			"  apimtool apim api list -g myresourcegroup -n myservice\n"+
+			"  apimtool apim api list -g myresourcegroup -n myservice --filter-display-name myfilterdisplay --option list",
+		&APIListCommand{})
+
+	revisionCmd := addCommand(apiCmd, "revision", "Manage API revisions", "Manage revisions of an API.", &group{})
+	addCommand(revisionCmd, "list", "List API revisions",
+		"List all revisions of an API, the current revision is highlighted.\n\n"+
+			"Examples:\n"+
+			"  apimtool apim api revision list -g myresourcegroup -n myservice --api-id api-name-id",
+		&APIRevisionListCommand{})
+	addCommand(revisionCmd, "create", "Create a new API revision from the parsed config",
+		"Create a new revision of the source files generated by parse (config.yml, policy and operations), the revision number is the next of the latest revision.\n\n"+
+			"Examples:\n"+
+			"  apimtool apim api revision create -g myresourcegroup -n myservice --api-id api-name-id --description \"my change\"",
+		&APIRevisionCreateCommand{})
+	addCommand(revisionCmd, "release", "Make an API revision current",
+		"Make a revision current by creating a release with release note.\n\n"+
+			"Examples:\n"+
+			"  apimtool apim api revision release -g myresourcegroup -n myservice --api-id api-name-id --revision 2 --notes \"release note\"",
+		&APIRevisionReleaseCommand{})
+
+	versionSetCmd := addCommand(apiCmd, "versionset", "Manage API version sets", "Manage API version sets.", &group{})
+	addCommand(versionSetCmd, "list", "List API version sets",
+		"List all API version sets.\n\n"+
+			"Examples:\n"+
+			"  apimtool apim api versionset list -g myresourcegroup -n myservice",
+		&APIVersionSetListCommand{})
+
+	backendCmd := addCommand(apimCmd, "backend", "Manage backends", "Manage backends of Azure API Management.", &group{})
+	addCommand(backendCmd, "list", "List backends",
+		"List of all Backends from API management.\n\n"+
+			"Examples:\n"+
+			"  apimtool apim backend list -g myresourcegroup -n myservice\n"+
+			"  apimtool apim backend list -g myresourcegroup -n myservice --filter-display-name myfilterdisplay --option list",
+		&BackendListCommand{})
+	addCommand(backendCmd, "create", "Create a backend",
+		"Create or update backend URL directly to APIM (not update at backends.template.json) and check duplication before created.\n\n"+
+			"Examples:\n"+
+			"  apimtool apim backend create -g myresourcegroup -n myservice --backend-id my-backend-id --url https://127.0.0.1:8081 --protocol http",
+		&BackendCreateCommand{})
+	addCommand(backendCmd, "audit", "Report orphan, duplicate, mismatched and missing backends",
+		"Report backends on APIM and in backends.template.json against the set-backend-service policy of APIs on APIM.\n\n"+
+			"Examples:\n"+
+			"  apimtool apim backend audit -g myresourcegroup -n myservice\n"+
+			"  apimtool apim backend audit -g myresourcegroup -n myservice --file-path ./templates/backends.template.json",
+		&BackendAuditCommand{})
+
+	backendAPICmd := addCommand(backendCmd, "api", "Manage APIs of backends", "Manage APIs of backends.", &group{})
+	dependCmd := addCommand(backendAPICmd, "depend", "APIs depending on backend", "APIs depending on backend.", &group{})
+	addCommand(dependCmd, "list", "List APIs depending on backend",
+		"List APIs which set-backend-service policy is the backend, --backend-id or --url is required.\n\n"+
+			"Examples:\n"+
+			"  apimtool apim backend api depend list -g myresourcegroup -n myservice --backend-id mybackend-id\n"+
+			"  apimtool apim backend api depend list -g myresourcegroup -n myservice --url https://127.0.0.1",
+		&BackendAPIDependListCommand{})
+
+	templateCmd := addCommand(root, "template", "Manage template files configuration to support Azure Resource Manager template",
+		"Manage template files configuration to support Azure Resource Manager template.", &group{})
+	templateBackendCmd := addCommand(templateCmd, "backend", "Manage backends.template.json", "Manage backends in backends.template.json.", &group{})
+	addCommand(templateBackendCmd, "export", "Export backends.template.json from APIM",
+		"Export configuration and create backends.template.json from source APIM, or backends.bicep with --format bicep.\n\n"+
+			"Examples:\n"+
+			"  apimtool template backend export -g myresourcegroup -n myservice\n"+
+			"  apimtool template backend export -g myresourcegroup -n myservice --file-path ./templates/\n"+
+			"  apimtool template backend export -g myresourcegroup -n myservice --file-path ./templates/ --format bicep",
+		&TemplateBackendExportCommand{})
+	addCommand(templateBackendCmd, "create", "Add a backend into backends.template.json",
+		"Add backend into backends.template.json and check validate IP target.\n"+
+			"the directories and config files are required: ./templates/backends.template.json\n\n"+
+			"Examples:\n"+
+			"  apimtool template backend create --backend-id my-backend-id --url https://127.0.0.1:8081 --protocol http\n"+
+			"  apimtool template backend create --backend-id my-backend-id --url https://127.0.0.1:8081 --protocol http --format bicep",
+		&TemplateBackendCreateCommand{})
+	addCommand(templateBackendCmd, "delete", "Delete a backend from backends.template.json",
+		"Delete backend from backends.template.json.\n"+
+			"the directories and config files are required: ./templates/backends.template.json\n\n"+
+			"Examples:\n"+
+			"  apimtool template backend delete --backend-id my-backend-id\n"+
+			"  apimtool template backend delete --backend-id my-backend-id --format bicep",
+		&TemplateBackendDeleteCommand{})
+
+	templateAPICmd := addCommand(templateCmd, "api", "Manage API templates", "Manage templates of APIs with their operations and policies.", &group{})
+	addCommand(templateAPICmd, "export", "Export template of an API from APIM",
+		"Export API with its policy, operations and operation policies from source APIM to {api-id}.template.json,\n"+
+			"or {api-id}.bicep with --format bicep where operations and policies are nested child resources of the API.\n\n"+
+			"Examples:\n"+
+			"  apimtool template api export -g myresourcegroup -n myservice --api-id echo-api\n"+
+			"  apimtool template api export -g myresourcegroup -n myservice --api-id echo-api --format bicep --file-path ./bicep",
+		&TemplateAPIExportCommand{})
+
+	snapshotCmd := addCommand(root, "snapshot", "Backup and restore of APIM to a local snapshot",
+		"Backup and restore of backends, APIs, operations, policies and named values to a local snapshot.", &group{})
+	addCommand(snapshotCmd, "create", "Capture a snapshot of APIM",
+		"Capture backends, APIs, operations, API and operation policies and named values into a versioned directory or archive.\n"+
+			"Values of secret named values are not captured unless --include-secrets.\n\n"+
+			"Examples:\n"+
+			"  apimtool snapshot create -g myresourcegroup -n myservice\n"+
+			"  apimtool snapshot create -g myresourcegroup -n myservice --dir ./backup --archive",
+		&SnapshotCreateCommand{})
+	addCommand(snapshotCmd, "restore", "Restore a snapshot to APIM",
+		"Reapply a snapshot to APIM, all entities or the entities of --entity.\n\n"+
+			"Examples:\n"+
+			"  apimtool snapshot restore -g myresourcegroup -n myservice --path ./snapshots/myservice-20240101T000000Z\n"+
+			"  apimtool snapshot restore -g myresourcegroup -n myservice --path ./backup.tar.gz --entity backends --entity api/echo-api --dry-run",
+		&SnapshotRestoreCommand{})
+
+	addCommand(root, "deploy", "Deploy templates with ARM deployment",
+		"Deploy backends.template.json and generated API templates of the templates directory as a master deployment\n"+
+			"with a nested deployment per template. ARM what-if is run first, then the deployment is submitted after confirmation\n"+
+			"and the status of each resource is reported until it is done.\n\n"+
+			"Examples:\n"+
+			"  apimtool deploy -g myresourcegroup -n myservice --file-path ./templates\n"+
+			"  apimtool deploy -g myresourcegroup -n myservice --dry-run\n"+
+			"  apimtool deploy -g myresourcegroup -n myservice --linked-base-url \"https://mystorage.blob.core.windows.net/templates?sv=...\"",
+		&DeployCommand{})
+
+	addCommand(root, "diff", "Compare two services, snapshots or templates",
+		"Report semantic differences in backends (URL, protocol, TLS), APIs (path, protocols, serviceUrl), operations (method, URL template)\n"+
+			"and policies (XML-normalized) between side A and side B. A side is a live service apim://{resource-group}/{service-name} or -g/-n,\n"+
+			"a snapshot directory or archive, or a templates directory. Exit code is 10 when there are differences.\n\n"+
+			"Examples:\n"+
+			"  apimtool diff apim://rg-dev/apim-dev apim://rg-prod/apim-prod --ignore-urls\n"+
+			"  apimtool diff -g myresourcegroup -n myservice ./snapshots/myservice-20240101T000000Z\n"+
+			"  apimtool diff ./snapshots/myservice-20240101T000000Z ./templates --format json",
+		&DiffCommand{})
+
+	addCommand(root, "ui", "Browse APIs, backends and dependencies interactively",
+		"Interactive terminal UI of APIs and backends with search, operations and policy XML, APIs depending on a backend,\n"+
+			"rebind of the backend of an API and export of backends.template.json with confirmation.\n\n"+
+			"Examples:\n"+
+			"  apimtool ui -g myresourcegroup -n myservice",
+		&UICommand{})
+
+	addCommand(templateCmd, "validate", "Validate templates offline",
+		"Check backends.template.json and generated templates (*.template.json) without Azure: schema of deployment template,\n"+
+			"resource names, unique backend IDs and URLs per protocol, backend URLs and protocols (http/soap), one apiVersion per\n"+
+			"resource type and parameters referenced but not declared. Exit code is 11 when there are issues.\n\n"+
+			"Examples:\n"+
+			"  apimtool template validate\n"+
+			"  apimtool template validate --file-path ./templates/backends.template.json --format json",
+		&TemplateValidateCommand{})
+
+	addCommand(templateCmd, "upgrade", "Upgrade templates to a newer API version",
+		"Rewrite apiVersion of Microsoft.ApiManagement resources of *.template.json and *.bicep, and $schema of *.template.json,\n"+
+			"in place keeping the format of the files. Templates of a newer API version are not downgraded.\n"+
+			"Supported API versions: "+strings.Join(apim.TemplateAPIVersions, ", ")+"\n\n"+
+			"Examples:\n"+
+			"  apimtool template upgrade --api-version 2021-08-01 --dry-run\n"+
+			"  apimtool template upgrade --api-version 2022-08-01 --file-path ./templates/backends.template.json",
+		&TemplateUpgradeCommand{})
+
+	addCommand(templateCmd, "whatif", "Preview changes of templates with ARM what-if",
+		"Submit the templates directory to ARM what-if and render Create, Modify, Delete and NoChange per resource\n"+
+			"with property changes, policy XML is shown as a diff of the normalized policies. --from-file renders a saved\n"+
+			"what-if response, e.g. of az deployment group what-if --no-pretty-print.\n\n"+
+			"Examples:\n"+
+			"  apimtool template whatif -g myresourcegroup -n myservice --file-path ./templates\n"+
+			"  apimtool template whatif -g myresourcegroup -n myservice --format markdown --output whatif.md\n"+
+			"  apimtool template whatif --from-file ./whatif.json",
+		&TemplateWhatIfCommand{})
+
+	addCommand(root, "graph", "Export dependency graph of products, APIs, operations and backends",
+		"Export relationship graph of products, APIs, operations, backends and backend hosts as Graphviz DOT, Mermaid or JSON.\n\n"+
+			"Examples:\n"+
+			"  apimtool graph -g myresourcegroup -n myservice\n"+
+			"  apimtool graph -g myresourcegroup -n myservice --format mermaid --file-path ./apim.mmd",
+		&GraphCommand{})
+
+	addCommand(root, "completion", "Generate shell completion script",
+		"Generate completion script for bash, zsh or fish. Backend IDs and API IDs are completed from the service of --resource-group and --service-name.\n\n"+
+			"Examples:\n"+
+			"  source <(apimtool completion bash)\n"+
+			"  apimtool completion zsh > \"${fpath[1]}/_apimtool\"\n"+
+			"  apimtool completion fish > ~/.config/fish/completions/apimtool.fish",
+		&CompletionCommand{})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/tarathep/apimtool/apim"
+	"github.com/tarathep/apimtool/engine"
+)
+
+const bashCompletion = `# bash completion for apimtool
+_apimtool() {
+	local args=("${COMP_WORDS[@]:1:$COMP_CWORD}")
+	local IFS=$'\n'
+	COMPREPLY=($(GO_FLAGS_COMPLETION=1 ${COMP_WORDS[0]} "${args[@]}"))
+	return 0
+}
+complete -F _apimtool apimtool
+`
+
+const zshCompletion = `#compdef apimtool
+# zsh completion for apimtool
+_apimtool() {
+	local -a completions
+	completions=("${(@f)$(GO_FLAGS_COMPLETION=1 ${words[1]} "${(@)words[2,$CURRENT]}")}")
+	compadd -a completions
+}
+compdef _apimtool apimtool
+`
+
+const fishCompletion = `# fish completion for apimtool
+function __apimtool_complete
+	set -l args (commandline -opc)[2..-1] (commandline -ct)
+	GO_FLAGS_COMPLETION=1 apimtool $args
+end
+complete -c apimtool -f -a '(__apimtool_complete)'
+`
+
+type CompletionCommand struct {
+	Args struct {
+		Shell string `positional-arg-name:"shell" description:"bash, zsh or fish"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *CompletionCommand) Execute(args []string) error {
+	switch c.Args.Shell {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print(zshCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+	default:
+		return &flags.Error{Type: flags.ErrInvalidChoice, Message: "Invalid value `" + c.Args.Shell + "' for argument `shell'. Allowed values are: bash, zsh or fish"}
+	}
+	return nil
+}
+
+// Backend ID on APIM, completed from the service of --resource-group and --service-name
+type backendID string
+
+func (backendID) Complete(match string) []flags.Completion {
+	a, resourceGroup, serviceName, cancel, ok := completionAPIM()
+	if !ok {
+		return nil
+	}
+	defer cancel()
+
+	index, err := a.BackendIndex(resourceGroup, serviceName)
+	if err != nil {
+		return nil
+	}
+
+	ids := []string{}
+	for _, backend := range index.Backends {
+		ids = append(ids, backend.Name)
+	}
+	return completions(ids, match)
+}
+
+// API ID on APIM, completed from the service of --resource-group and --service-name
+type apiID string
+
+func (apiID) Complete(match string) []flags.Completion {
+	a, resourceGroup, serviceName, cancel, ok := completionAPIM()
+	if !ok {
+		return nil
+	}
+	defer cancel()
+
+	names, err := a.APINames(resourceGroup, serviceName)
+	if err != nil {
+		return nil
+	}
+	return completions(names, match)
+}
+
+// Backend ID in ./templates/backends.template.json or ./templates/backends.bicep
+type templateBackendID string
+
+func (templateBackendID) Complete(match string) []flags.Completion {
+	ids := engine.TemplateBackendIDs("./templates/backends.template.json")
+	if content, err := os.ReadFile(apim.BackendsBicepPath("./templates")); err == nil {
+		for _, backend := range apim.BicepBackends(string(content)) {
+			ids = append(ids, backend.Name)
+		}
+	}
+	return completions(ids, match)
+}
+
+func completions(items []string, match string) []flags.Completion {
+	ret := []flags.Completion{}
+	for _, item := range items {
+		if strings.HasPrefix(item, match) {
+			ret = append(ret, flags.Completion{Item: item})
+		}
+	}
+	return ret
+}
+
+// APIM client for completion, options are not parsed while completing so -g/-n are read from the command line
+// and backends are cached for 5 minutes to keep completion responsive
+func completionAPIM() (apim.APIM, string, string, context.CancelFunc, bool) {
+	resourceGroup := argValue(os.Args[1:], "g", "resource-group")
+	serviceName := argValue(os.Args[1:], "n", "service-name")
+	subscriptionID := os.Getenv("APIMTOOL_AZURE_SUBSCRIPTION_ID")
+
+	if resourceGroup == "" || serviceName == "" || subscriptionID == "" {
+		return apim.APIM{}, "", "", nil, false
+	}
+
+	// options are not parsed, authenticate with environment variables
+	cred, cloud, err := newCredential(AuthOptions{
+		Method:             os.Getenv("APIMTOOL_AUTH"),
+		TenantID:           os.Getenv("AZURE_TENANT_ID"),
+		ClientID:           os.Getenv("AZURE_CLIENT_ID"),
+		CertificatePath:    os.Getenv("AZURE_CLIENT_CERTIFICATE_PATH"),
+		FederatedTokenFile: os.Getenv("AZURE_FEDERATED_TOKEN_FILE"),
+		Cloud:              os.Getenv("APIMTOOL_AZURE_CLOUD"),
+	})
+	if err != nil {
+		return apim.APIM{}, "", "", nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+
+	return apim.APIM{
+		SubscriptionID: subscriptionID,
+		Location:       os.Getenv("APIMTOOL_AZURE_LOCATION"),
+		Credential:     cred,
+		Cloud:          cloud,
+		Context:        ctx,
+		Cache:          5 * time.Minute,
+	}, resourceGroup, serviceName, cancel, true
+}
+
+// Value of option -{short} or --{long} in args
+func argValue(args []string, short, long string) string {
+	for i, arg := range args {
+		switch {
+		case arg == "-"+short || arg == "--"+long:
+			if i+1 < len(args) {
+				return args[i+1]
+			}
+		case strings.HasPrefix(arg, "--"+long+"="):
+			return strings.TrimPrefix(arg, "--"+long+"=")
+		case strings.HasPrefix(arg, "-"+short) && !strings.HasPrefix(arg, "--") && len(arg) > len(short)+1:
+			return strings.TrimPrefix(arg, "-"+short)
+		}
+	}
+	return ""
+}
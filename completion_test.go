@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompletionCommand(t *testing.T) {
+	tests := []struct {
+		shell string
+		want  string
+		code  int
+	}{
+		{"bash", "complete -F _apimtool apimtool", ExitOK},
+		{"zsh", "compdef _apimtool apimtool", ExitOK},
+		{"fish", "complete -c apimtool", ExitOK},
+		{"powershell", "", ExitUsage},
+	}
+	for _, tt := range tests {
+		c := &CompletionCommand{}
+		c.Args.Shell = tt.shell
+		var err error
+		out := captureOutput(t, func() { err = c.Execute(nil) })
+		if _, code := errorClass(err); code != tt.code {
+			t.Errorf("completion %s: exit code %d (%v), want %d", tt.shell, code, err, tt.code)
+		}
+		if !strings.Contains(out, tt.want) {
+			t.Errorf("completion %s printed %q, want %q", tt.shell, out, tt.want)
+		}
+	}
+}
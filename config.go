@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/tarathep/apimtool/apim"
+	"github.com/tarathep/apimtool/engine"
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration of apimtool, read from $APIMTOOL_CONFIG or {user config dir}/apimtool/config.yml
+type Config struct {
+	// services which require --allow-production and typed confirmation of the service name to change
+	Protected []ProtectedService `yaml:"protected"`
+
+	Audit AuditConfig `yaml:"audit"`
+
+	Templates TemplatesConfig `yaml:"templates"`
+
+	Backends BackendsConfig `yaml:"backends"`
+}
+
+// Backends created by parse --create-missing-backends
+type BackendsConfig struct {
+	// naming convention of backend IDs with placeholders {scheme}, {host}, {port} and {apiname}, default {host}-{port}
+	Naming string `yaml:"naming"`
+
+	Prefer BackendPreferenceConfig `yaml:"prefer"`
+}
+
+// Selection of the backend of an API when its backend URL is used by more than one backend
+type BackendPreferenceConfig struct {
+	// backends of the protocol are kept
+	Protocol string `yaml:"protocol"`
+	// patterns of backend IDs (path.Match), the first matching one backend selects it
+	Names []string `yaml:"names"`
+	// fail instead of selecting the first backend ID
+	Strict bool `yaml:"strict"`
+}
+
+// API version of resources and deployment template schema of generated templates, defaults of apim package when empty
+type TemplatesConfig struct {
+	APIVersion string `yaml:"apiVersion"`
+	Schema     string `yaml:"schema"`
+}
+
+// Config of the project in the working directory, e.g. the repository of templates. Its templates override the config
+const projectConfigFile = ".apimtool.yml"
+
+// Audit log of changes, file is {user config dir}/apimtool/audit.jsonl by default
+type AuditConfig struct {
+	File string `yaml:"file"`
+	// URL which every record is posted to as JSON
+	Sink string `yaml:"sink"`
+}
+
+// Service matched by patterns (path.Match) of resource group and service name, empty matches any
+type ProtectedService struct {
+	ResourceGroup string `yaml:"resourceGroup"`
+	ServiceName   string `yaml:"serviceName"`
+}
+
+// Path of the config file
+func configPath() string {
+	if p := os.Getenv("APIMTOOL_CONFIG"); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "apimtool", "config.yml")
+}
+
+// Load config, empty config if the file does not exist
+func loadConfig() (Config, error) {
+	config := Config{}
+
+	p := configPath()
+	if p == "" {
+		return config, nil
+	}
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	return config, yaml.Unmarshal(data, &config)
+}
+
+// Template options of --template-api-version and --template-schema, then of the project config, then of the config
+func templateOptions() (apim.TemplateOptions, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return apim.TemplateOptions{}, err
+	}
+	template := apim.TemplateOptions{APIVersion: config.Templates.APIVersion, Schema: config.Templates.Schema}
+
+	project, err := loadProjectConfig()
+	if err != nil {
+		return template, err
+	}
+	if project.Templates.APIVersion != "" {
+		template.APIVersion = project.Templates.APIVersion
+	}
+	if project.Templates.Schema != "" {
+		template.Schema = project.Templates.Schema
+	}
+	if err := template.Validate(); err != nil {
+		return template, fmt.Errorf("templates of config: %w", err)
+	}
+
+	if options.TemplateAPIVersion != "" {
+		template.APIVersion = options.TemplateAPIVersion
+	}
+	if options.TemplateSchema != "" {
+		template.Schema = options.TemplateSchema
+	}
+	if err := template.Validate(); err != nil {
+		return template, &flags.Error{Type: flags.ErrInvalidChoice, Message: err.Error()}
+	}
+	return template, nil
+}
+
+// Load config of the project, empty config if the file does not exist
+func loadProjectConfig() (Config, error) {
+	project := Config{}
+	data, err := os.ReadFile(projectConfigFile)
+	if err != nil && !os.IsNotExist(err) {
+		return project, err
+	}
+	if err := yaml.Unmarshal(data, &project); err != nil {
+		return project, fmt.Errorf("cannot parse %s: %w", projectConfigFile, err)
+	}
+	return project, nil
+}
+
+// Naming convention of created backend IDs of the flag, then of the project config, then of the config
+func backendNaming(flag string) (string, error) {
+	if flag != "" {
+		return flag, nil
+	}
+	project, err := loadProjectConfig()
+	if err != nil {
+		return "", err
+	}
+	if project.Backends.Naming != "" {
+		return project.Backends.Naming, nil
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return "", err
+	}
+	return config.Backends.Naming, nil
+}
+
+// Backend preference of the project config, or else of the config
+func backendPreference() (engine.BackendPreference, error) {
+	project, err := loadProjectConfig()
+	if err != nil {
+		return engine.BackendPreference{}, err
+	}
+	prefer := project.Backends.Prefer
+	if prefer.Protocol == "" && len(prefer.Names) == 0 && !prefer.Strict {
+		config, err := loadConfig()
+		if err != nil {
+			return engine.BackendPreference{}, err
+		}
+		prefer = config.Backends.Prefer
+	}
+	preference := engine.BackendPreference{Protocol: prefer.Protocol, Names: prefer.Names, Strict: prefer.Strict}
+	if err := preference.Validate(); err != nil {
+		return preference, fmt.Errorf("backends of config: %w", err)
+	}
+	return preference, nil
+}
+
+// Is the service protected
+func (c Config) IsProtected(resourceGroup, serviceName string) bool {
+	for _, p := range c.Protected {
+		if p.ResourceGroup == "" && p.ServiceName == "" {
+			continue
+		}
+		if matchName(p.ResourceGroup, resourceGroup) && matchName(p.ServiceName, serviceName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Azure resource names are case-insensitive
+func matchName(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+	return ok
+}
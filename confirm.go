@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/tarathep/apimtool/apim"
+)
+
+var (
+	errAborted   = errors.New("aborted by user")
+	errProtected = errors.New("protected service")
+)
+
+var (
+	stdin    = bufio.NewReader(os.Stdin)
+	chooseMu sync.Mutex
+)
+
+func readLine() string {
+	line, _ := stdin.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// Ask to proceed with the action, skipped by -y/--confirm
+func confirm(action string) error {
+	if options.Confirm {
+		return nil
+	}
+	color.New(color.FgHiYellow).Print(action + ", proceed? [y/N] ")
+	switch strings.ToLower(readLine()) {
+	case "y", "yes":
+		return nil
+	}
+	return errAborted
+}
+
+// Guard of changes on the service, a protected service requires --allow-production and
+// the service name typed (not skipped by -y), other services are not asked
+func protectService(resourceGroup, serviceName, action string) (bool, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return false, fmt.Errorf("cannot load config %s: %w", configPath(), err)
+	}
+	if !config.IsProtected(resourceGroup, serviceName) {
+		return false, nil
+	}
+
+	if !options.AllowProduction {
+		return true, fmt.Errorf("%w %s/%s, use --allow-production to change", errProtected, resourceGroup, serviceName)
+	}
+	color.New(color.FgHiRed, color.Bold).Print(serviceName + " is a protected service\n")
+	color.New(color.FgHiYellow).Print(action + ", type the service name to confirm: ")
+	if readLine() != serviceName {
+		return true, errAborted
+	}
+	return true, nil
+}
+
+// Guard of changes on the service by protectService, other services are asked to proceed
+func confirmService(resourceGroup, serviceName, action string) error {
+	protected, err := protectService(resourceGroup, serviceName, action)
+	if protected || err != nil {
+		return err
+	}
+	return confirm(action)
+}
+
+// Ask which backend of candidates to use for the API, prompts of concurrent parses are asked one at a time
+func chooseBackend(apiname string, candidates []apim.Backend) (string, error) {
+	chooseMu.Lock()
+	defer chooseMu.Unlock()
+
+	color.New(color.FgHiYellow).Print("Backend URL of API " + apiname + " is used by more than one backend\n")
+	for i, backend := range candidates {
+		fmt.Printf("  %d) %s (%s %s)\n", i+1, backend.Name, backend.URL, backend.Protocol)
+	}
+	color.New(color.FgHiYellow).Printf("Select backend [1-%d]: ", len(candidates))
+	n, err := strconv.Atoi(readLine())
+	if err != nil || n < 1 || n > len(candidates) {
+		return "", errAborted
+	}
+	return candidates[n-1].Name, nil
+}
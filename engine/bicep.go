@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/tarathep/apimtool/apim"
+)
+
+// Change of backends.bicep to add backend, without writing the file.
+// ErrDuplicateURL or ErrDuplicateID if the backend already exists, same checks as backends.template.json
+func (e Engine) PlanAddBackendBicep(backendID, backendURL, protocol string) (FileChange, error) {
+	pathBackend := apim.BackendsBicepPath("./templates")
+	before, err := os.ReadFile(pathBackend)
+	if err != nil {
+		return FileChange{}, apim.NewError(apim.ErrNotFound, pathBackend+" not found", err)
+	}
+
+	if _, err := url.Parse(backendURL); err != nil {
+		return FileChange{}, fmt.Errorf("error on parsing URL backend %s: %w", backendURL, err)
+	}
+
+	for _, backend := range apim.BicepBackends(string(before)) {
+		if apim.MatchURL(backend.URL, backendURL, apim.URLMatchExact) {
+			return FileChange{}, apim.NewError(apim.ErrDuplicateURL, "backend URL is using on backend-id ("+backend.Name+") at backends.bicep", nil)
+		}
+		if backend.Name == backendID {
+			return FileChange{}, apim.NewError(apim.ErrDuplicateID, "duplicate backend id "+backendID, nil)
+		}
+	}
+
+	after := e.Template.AppendBackendBicep(string(before), apim.Backend{Name: backendID, URL: backendURL, Protocol: protocol})
+	return FileChange{Path: pathBackend, Before: before, After: []byte(after)}, nil
+}
+
+// Change of backends.bicep to delete backend, without writing the file. ErrNotFound if the backend does not exist
+func (Engine) PlanDeleteBackendBicepByID(backendID string) (FileChange, error) {
+	pathBackend := apim.BackendsBicepPath("./templates")
+	before, err := os.ReadFile(pathBackend)
+	if err != nil {
+		return FileChange{}, apim.NewError(apim.ErrNotFound, pathBackend+" not found", err)
+	}
+
+	after, found := apim.RemoveBackendBicep(string(before), backendID)
+	if !found {
+		return FileChange{}, apim.NewError(apim.ErrNotFound, "backend id "+backendID+" not found in backends.bicep", nil)
+	}
+	return FileChange{Path: pathBackend, Before: before, After: []byte(after)}, nil
+}
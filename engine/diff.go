@@ -0,0 +1,249 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Change of a file, Diff shows the change and Apply writes it
+type FileChange struct {
+	Path   string
+	Before []byte
+	After  []byte
+}
+
+// Write the change to the file
+func (c FileChange) Apply() error {
+	return os.WriteFile(c.Path, c.After, 0644)
+}
+
+// Unified diff of the change, empty if nothing changes
+func (c FileChange) Diff() string {
+	return UnifiedDiff("a/"+strings.TrimPrefix(c.Path, "./"), "b/"+strings.TrimPrefix(c.Path, "./"), string(c.Before), string(c.After))
+}
+
+// number of unchanged lines around each hunk
+const diffContext = 3
+
+// Unified diff of lines from a to b
+func UnifiedDiff(nameA, nameB, a, b string) string {
+	if a == b {
+		return ""
+	}
+	edits := []edit{}
+	diffLines(splitLines(a), splitLines(b), &edits)
+
+	// line numbers of a and b before each edit
+	lineA, lineB := make([]int, len(edits)+1), make([]int, len(edits)+1)
+	for k, e := range edits {
+		lineA[k+1], lineB[k+1] = lineA[k], lineB[k]
+		if e.op != '+' {
+			lineA[k+1]++
+		}
+		if e.op != '-' {
+			lineB[k+1]++
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("--- " + nameA + "\n+++ " + nameB + "\n")
+
+	// group edits into hunks with context lines
+	for start := 0; start < len(edits); {
+		if edits[start].op == ' ' {
+			start++
+			continue
+		}
+		from := start - diffContext
+		if from < 0 {
+			from = 0
+		}
+		to := start
+		for k := start; k < len(edits); k++ {
+			if edits[k].op != ' ' {
+				to = k
+			} else if k-to > 2*diffContext {
+				break
+			}
+		}
+		to += diffContext
+		if to >= len(edits) {
+			to = len(edits) - 1
+		}
+
+		// a range of no lines starts at the line before it
+		startA, countA := lineA[from]+1, lineA[to+1]-lineA[from]
+		startB, countB := lineB[from]+1, lineB[to+1]-lineB[from]
+		if countA == 0 {
+			startA--
+		}
+		if countB == 0 {
+			startB--
+		}
+
+		sb.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", startA, countA, startB, countB))
+		for _, e := range edits[from : to+1] {
+			sb.WriteString(string(e.op) + e.line + "\n")
+		}
+		start = to + 1
+	}
+	return sb.String()
+}
+
+// Line of an edit script, op is ' ', '-' or '+'
+type edit struct {
+	op   byte
+	line string
+}
+
+// Append the edits from a to b, common prefix and suffix are kept and the lines between are diffed by Myers' algorithm
+// in linear space
+func diffLines(a, b []string, edits *[]edit) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	appendEdits(edits, ' ', a[:prefix])
+	diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], edits)
+	appendEdits(edits, ' ', a[len(a)-suffix:])
+}
+
+// Edits of a and b without common prefix and suffix
+func diffMiddle(a, b []string, edits *[]edit) {
+	switch {
+	case len(a) == 0:
+		appendEdits(edits, '+', b)
+		return
+	case len(b) == 0:
+		appendEdits(edits, '-', a)
+		return
+	case len(a) == 1 || len(b) == 1:
+		// a single line is kept if the other side has it, the bisection needs two lines on each side
+		if len(a) == 1 {
+			for j, line := range b {
+				if line == a[0] {
+					appendEdits(edits, '+', b[:j])
+					appendEdits(edits, ' ', a)
+					appendEdits(edits, '+', b[j+1:])
+					return
+				}
+			}
+		} else {
+			for i, line := range a {
+				if line == b[0] {
+					appendEdits(edits, '-', a[:i])
+					appendEdits(edits, ' ', b)
+					appendEdits(edits, '-', a[i+1:])
+					return
+				}
+			}
+		}
+		appendEdits(edits, '-', a)
+		appendEdits(edits, '+', b)
+		return
+	}
+
+	x, y, ok := bisect(a, b)
+	if !ok {
+		appendEdits(edits, '-', a)
+		appendEdits(edits, '+', b)
+		return
+	}
+	diffLines(a[:x], b[:y], edits)
+	diffLines(a[x:], b[y:], edits)
+}
+
+// Split point of a and b on the middle snake of the shortest edit script, searching forward from the start and backward
+// from the end at once. Memory is linear in len(a)+len(b). Not ok if a and b have no line in common
+func bisect(a, b []string) (int, int, bool) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	length := 2*maxD + 3
+	forward, backward := make([]int, length), make([]int, length)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+
+	delta := n - m
+	// the paths meet on a forward step when delta is odd, else on a backward step
+	odd := delta%2 != 0
+	// diagonals of k beyond the end of a or b are not searched again
+	startF, endF, startB, endB := 0, 0, 0, 0
+	for d := 0; d < maxD; d++ {
+		for k := -d + startF; k <= d-endF; k += 2 {
+			i := offset + k
+			x := 0
+			if k == -d || (k != d && forward[i-1] < forward[i+1]) {
+				x = forward[i+1]
+			} else {
+				x = forward[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[i] = x
+			switch {
+			case x > n:
+				endF += 2
+			case y > m:
+				startF += 2
+			case odd:
+				if j := offset + delta - k; j >= 0 && j < length && backward[j] != -1 && x >= n-backward[j] {
+					return x, y, true
+				}
+			}
+		}
+		for k := -d + startB; k <= d-endB; k += 2 {
+			i := offset + k
+			x := 0
+			if k == -d || (k != d && backward[i-1] < backward[i+1]) {
+				x = backward[i+1]
+			} else {
+				x = backward[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			backward[i] = x
+			switch {
+			case x > n:
+				endB += 2
+			case y > m:
+				startB += 2
+			case !odd:
+				if j := offset + delta - k; j >= 0 && j < length && forward[j] != -1 {
+					fx := forward[j]
+					fy := fx - (j - offset)
+					if fx >= n-x {
+						return fx, fy, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func appendEdits(edits *[]edit, op byte, lines []string) {
+	for _, line := range lines {
+		*edits = append(*edits, edit{op, line})
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
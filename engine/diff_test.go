@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(from, to int) string {
+		var sb strings.Builder
+		for i := from; i <= to; i++ {
+			sb.WriteString("line" + strconv.Itoa(i) + "\n")
+		}
+		return sb.String()
+	}
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"same", "a\nb\n", "a\nb\n", ""},
+		{"modify in the middle", lines(1, 10), strings.Replace(lines(1, 10), "line5\n", "five\n", 1),
+			"--- a\n+++ b\n@@ -2,7 +2,7 @@\n line2\n line3\n line4\n-line5\n+five\n line6\n line7\n line8\n"},
+		{"insert at start", lines(1, 5), "line0\n" + lines(1, 5),
+			"--- a\n+++ b\n@@ -1,3 +1,4 @@\n+line0\n line1\n line2\n line3\n"},
+		{"delete at end", lines(1, 5), lines(1, 4),
+			"--- a\n+++ b\n@@ -2,4 +2,3 @@\n line2\n line3\n line4\n-line5\n"},
+		{"from empty", "", "a\nb\n",
+			"--- a\n+++ b\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"to empty", "a\nb\n", "",
+			"--- a\n+++ b\n@@ -1,2 +0,0 @@\n-a\n-b\n"},
+		{"two hunks", lines(1, 20), strings.Replace(strings.Replace(lines(1, 20), "line2\n", "two\n", 1), "line18\n", "", 1),
+			"--- a\n+++ b\n@@ -1,5 +1,5 @@\n line1\n-line2\n+two\n line3\n line4\n line5\n" +
+				"@@ -15,6 +15,5 @@\n line15\n line16\n line17\n-line18\n line19\n line20\n"},
+		{"changes within 6 lines are one hunk", lines(1, 12), strings.Replace(strings.Replace(lines(1, 12), "line3\n", "three\n", 1), "line9\n", "nine\n", 1),
+			"--- a\n+++ b\n@@ -1,12 +1,12 @@\n line1\n line2\n-line3\n+three\n line4\n line5\n line6\n line7\n line8\n-line9\n+nine\n line10\n line11\n line12\n"},
+		{"replace all", "a\nb\n", "c\nd\n",
+			"--- a\n+++ b\n@@ -1,2 +1,2 @@\n-a\n-b\n+c\n+d\n"},
+	}
+	for _, tt := range tests {
+		if got := UnifiedDiff("a", "b", tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: UnifiedDiff =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Edits keep the lines of a and b in order, and are as short as the longest common subsequence allows
+func TestDiffLinesShortest(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, r.Intn(40))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.Intn(3)))
+		}
+		return lines
+	}
+	for n := 0; n < 2000; n++ {
+		a, b := random(), random()
+		edits := []edit{}
+		diffLines(a, b, &edits)
+
+		gotA, gotB, kept := []string{}, []string{}, 0
+		for _, e := range edits {
+			if e.op != '+' {
+				gotA = append(gotA, e.line)
+			}
+			if e.op != '-' {
+				gotB = append(gotB, e.line)
+			}
+			if e.op == ' ' {
+				kept++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("edits of %v to %v do not give a and b: %v", a, b, edits)
+		}
+		if want := lcsLength(a, b); kept != want {
+			t.Fatalf("edits of %v to %v keep %d lines, want %d", a, b, kept, want)
+		}
+	}
+}
+
+func lcsLength(a, b []string) int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] > lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	return lcs[0][0]
+}
+
+// A large template with a change far from the start and the end is diffed without a matrix of its lines
+func TestUnifiedDiffLarge(t *testing.T) {
+	var a, b strings.Builder
+	for i := 0; i < 20000; i++ {
+		line := "\t\t\"url\": \"https://backend-" + strconv.Itoa(i) + ".example.com\",\n"
+		a.WriteString(line)
+		if i%5000 == 2500 {
+			b.WriteString("\t\t\"url\": \"https://changed.example.com\",\n")
+			continue
+		}
+		b.WriteString(line)
+	}
+	start := time.Now()
+	diff := UnifiedDiff("a", "b", a.String(), b.String())
+	if strings.Count(diff, "@@ -") != 4 || strings.Count(diff, "\n+\t\t\"url\": \"https://changed.example.com\",") != 4 {
+		t.Errorf("diff of large template:\n%s", diff)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("diff of large template took %s", elapsed)
+	}
+}
@@ -6,12 +6,12 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io/fs"
 	"net/url"
 	"strings"
 
 	"os"
 
-	"github.com/fatih/color"
 	"github.com/tarathep/apimtool/apim"
 	"github.com/tarathep/apimtool/models"
 	"gopkg.in/yaml.v3"
@@ -21,6 +21,9 @@ import (
 
 type Engine struct {
 	apim.APIM
+	MissingBackends   MissingBackendOptions
+	BackendPreference BackendPreference
+	ChooseBackend     BackendChooser
 }
 
 func loadApi(filename string) (models.API, error) {
@@ -76,49 +79,51 @@ func loadBackendTemplate(filename string) (models.BackendTemplate, error) {
 	return data, nil
 }
 
-func (e Engine) validateBackendID(backendTemplate models.BackendTemplate, resourceGroup, serviceName, url string) (bool, string) {
+func (e Engine) validateBackendID(backendTemplate models.BackendTemplate, resourceGroup, serviceName, url string) (bool, string, error) {
 
-	backendIdSource := getBackendIDfromURLsourceTemplate(backendTemplate, url)
+	backendIdSource, err := getBackendIDfromURLsourceTemplate(backendTemplate, url, e.URLMatchMode())
+	if err != nil {
+		return false, "", err
+	}
 	backendIdAPIM, err := e.GetBackendIDfromURL(resourceGroup, serviceName, url)
-
 	if err != nil {
-		return false, ""
+		return false, "", err
 	}
 	if backendIdSource != "" && backendIdAPIM != "" {
 		log.Debug().Msgf(backendIdAPIM, backendIdSource)
-		return true, backendIdAPIM
+		return true, backendIdAPIM, nil
 	}
-	return false, ""
+	return false, "", nil
 }
 
-// Get exsiting Backend ID from URL source template
-func getBackendIDfromURLsourceTemplate(backendTemplate models.BackendTemplate, backendURL string) string {
+// Get exsiting Backend ID from URL source template, backends matching the URL in the mode (apim.URLMatchExact or apim.URLMatchPrefix)
+func getBackendIDfromURLsourceTemplate(backendTemplate models.BackendTemplate, backendURL, mode string) (string, error) {
 
-	u, err := url.Parse(backendURL)
-	if err != nil {
-		log.Error().Str("func", "getBackendIdfromURLsourceTemplate").Err(err).Msg("error on parsing URL backend")
-		os.Exit(0)
+	if _, err := url.Parse(backendURL); err != nil {
+		return "", fmt.Errorf("error on parsing URL backend %s: %w", backendURL, err)
 	}
 
-	ids := ""
+	names, urls := []string{}, []string{}
 	for _, resource := range backendTemplate.Resources {
-		id := strings.ReplaceAll(getQuotedString(resource.Name)[1], "/", "")
-
-		port := ""
-		if u.Port() != "" {
-			port = ":" + u.Port()
+		// names not of format [concat(parameters('ApimServiceName'), '/{backend-id}')] are reported by template validate
+		id := backendIDfromResourceName(resource.Name)
+		if id == "" {
+			log.Warn().Str("func", "getBackendIdfromURLsourceTemplate").Msgf("Skip resource of invalid name %s", resource.Name)
+			continue
 		}
-		backendURL = u.Scheme + "://" + u.Hostname() + port
+		names, urls = append(names, id), append(urls, resource.Properties.URL)
+	}
 
-		if resource.Properties.URL == backendURL {
-			log.Debug().Str("func", "getBackendIdfromURLsourceTemplate").Msgf("Found ID=" + id)
-			ids += id + ","
-		}
+	// in prefix mode the backends of the longest path are the most specific
+	ids := ""
+	for _, i := range apim.MostSpecificMatches(urls, backendURL, mode) {
+		log.Debug().Str("func", "getBackendIdfromURLsourceTemplate").Msgf("Found ID=" + names[i])
+		ids += names[i] + ","
 	}
 	if ids == "" {
-		return ""
+		return "", nil
 	}
-	return string([]rune(ids)[:len(ids)-1])
+	return string([]rune(ids)[:len(ids)-1]), nil
 }
 
 func generateXMLApiPolicyHeaders(outputPath string, api models.API, backendID string) error {
@@ -146,12 +151,12 @@ func generateXMLApiPolicyHeaders(outputPath string, api models.API, backendID st
 	return os.WriteFile(outputPath+"/apiPolicyHeaders.xml", file, 0644)
 }
 
-func generateConfigYML(outputPath string, api models.API) error {
+func generateConfigYML(outputPath string, api models.API, serviceName string) error {
 	configYML := models.ConfigYML{}
 
 	// enter value
 	configYML.Version = "0.0.1"
-	configYML.ApimServiceName = "apimpocazassesbx003"
+	configYML.ApimServiceName = serviceName
 
 	// apis
 	apiConfig := models.APIConfig{}
@@ -162,6 +167,32 @@ func generateConfigYML(outputPath string, api models.API) error {
 	apiConfig.Suffix = api.Apiname
 	apiConfig.Protocols = "https"
 	apiConfig.Revision = 1
+	if api.Revision > 0 {
+		apiConfig.Revision = api.Revision
+	}
+
+	// version set {apiname}-versionset, versioning scheme default is Segment (/{suffix}/{version}/...)
+	if api.Version != "" {
+		versioningScheme := api.VersioningScheme
+		if versioningScheme == "" {
+			versioningScheme = "Segment"
+		}
+		versionSet := models.APIVersionSetYML{
+			ID:               api.Apiname + "-versionset",
+			DisplayName:      api.Apiname,
+			VersioningScheme: versioningScheme,
+		}
+		switch versioningScheme {
+		case "Header":
+			versionSet.VersionHeaderName = "Api-Version"
+		case "Query":
+			versionSet.VersionQueryName = "api-version"
+		}
+		configYML.APIVersionSets = append(configYML.APIVersionSets, versionSet)
+
+		apiConfig.APIVersion = api.Version
+		apiConfig.APIVersionSetID = versionSet.ID
+	}
 	apiConfig.AuthenticationSettings = struct {
 		SubscriptionKeyRequired bool "yaml:\"subscriptionKeyRequired\""
 	}{false}
@@ -193,16 +224,26 @@ func generateConfigYML(outputPath string, api models.API) error {
 	return os.WriteFile(outputPath+"/config.yml", data, 0644)
 }
 
-// Convert Configuration API JSON file to csv, apiPolicyHeader.xml
-func (e Engine) ConfigParser(env, apiId, resourceGroup, serviceName, filePath string) {
-
-	color.New(color.Italic, color.FgHiBlue, color.Bold).Print("Parser JSON API to source files\n\n")
+// Result of parsing an API config file to source files
+type ParseResult struct {
+	APIName    string
+	BackendID  string
+	BackendIDs []string
+	// rule of selecting BackendID of BackendIDs, e.g. backend-id of the API config
+	BackendSelection string
+	OutputPath       string
+	Files            []string
+	// backends created when e.MissingBackends.Create
+	CreatedBackends []CreatedBackend
+}
 
-	color.New(color.Italic).Println("API ID \t:", apiId, "\n")
+// Convert Configuration API JSON file to csv, apiPolicyHeader.xml
+func (e Engine) ConfigParser(env, apiId, resourceGroup, serviceName, filePath string) (ParseResult, error) {
+	result := ParseResult{}
 
 	//CHECK PATH ALL OPERATIONS
-	if !checkPaths([]string{"apim-apis-" + env, "sources/", "templates/"}) && filePath == "" {
-		return
+	if err := checkPaths([]string{"apim-apis-" + env, "sources/", "templates/"}); err != nil && filePath == "" {
+		return result, err
 	}
 
 	pathAPIs := "./apim-apis-" + env + "/" + apiId + "/" + apiId + ".json"
@@ -210,62 +251,114 @@ func (e Engine) ConfigParser(env, apiId, resourceGroup, serviceName, filePath st
 		pathAPIs = filePath
 	}
 
-	pathBackend := "./templates/" + "backends.template" + ".json"
-
 	// LOAD CONFIGURATION FILE {apim-apis-dev/apiID/apiId.json}
-	api, _ := loadApi(pathAPIs)
+	api, err := loadApi(pathAPIs)
+	if err != nil {
+		return result, apim.NewError(apim.ErrNotFound, "API config file "+pathAPIs+" not found", err)
+	}
 	if len(api.Operations) == 0 {
-		color.New(color.FgYellow).Println("API config file not found")
-		return
+		return result, errors.New("API config file " + pathAPIs + " has no operations")
+	}
+
+	backendTemplate, err := e.loadParseBackends(resourceGroup, serviceName)
+	if err != nil {
+		return result, err
+	}
+	e.Backends = backendTemplate.index
+	result, err = e.parseAPI(api, backendTemplate.template, resourceGroup, serviceName)
+	if err != nil {
+		return result, err
+	}
+
+	// RECORD INPUTS OF THE API FOR INCREMENTAL PARSE
+	entry, err := e.parseManifestEntry(pathAPIs, api, backendTemplate.template, serviceName)
+	if err == nil {
+		manifest := loadParseManifest()
+		manifest.record(entry, result)
+		err = manifest.write()
+	}
+	if err != nil {
+		log.Warn().Str("func", "ConfigParser").Msgf("Cannot record %s in %s: %v", api.Apiname, ParseManifestPath(), err)
 	}
+	return result, nil
+}
+
+// Backends of backends.template.json and of APIM, loaded once for parsing API config files
+type parseBackends struct {
+	template models.BackendTemplate
+	index    *apim.BackendIndex
+}
+
+func (e Engine) loadParseBackends(resourceGroup, serviceName string) (parseBackends, error) {
+	pathBackend := "./templates/" + "backends.template" + ".json"
 
 	// // LOAD LIST OF BACKEND IN backends.template.json
-	backendTemplate, _ := loadBackendTemplate(pathBackend)
-	if backendTemplate.ContentVersion == "" {
-		color.New(color.FgYellow).Println("backends.template.json not found")
-		log.Logger.Fatal().Msg("backends.template.json not found")
-		return
+	backendTemplate, err := loadBackendTemplate(pathBackend)
+	if err != nil || backendTemplate.ContentVersion == "" {
+		return parseBackends{}, apim.NewError(apim.ErrNotFound, pathBackend+" not found", err)
 	}
 
-	// PREPARE OUTPUT DIRECTORY SOURCE WHEN PARSER FILE
-	outputPath := "./sources/" + api.Apiname
-	os.Mkdir(outputPath, 0755)
+	// LOAD LIST OF BACKEND IN APIM ONCE
+	index, err := e.BackendIndex(resourceGroup, serviceName)
+	if err != nil {
+		return parseBackends{}, err
+	}
+	return parseBackends{template: backendTemplate, index: index}, nil
+}
+
+// Generate source files of API config, e.Backends is the backend index of APIM
+func (e Engine) parseAPI(api models.API, backendTemplate models.BackendTemplate, resourceGroup, serviceName string) (ParseResult, error) {
+	result := ParseResult{APIName: api.Apiname}
 
 	// VALIDATE BACKEND ID IF ALREADY EXIST RETURN BACKEND ID ? CREATE NEW
-	exist, backendId := e.validateBackendID(backendTemplate, resourceGroup, serviceName, api.Policies.BackendURL)
-	if !exist {
-		color.New(color.FgYellow).Println("Cannot find Backend [" + api.Policies.BackendURL + "] on APIM and backends.template.json")
-		os.Exit(-1)
+	exist, backendId, err := e.validateBackendID(backendTemplate, resourceGroup, serviceName, api.Policies.BackendURL)
+	if err != nil {
+		return result, err
 	}
-	color.New(color.FgHiBlack).Print("\nGenerate apiPolicyHeaders.xml Creating : ")
 
-	//IF BACKEND MORE THAN ONE SELECT FIRST (IN CASE TARGET IP DUPLICATE)
-	if backendIds := strings.Split(backendId, ","); len(backendIds) > 1 {
-		backendId = backendIds[0]
+	//IF BACKEND MORE THAN ONE SELECT BY backend-id, PREFERENCE OR CHOICE (IN CASE TARGET IP DUPLICATE)
+	var selected selectedBackend
+	switch {
+	case exist:
+		selected.ids = strings.Split(backendId, ",")
+		selected.id, selected.rule, err = e.selectBackend(api, selected.ids)
+	case e.MissingBackends.Create:
+		selected, result.CreatedBackends, err = e.createMissingBackend(api, resourceGroup, serviceName)
+	default:
+		err = apim.NewError(apim.ErrNotFound, "cannot find backend ["+api.Policies.BackendURL+"] on APIM and backends.template.json", nil)
+	}
+	result.BackendIDs, result.BackendID, result.BackendSelection = selected.ids, selected.id, selected.rule
+	if err != nil {
+		return result, err
 	}
-	if err := generateXMLApiPolicyHeaders(outputPath, api, backendId); err != nil {
-		color.New(color.FgHiRed).Println(err.Error())
-		os.Exit(-1)
+
+	// PREPARE OUTPUT DIRECTORY SOURCE WHEN PARSER FILE
+	outputPath := "./sources/" + api.Apiname
+	if err := os.MkdirAll(outputPath, 0755); err != nil {
+		return result, err
 	}
-	color.New(color.FgHiGreen).Print("Done")
+	result.OutputPath = outputPath
+
+	if err := generateXMLApiPolicyHeaders(outputPath, api, result.BackendID); err != nil {
+		return result, err
+	}
+	result.Files = append(result.Files, outputPath+"/apiPolicyHeaders.xml")
 
-	color.New(color.FgHiBlack).Print("\nGenerate " + apiId + ".csv Creating : ")
 	if err := generateCSV(outputPath, api); err != nil {
-		color.New(color.FgHiRed).Println(err.Error())
-		os.Exit(-1)
+		return result, err
 	}
-	color.New(color.FgHiGreen).Print("Done")
+	result.Files = append(result.Files, outputPath+"/"+api.Apiname+".csv")
 
-	color.New(color.FgHiBlack).Print("\nGenerate config.yml Creating : ")
-	if err := generateConfigYML(outputPath, api); err != nil {
-		color.New(color.FgHiRed).Println(err.Error())
-		os.Exit(-1)
+	if err := generateConfigYML(outputPath, api, serviceName); err != nil {
+		return result, err
 	}
-	color.New(color.FgHiGreen).Print("Done\n\n")
+	result.Files = append(result.Files, outputPath+"/config.yml")
+
+	return result, nil
 }
 
 // Remove in backends.template.json only
-func (Engine) removeBackendTemplateJsonByID(pathBackend string, backendTemplate models.BackendTemplate, backendID string) error {
+func (Engine) removeBackendTemplateJsonByID(pathBackend string, backendTemplate models.BackendTemplate, backendID string) (FileChange, error) {
 	var beTempl models.BackendTemplate
 
 	beTempl.Schema = backendTemplate.Schema
@@ -278,22 +371,31 @@ func (Engine) removeBackendTemplateJsonByID(pathBackend string, backendTemplate
 		}
 	}
 
-	file, err := json.MarshalIndent(beTempl, " ", "\t")
+	return backendTemplateChange(pathBackend, beTempl)
+}
+
+// Change of backends.template.json to the backend template
+func backendTemplateChange(pathBackend string, backendTemplate models.BackendTemplate) (FileChange, error) {
+	before, err := os.ReadFile(pathBackend)
 	if err != nil {
-		return err
+		return FileChange{}, err
+	}
+	after, err := json.MarshalIndent(backendTemplate, " ", "\t")
+	if err != nil {
+		return FileChange{}, err
 	}
-	return os.WriteFile(pathBackend, file, 0644)
+	return FileChange{Path: pathBackend, Before: before, After: after}, nil
 }
 
-func (Engine) addBackendTemplateJSON(pathBackend string, backendTemplate models.BackendTemplate, backendID string, url string, protocol string) error {
+func (e Engine) addBackendTemplateJSON(pathBackend string, backendTemplate models.BackendTemplate, backendID string, url string, protocol string) (FileChange, error) {
 
 	//CHECK DUPLICATE?
 	for _, res := range backendTemplate.Resources {
-		if res.Properties.URL == url && res.Properties.Protocol == protocol {
-			return errors.New("duplicate backend endpoint at Backend ID " + res.Name)
+		if apim.NormalizeURL(res.Properties.URL) == apim.NormalizeURL(url) && res.Properties.Protocol == protocol {
+			return FileChange{}, apim.NewError(apim.ErrDuplicateURL, "duplicate backend endpoint at Backend ID "+res.Name, nil)
 		}
 		if res.Name == "[concat(parameters('ApimServiceName'), '/"+backendID+"')]" {
-			return errors.New("duplicate backend id")
+			return FileChange{}, apim.NewError(apim.ErrDuplicateID, "duplicate backend id "+backendID, nil)
 		}
 	}
 
@@ -340,68 +442,116 @@ func (Engine) addBackendTemplateJSON(pathBackend string, backendTemplate models.
 			},
 			Name:       "[concat(parameters('ApimServiceName'), '/" + backendID + "')]",
 			Type:       "Microsoft.ApiManagement/service/backends",
-			APIVersion: "2021-01-01-preview",
+			APIVersion: e.Template.WithDefaults().APIVersion,
 		})
 
-	// Write to backends.template.json
-	file, err := json.MarshalIndent(backendTemplate, " ", "\t")
+	return backendTemplateChange(pathBackend, backendTemplate)
+}
+
+// Add backend into backends.template.json, ErrDuplicateURL or ErrDuplicateID if the backend already exists
+func (e Engine) AddBackendTemplateJSON(backendID, url, protocol string) error {
+	change, err := e.PlanAddBackendTemplateJSON(backendID, url, protocol)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(pathBackend, file, 0644)
+	return change.Apply()
 }
 
-func (e Engine) AddBackendTemplateJSON(backendID, url, protocol string) {
-
-	color.New(color.Italic, color.FgHiBlue, color.Bold).Print("Create a new backend entity in backends.template.json\n\n")
-
-	fmt.Println("Backend ID \t:", backendID, "\nURL \t\t:", url, "\nProtocol \t:", protocol)
-
+// Change of backends.template.json to add backend, without writing the file
+func (e Engine) PlanAddBackendTemplateJSON(backendID, url, protocol string) (FileChange, error) {
 	pathBackend := "./templates/" + "backends.template" + ".json"
-	backendTemplate, _ := loadBackendTemplate(pathBackend)
-	if backendTemplate.ContentVersion == "" {
-		color.New(color.FgYellow).Println("backends.template.json not found")
-		log.Logger.Fatal().Msg("backends.template.json not found")
-		return
+	backendTemplate, err := loadBackendTemplate(pathBackend)
+	if err != nil || backendTemplate.ContentVersion == "" {
+		return FileChange{}, apim.NewError(apim.ErrNotFound, pathBackend+" not found", err)
 	}
 
-	color.New(color.FgHiBlack).Print("\nCreating : ")
-
 	//Check existing backend on templates/backends.template.json?
-	if beID := getBackendIDfromURLsourceTemplate(backendTemplate, url); beID != "" {
+	beID, err := getBackendIDfromURLsourceTemplate(backendTemplate, url, apim.URLMatchExact)
+	if err != nil {
+		return FileChange{}, err
+	}
+	if beID != "" {
 		//have exiting backend
-		color.New(color.FgHiYellow).Println("Backend URL is using on backend-id (", beID, ") at backends.template.json\n")
-		os.Exit(-1)
-		return
+		return FileChange{}, apim.NewError(apim.ErrDuplicateURL, "backend URL is using on backend-id ("+beID+") at backends.template.json", nil)
 	}
 
-	if err := e.addBackendTemplateJSON(pathBackend, backendTemplate, backendID, url, protocol); err != nil {
-		color.New(color.FgHiRed).Println("ERROR", err)
-		os.Exit(-1)
-		return
-	}
+	return e.addBackendTemplateJSON(pathBackend, backendTemplate, backendID, url, protocol)
+}
 
-	color.New(color.FgHiGreen).Println("Done\n")
+// Delete backend from backends.template.json, ErrNotFound if the backend does not exist
+func (e Engine) DeleteBackendTemplateJSONByID(backendID string) error {
+	change, err := e.PlanDeleteBackendTemplateJSONByID(backendID)
+	if err != nil {
+		return err
+	}
+	return change.Apply()
 }
 
-func (e Engine) DeleteBackendTemplateJSONByID(backendID string) {
+// Change of backends.template.json to delete backend, without writing the file
+func (e Engine) PlanDeleteBackendTemplateJSONByID(backendID string) (FileChange, error) {
+	pathBackend := "./templates/" + "backends.template" + ".json"
+	backendTemplate, err := loadBackendTemplate(pathBackend)
+	if err != nil || backendTemplate.ContentVersion == "" {
+		return FileChange{}, apim.NewError(apim.ErrNotFound, pathBackend+" not found", err)
+	}
 
-	color.New(color.Italic, color.FgHiYellow, color.Bold).Print("Delete a backend entity in backends.template.json\n\n")
+	found := false
+	for _, res := range backendTemplate.Resources {
+		if res.Name == "[concat(parameters('ApimServiceName'), '/"+backendID+"')]" {
+			found = true
+		}
+	}
+	if !found {
+		return FileChange{}, apim.NewError(apim.ErrNotFound, "backend id "+backendID+" not found in backends.template.json", nil)
+	}
 
-	fmt.Println("Backend ID \t:", backendID)
+	return e.removeBackendTemplateJsonByID(pathBackend, backendTemplate, backendID)
+}
 
+// Audit backends on APIM and in backends.template.json against API policies on APIM,
+// the default ./templates/backends.template.json is skipped if it does not exist, ErrNotFound if filePath does not exist
+func (e Engine) AuditBackends(resourceGroup, serviceName, filePath string) (apim.AuditReport, error) {
 	pathBackend := "./templates/" + "backends.template" + ".json"
-	backendTemplate, _ := loadBackendTemplate(pathBackend)
-	if backendTemplate.ContentVersion == "" {
-		color.New(color.FgYellow).Println("backends.template.json not found")
-		log.Logger.Fatal().Msg("backends.template.json not found")
-		return
+	if filePath != "" {
+		pathBackend = filePath
+	}
+
+	var templateBackends []apim.Backend
+
+	backendTemplate, err := loadBackendTemplate(pathBackend)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && filePath != "":
+		return apim.AuditReport{}, apim.NewError(apim.ErrNotFound, pathBackend+" not found", err)
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return apim.AuditReport{}, err
+	}
+	if backendTemplate.ContentVersion != "" {
+		templateBackends = []apim.Backend{}
+		for _, resource := range backendTemplate.Resources {
+			templateBackends = append(templateBackends, apim.Backend{
+				Name:     backendIDfromResourceName(resource.Name),
+				URL:      resource.Properties.URL,
+				Protocol: resource.Properties.Protocol,
+			})
+		}
 	}
 
-	color.New(color.FgHiBlack).Print("\nDeleing : ")
-	if err := e.removeBackendTemplateJsonByID(pathBackend, backendTemplate, backendID); err != nil {
-		color.New(color.FgHiRed).Println("ERROR", err)
-		return
+	return e.APIM.AuditBackends(resourceGroup, serviceName, templateBackends)
+}
+
+// Backend IDs in backends.template.json, empty if the file cannot be loaded
+func TemplateBackendIDs(pathBackend string) []string {
+	ids := []string{}
+
+	backendTemplate, err := loadBackendTemplate(pathBackend)
+	if err != nil {
+		return ids
+	}
+	for _, resource := range backendTemplate.Resources {
+		if id := backendIDfromResourceName(resource.Name); id != "" {
+			ids = append(ids, id)
+		}
 	}
-	color.New(color.FgHiGreen).Println("Done\n")
+	return ids
 }
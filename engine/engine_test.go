@@ -0,0 +1,38 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tarathep/apimtool/apim"
+)
+
+func TestAuditBackendsFilePath(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		filePath string
+		notFound bool
+	}{
+		{"missing", filepath.Join(dir, "backends.template.json"), true},
+		{"invalid", invalid, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Engine{}.AuditBackends("rg", "svc", tt.filePath)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if got := errors.Is(err, apim.ErrNotFound); got != tt.notFound {
+				t.Errorf("errors.Is(%v, ErrNotFound) = %v, want %v", err, got, tt.notFound)
+			}
+		})
+	}
+}
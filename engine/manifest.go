@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tarathep/apimtool/apim"
+	"github.com/tarathep/apimtool/models"
+)
+
+// Version of parse manifest, entries of other versions are parsed again
+const parseManifestVersion = 1
+
+// Manifest of parsed APIs, hashes of the inputs of the source files of each API
+func ParseManifestPath() string {
+	return filepath.Join("sources", "parse.lock.json")
+}
+
+type parseManifest struct {
+	Version int                           `json:"version"`
+	APIs    map[string]parseManifestEntry `json:"apis"`
+}
+
+// Inputs of source files of an API: its config file, the service (apimServiceName of config.yml) and the backends
+// its backend URL resolves to
+type parseManifestEntry struct {
+	File         string    `json:"file"`
+	ServiceName  string    `json:"serviceName"`
+	InputHash    string    `json:"inputHash"`
+	BackendsHash string    `json:"backendsHash"`
+	BackendID    string    `json:"backendId"`
+	Files        []string  `json:"files"`
+	ParsedAt     time.Time `json:"parsedAt"`
+}
+
+// Load manifest, empty if the file does not exist or is of another version
+func loadParseManifest() parseManifest {
+	manifest := parseManifest{Version: parseManifestVersion, APIs: map[string]parseManifestEntry{}}
+	data, err := os.ReadFile(ParseManifestPath())
+	if err != nil {
+		return manifest
+	}
+	loaded := parseManifest{}
+	if err := json.Unmarshal(data, &loaded); err != nil || loaded.Version != parseManifestVersion || loaded.APIs == nil {
+		return manifest
+	}
+	return loaded
+}
+
+func (m parseManifest) write() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ParseManifestPath(), append(data, '\n'), 0644)
+}
+
+// Is the entry of apiname of the same inputs and are its source files there
+func (m parseManifest) unchanged(apiname string, entry parseManifestEntry) bool {
+	recorded, ok := m.APIs[apiname]
+	if !ok || recorded.File != entry.File || recorded.ServiceName != entry.ServiceName || recorded.InputHash != entry.InputHash || recorded.BackendsHash != entry.BackendsHash {
+		return false
+	}
+	for _, file := range recorded.Files {
+		if _, err := os.Stat(file); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Entry of the inputs of an API config file parsed for the service, the config file and the backends of backends.template.json and APIM
+// matching its backend URL
+func (e Engine) parseManifestEntry(file string, api models.API, backendTemplate models.BackendTemplate, serviceName string) (parseManifestEntry, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return parseManifestEntry{}, err
+	}
+	entry := parseManifestEntry{File: filepath.ToSlash(filepath.Clean(file)), ServiceName: serviceName, InputHash: contentHash(data)}
+
+	backends := []string{}
+	for _, resource := range backendTemplate.Resources {
+		if apim.MatchURL(resource.Properties.URL, api.Policies.BackendURL, e.URLMatchMode()) {
+			backends = append(backends, "template "+resource.Name+" "+resource.Properties.URL+" "+resource.Properties.Protocol)
+		}
+	}
+	if e.Backends != nil {
+		for _, id := range e.Backends.IDs(api.Policies.BackendURL, e.URLMatchMode()) {
+			backendURL, _ := e.Backends.URL(id)
+			backends = append(backends, "apim "+id+" "+backendURL)
+		}
+	}
+	sort.Strings(backends)
+	entry.BackendsHash = contentHash([]byte(strings.Join(backends, "\n")))
+	return entry, nil
+}
+
+// Record the source files of a parsed API
+func (m parseManifest) record(entry parseManifestEntry, result ParseResult) {
+	entry.BackendID, entry.Files, entry.ParsedAt = result.BackendID, result.Files, time.Now().UTC()
+	m.APIs[result.APIName] = entry
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Files under dir changed since the git ref, committed or not, and new files not ignored. Paths are relative to the working directory
+func changedFiles(ref, dir string) (map[string]bool, error) {
+	changed := map[string]bool{}
+	for _, args := range [][]string{
+		{"diff", "--name-only", "--relative", ref, "--", dir},
+		{"ls-files", "--others", "--exclude-standard", "--", dir},
+	} {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command("git", args...)
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("git %s: %s (%w)", strings.Join(args, " "), strings.TrimSpace(stderr.String()), err)
+		}
+		for _, line := range strings.Split(stdout.String(), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				changed[filepath.Clean(line)] = true
+			}
+		}
+	}
+	return changed, nil
+}
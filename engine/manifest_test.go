@@ -0,0 +1,199 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tarathep/apimtool/models"
+)
+
+// Change the working directory to dir for the test
+func chdir(t *testing.T, dir string) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
+
+func TestParseManifestUnchanged(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "orders.csv")
+	if err := os.WriteFile(source, []byte{}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	recorded := parseManifestEntry{File: "apim-apis-dev/orders/orders.json", ServiceName: "svc", InputHash: "sha256:a", BackendsHash: "sha256:b", Files: []string{source}}
+	manifest := parseManifest{Version: parseManifestVersion, APIs: map[string]parseManifestEntry{"orders": recorded}}
+
+	changed := func(change func(entry *parseManifestEntry)) parseManifestEntry {
+		entry := recorded
+		change(&entry)
+		return entry
+	}
+	tests := []struct {
+		name    string
+		apiname string
+		entry   parseManifestEntry
+		want    bool
+	}{
+		{"same inputs", "orders", recorded, true},
+		{"not recorded", "payments", recorded, false},
+		{"other file", "orders", changed(func(e *parseManifestEntry) { e.File = "apim-apis-dev/orders/v2.json" }), false},
+		{"other service", "orders", changed(func(e *parseManifestEntry) { e.ServiceName = "svc-prod" }), false},
+		{"config changed", "orders", changed(func(e *parseManifestEntry) { e.InputHash = "sha256:c" }), false},
+		{"backends changed", "orders", changed(func(e *parseManifestEntry) { e.BackendsHash = "sha256:c" }), false},
+	}
+	for _, tt := range tests {
+		if got := manifest.unchanged(tt.apiname, tt.entry); got != tt.want {
+			t.Errorf("%s: unchanged = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if err := os.Remove(source); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.unchanged("orders", recorded) {
+		t.Error("unchanged = true when a source file is removed")
+	}
+}
+
+func TestParseManifestEntry(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "orders.json")
+	config := `{"apiname": "orders", "policies": {"backend-url": "https://a.com/orders"}}`
+	if err := os.WriteFile(file, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	api := models.API{}
+	if err := json.Unmarshal([]byte(config), &api); err != nil {
+		t.Fatal(err)
+	}
+	template := func(urls ...string) models.BackendTemplate {
+		resources := []string{}
+		for i, url := range urls {
+			resources = append(resources, backendResource(backendName(fmt.Sprintf("be%d", i+1)), url, "http", "2021-08-01"))
+		}
+		backendTemplate := models.BackendTemplate{}
+		if err := json.Unmarshal([]byte(deploymentTemplate(resources...)), &backendTemplate); err != nil {
+			t.Fatal(err)
+		}
+		return backendTemplate
+	}
+
+	e := Engine{}
+	entry, err := e.parseManifestEntry(file, api, template("https://a.com/orders", "https://b.com"), "svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.File != filepath.ToSlash(filepath.Clean(file)) || entry.ServiceName != "svc" || entry.InputHash != contentHash([]byte(config)) {
+		t.Errorf("entry = %+v", entry)
+	}
+
+	tests := []struct {
+		name     string
+		template models.BackendTemplate
+		same     bool
+	}{
+		{"other backend changed", template("https://a.com/orders", "https://c.com"), true},
+		{"backend of the API changed", template("https://a.com/orders/", "https://b.com"), false},
+		{"backend of the API removed", template("https://b.com"), false},
+	}
+	for _, tt := range tests {
+		got, err := e.parseManifestEntry(file, api, tt.template, "svc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if same := got.BackendsHash == entry.BackendsHash; same != tt.same {
+			t.Errorf("%s: same backends hash = %v, want %v", tt.name, same, tt.same)
+		}
+	}
+
+	if _, err := e.parseManifestEntry(filepath.Join(t.TempDir(), "none.json"), api, template(), "svc"); err == nil {
+		t.Error("parseManifestEntry of missing config file: expected error")
+	}
+}
+
+func TestParseManifestWrite(t *testing.T) {
+	chdir(t, t.TempDir())
+	if err := os.Mkdir("sources", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if manifest := loadParseManifest(); len(manifest.APIs) != 0 {
+		t.Errorf("manifest without file = %+v", manifest)
+	}
+
+	manifest := loadParseManifest()
+	manifest.record(parseManifestEntry{File: "apim-apis-dev/orders/orders.json", ServiceName: "svc", InputHash: "sha256:a"},
+		ParseResult{APIName: "orders", BackendID: "be1", Files: []string{"sources/orders/config.yml"}})
+	if err := manifest.write(); err != nil {
+		t.Fatal(err)
+	}
+	loaded := loadParseManifest()
+	if got := loaded.APIs["orders"]; got.BackendID != "be1" || !reflect.DeepEqual(got.Files, []string{"sources/orders/config.yml"}) || got.ParsedAt.IsZero() {
+		t.Errorf("loaded entry = %+v", got)
+	}
+
+	// manifests of other versions are parsed again
+	if err := os.WriteFile(ParseManifestPath(), []byte(`{"version": 0, "apis": {"orders": {}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if manifest := loadParseManifest(); len(manifest.APIs) != 0 {
+		t.Errorf("manifest of version 0 = %+v", manifest)
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	chdir(t, t.TempDir())
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	write := func(name, content string) {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q")
+	write("apim-apis-dev/orders/orders.json", "{}")
+	write("apim-apis-dev/payments/payments.json", "{}")
+	write("templates/backends.template.json", "{}")
+	write(".gitignore", "*.tmp\n")
+	git("add", "-A")
+	git("commit", "-q", "-m", "base")
+
+	write("apim-apis-dev/orders/orders.json", `{"apiname": "orders"}`)
+	write("apim-apis-dev/refunds/refunds.json", "{}")
+	write("apim-apis-dev/refunds/refunds.json.tmp", "{}")
+	write("templates/backends.template.json", `{"resources": []}`)
+
+	changed, err := changedFiles("HEAD", "apim-apis-dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{
+		filepath.Join("apim-apis-dev", "orders", "orders.json"):   true,
+		filepath.Join("apim-apis-dev", "refunds", "refunds.json"): true,
+	}
+	if !reflect.DeepEqual(changed, want) {
+		t.Errorf("changedFiles = %v, want %v", changed, want)
+	}
+
+	if _, err := changedFiles("no-such-ref", "apim-apis-dev"); err == nil {
+		t.Error("changedFiles of unknown ref: expected error")
+	}
+}
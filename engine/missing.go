@@ -0,0 +1,243 @@
+package engine
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tarathep/apimtool/apim"
+	"github.com/tarathep/apimtool/models"
+)
+
+// Naming convention of created backend IDs when not configured, e.g. 10-0-0-1-8080 of https://10.0.0.1:8080
+const DefaultBackendNaming = "{host}-{port}"
+
+// Max length of backend ID on APIM
+const maxBackendIDLength = 80
+
+var (
+	backendNamingPlaceholders = []string{"{scheme}", "{host}", "{port}", "{apiname}"}
+	backendNamingPlaceholder  = regexp.MustCompile(`\{[^}]*\}`)
+	backendIDInvalidChars     = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+	backendIDDashes           = regexp.MustCompile(`-{2,}`)
+
+	// backends.template.json, APIM and the backend index are read and changed by one API at a time
+	missingBackendsMu sync.Mutex
+)
+
+// Creating backends of API config files not found on APIM and backends.template.json, instead of failing the parse.
+// Naming is the convention of backend IDs with placeholders {scheme}, {host}, {port} and {apiname}. The backend is added
+// to backends.template.json, and to APIM if CreateInAPIM
+type MissingBackendOptions struct {
+	Create       bool
+	CreateInAPIM bool
+	Naming       string
+	Protocol     string
+}
+
+// Error if the naming convention has unknown placeholders
+func (o MissingBackendOptions) Validate() error {
+	naming := o.naming()
+	for _, placeholder := range backendNamingPlaceholder.FindAllString(naming, -1) {
+		if !containsFold(backendNamingPlaceholders, placeholder) {
+			return fmt.Errorf("unknown placeholder %s of backend naming %s, expected %s", placeholder, naming, strings.Join(backendNamingPlaceholders, ", "))
+		}
+	}
+	return nil
+}
+
+func (o MissingBackendOptions) naming() string {
+	if o.Naming == "" {
+		return DefaultBackendNaming
+	}
+	return o.Naming
+}
+
+// Backend created by parse, Change is the change of backends.template.json and nil if the backend was already there
+type CreatedBackend struct {
+	Backend apim.Backend
+	Change  *FileChange
+	InAPIM  bool
+}
+
+// Backend ID of the naming convention for the endpoint of an API, characters not allowed are replaced by -.
+// Placeholders are case insensitive as by Validate
+func BackendIDByNaming(naming string, endpoint *url.URL, apiname string) string {
+	values := map[string]string{
+		"{scheme}":  endpoint.Scheme,
+		"{host}":    endpoint.Hostname(),
+		"{port}":    endpoint.Port(),
+		"{apiname}": apiname,
+	}
+	id := backendNamingPlaceholder.ReplaceAllStringFunc(naming, func(placeholder string) string {
+		if value, ok := values[strings.ToLower(placeholder)]; ok {
+			return value
+		}
+		return placeholder
+	})
+	id = backendIDDashes.ReplaceAllString(backendIDInvalidChars.ReplaceAllString(id, "-"), "-")
+	id = strings.Trim(strings.ToLower(id), "-")
+	if len(id) > maxBackendIDLength {
+		id = strings.TrimRight(id[:maxBackendIDLength], "-")
+	}
+	return id
+}
+
+// Backend ID name, suffixed with -2, -3.. if taken. Suffixed IDs are cut to the max length of backend IDs
+func uniqueBackendID(name string, taken map[string]bool) string {
+	backendID := name
+	for n := 2; taken[backendID]; n++ {
+		suffix := "-" + strconv.Itoa(n)
+		if len(name)+len(suffix) > maxBackendIDLength {
+			name = name[:maxBackendIDLength-len(suffix)]
+		}
+		backendID = name + suffix
+	}
+	return backendID
+}
+
+// Backend of the policy of an API selected of the backend IDs of its URL by a rule, e.g. SelectedBackendID
+type selectedBackend struct {
+	ids  []string
+	id   string
+	rule string
+}
+
+// Create the backend of the API not found on APIM and backends.template.json. The backend of APIM or of
+// backends.template.json is kept if the other has it, selected by selectBackend if the URL has more than one. Else
+// backend-id of the API config is created, or an ID of the naming convention suffixed with -2, -3.. if taken
+func (e Engine) createMissingBackend(api models.API, resourceGroup, serviceName string) (selectedBackend, []CreatedBackend, error) {
+	selected := selectedBackend{}
+	u, err := url.Parse(api.Policies.BackendURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return selected, nil, fmt.Errorf("cannot create backend of invalid URL %s", api.Policies.BackendURL)
+	}
+	// the backend of prefix mode is the origin of the URL, shared by the APIs of the host
+	endpoint := apim.NormalizeURL(api.Policies.BackendURL)
+	if e.URLMatchMode() != apim.URLMatchExact {
+		if endpoint, err = apim.URLOrigin(api.Policies.BackendURL); err != nil {
+			return selected, nil, err
+		}
+	}
+	protocol := e.MissingBackends.Protocol
+	if protocol == "" {
+		protocol = "http"
+	}
+
+	// the template and the index are read again, other APIs of the run may have created the backend
+	missingBackendsMu.Lock()
+	defer missingBackendsMu.Unlock()
+	pathBackend := "./templates/" + "backends.template" + ".json"
+	backendTemplate, err := loadBackendTemplate(pathBackend)
+	if err != nil || backendTemplate.ContentVersion == "" {
+		return selected, nil, apim.NewError(apim.ErrNotFound, pathBackend+" not found", err)
+	}
+	templateIDs, err := getBackendIDfromURLsourceTemplate(backendTemplate, api.Policies.BackendURL, e.URLMatchMode())
+	if err != nil {
+		return selected, nil, err
+	}
+	index, err := e.BackendIndex(resourceGroup, serviceName)
+	if err != nil {
+		return selected, nil, err
+	}
+	apimIDs := strings.Join(index.IDs(api.Policies.BackendURL, e.URLMatchMode()), ",")
+
+	// URLs of backend IDs taken on backends.template.json and APIM
+	templateURLs, apimURLs := map[string]string{}, map[string]string{}
+	for _, resource := range backendTemplate.Resources {
+		templateURLs[backendIDfromResourceName(resource.Name)] = resource.Properties.URL
+	}
+	for _, backend := range index.Filter("") {
+		apimURLs[backend.Name] = backend.URL
+	}
+	inTemplate, inAPIM := false, false
+
+	// backends of the URL are selected as for the policy, by backend-id of the API config, preference or choice
+	switch {
+	case apimIDs != "":
+		selected.ids = strings.Split(apimIDs, ",")
+	case templateIDs != "":
+		selected.ids = strings.Split(templateIDs, ",")
+	case api.Policies.BackendID != "":
+		if inTemplate, inAPIM, err = reusableBackendID(api.Policies.BackendID, endpoint, templateURLs, apimURLs); err != nil {
+			return selected, nil, err
+		}
+		selected.ids = []string{api.Policies.BackendID}
+	default:
+		taken := map[string]bool{}
+		for id := range templateURLs {
+			taken[id] = true
+		}
+		for id := range apimURLs {
+			taken[id] = true
+		}
+		name := BackendIDByNaming(e.MissingBackends.naming(), u, api.Apiname)
+		if name == "" {
+			return selected, nil, fmt.Errorf("backend naming %s gives an empty backend ID for %s", e.MissingBackends.naming(), endpoint)
+		}
+		selected.ids = []string{uniqueBackendID(name, taken)}
+	}
+	if selected.id, selected.rule, err = e.selectBackend(api, selected.ids); err != nil {
+		return selected, nil, err
+	}
+	backendID := selected.id
+
+	// a backend of APIM is added to the template as it is
+	if b, ok := index.Backend(backendID); ok && (apimIDs != "" || inAPIM) {
+		endpoint, protocol = b.URL, b.Protocol
+	}
+	backend := apim.Backend{Name: backendID, URL: endpoint, Protocol: protocol}
+	created := CreatedBackend{Backend: backend}
+	if templateIDs == "" && !inTemplate {
+		change, err := e.addBackendTemplateJSON(pathBackend, backendTemplate, backendID, endpoint, protocol)
+		if err != nil {
+			return selected, nil, err
+		}
+		if err := change.Apply(); err != nil {
+			return selected, nil, err
+		}
+		created.Change = &change
+		log.Debug().Str("func", "createMissingBackend").Msgf("Added backend %s (%s) to %s", backendID, endpoint, pathBackend)
+	}
+	if apimIDs == "" && !inAPIM && e.MissingBackends.CreateInAPIM {
+		result, err := e.CreateOrUpdateBackend(resourceGroup, serviceName, backendID, endpoint, protocol)
+		if err != nil {
+			return selected, []CreatedBackend{created}, err
+		}
+		e.AddToBackendIndex(index, result)
+		created.InAPIM = true
+		log.Debug().Str("func", "createMissingBackend").Msgf("Created backend %s (%s) on %s", backendID, endpoint, serviceName)
+	}
+	if created.Change == nil && !created.InAPIM {
+		return selected, nil, nil
+	}
+	return selected, []CreatedBackend{created}, nil
+}
+
+// Is backend-id of an API config already a backend of the endpoint on backends.template.json and on APIM, it is reused
+// then. ErrDuplicateID if the ID is a backend of another URL, creating it would repoint the APIs of that backend
+func reusableBackendID(backendID, endpoint string, templateURLs, apimURLs map[string]string) (bool, bool, error) {
+	reused := func(urls map[string]string) (bool, error) {
+		backendURL, ok := urls[backendID]
+		if !ok {
+			return false, nil
+		}
+		if apim.NormalizeURL(backendURL) != apim.NormalizeURL(endpoint) {
+			return false, apim.NewError(apim.ErrDuplicateID, "backend-id "+backendID+" of API config is a backend of "+backendURL+", not of "+endpoint, nil)
+		}
+		return true, nil
+	}
+	inTemplate, err := reused(templateURLs)
+	if err != nil {
+		return false, false, err
+	}
+	inAPIM, err := reused(apimURLs)
+	if err != nil {
+		return false, false, err
+	}
+	return inTemplate, inAPIM, nil
+}
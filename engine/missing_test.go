@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/tarathep/apimtool/apim"
+)
+
+func TestReusableBackendID(t *testing.T) {
+	templateURLs := map[string]string{"be1": "https://a.com", "shared": "https://s.com"}
+	apimURLs := map[string]string{"be2": "https://b.com:443/", "shared": "https://s.com"}
+	tests := []struct {
+		name       string
+		backendID  string
+		endpoint   string
+		inTemplate bool
+		inAPIM     bool
+		err        error
+	}{
+		{"new ID", "be3", "https://c.com", false, false, nil},
+		{"template ID of the URL", "be1", "https://A.com/", true, false, nil},
+		{"APIM ID of the URL", "be2", "https://b.com", false, true, nil},
+		{"ID of the URL on both", "shared", "https://s.com", true, true, nil},
+		{"template ID of another URL", "be1", "https://evil.com", false, false, apim.ErrDuplicateID},
+		{"APIM ID of another URL", "be2", "https://b.com:8443", false, false, apim.ErrDuplicateID},
+		{"APIM ID of another path", "be2", "https://b.com/api", false, false, apim.ErrDuplicateID},
+	}
+	for _, tt := range tests {
+		inTemplate, inAPIM, err := reusableBackendID(tt.backendID, tt.endpoint, templateURLs, apimURLs)
+		if !errors.Is(err, tt.err) || (err == nil) != (tt.err == nil) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+		}
+		if inTemplate != tt.inTemplate || inAPIM != tt.inAPIM {
+			t.Errorf("%s: reused %v %v, want %v %v", tt.name, inTemplate, inAPIM, tt.inTemplate, tt.inAPIM)
+		}
+	}
+}
+
+func TestBackendIDByNaming(t *testing.T) {
+	long := strings.Repeat("a", 90) + ".com"
+	tests := []struct {
+		naming   string
+		endpoint string
+		apiname  string
+		want     string
+	}{
+		{DefaultBackendNaming, "https://10.0.0.1:8080/orders", "orders", "10-0-0-1-8080"},
+		{DefaultBackendNaming, "https://a.com/orders", "orders", "a-com"},
+		{"{scheme}-{host}-{port}", "HTTP://API.Example.com:81", "orders", "http-api-example-com-81"},
+		{"{apiname}-backend", "https://a.com", "Orders_V2", "orders-v2-backend"},
+		{"{SCHEME}-{Host}", "https://a.com", "orders", "https-a-com"},
+		{"be {host} / {port}", "https://[2001:db8::1]:8443", "orders", "be-2001-db8-1-8443"},
+		{"{host}", "https://" + long, "orders", strings.Repeat("a", 80)},
+		{"{host}", "https://" + strings.Repeat("a", 79) + ".com", "orders", strings.Repeat("a", 79)},
+		{"{port}", "https://a.com", "orders", ""},
+	}
+	for _, tt := range tests {
+		endpoint, err := url.Parse(tt.endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := BackendIDByNaming(tt.naming, endpoint, tt.apiname); got != tt.want {
+			t.Errorf("BackendIDByNaming(%q, %s, %s) = %q, want %q", tt.naming, tt.endpoint, tt.apiname, got, tt.want)
+		}
+	}
+}
+
+func TestUniqueBackendID(t *testing.T) {
+	long := strings.Repeat("a", maxBackendIDLength)
+	tests := []struct {
+		name  string
+		taken []string
+		want  string
+	}{
+		{"a-com", nil, "a-com"},
+		{"a-com", []string{"a-com"}, "a-com-2"},
+		{"a-com", []string{"a-com", "a-com-2", "a-com-3"}, "a-com-4"},
+		{long, []string{long}, long[:maxBackendIDLength-2] + "-2"},
+	}
+	for _, tt := range tests {
+		taken := map[string]bool{}
+		for _, id := range tt.taken {
+			taken[id] = true
+		}
+		got := uniqueBackendID(tt.name, taken)
+		if got != tt.want || len(got) > maxBackendIDLength {
+			t.Errorf("uniqueBackendID(%s, %v) = %s, want %s", tt.name, tt.taken, got, tt.want)
+		}
+	}
+}
+
+func TestMissingBackendOptionsValidate(t *testing.T) {
+	tests := []struct {
+		naming string
+		valid  bool
+	}{
+		{"", true},
+		{"{host}-{port}", true},
+		{"{SCHEME}-{Host}-{apiname}", true},
+		{"backend", true},
+		{"{hostname}", false},
+		{"{host}-{env}", false},
+	}
+	for _, tt := range tests {
+		err := MissingBackendOptions{Naming: tt.naming}.Validate()
+		if (err == nil) != tt.valid {
+			t.Errorf("Validate of naming %q: error = %v, want valid %v", tt.naming, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/tarathep/apimtool/apim"
+	"github.com/tarathep/apimtool/models"
+)
+
+// Status of parsing an API config file of ParseAll
+const (
+	ParseSucceeded = "succeeded"
+	ParseFailed    = "failed"
+	ParseSkipped   = "skipped"
+)
+
+// Outcome of an API config file of ParseAll, Reason is set when it failed or was skipped
+type ParseOutcome struct {
+	File   string
+	APIID  string
+	Status string
+	Reason string
+	Result ParseResult
+}
+
+// Options of ParseAll. Pattern is a glob of API IDs e.g. * or payment-*, ChangedSince is a git ref, only API config
+// files changed since it are parsed. Force parses APIs of unchanged inputs
+type ParseOptions struct {
+	Pattern      string
+	ChangedSince string
+	Force        bool
+}
+
+// Parse API config files ./apim-apis-{env}/{pattern}/*.json to source files with e.Parallel workers. Backends of
+// backends.template.json and APIM are loaded once. A failed API does not stop the others, files without operations and
+// other files of the same apiname are skipped. APIs of the same inputs as recorded in sources/parse.lock.json are skipped
+// unless options.Force, the manifest is updated with the parsed APIs
+func (e Engine) ParseAll(env, resourceGroup, serviceName string, options ParseOptions) ([]ParseOutcome, error) {
+	pattern := options.Pattern
+	if err := checkPaths([]string{"apim-apis-" + env, "sources/", "templates/"}); err != nil {
+		return nil, err
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid API ID pattern %s: %w", pattern, err)
+	}
+	files, err := filepath.Glob(filepath.Join("apim-apis-"+env, pattern, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, apim.NewError(apim.ErrNotFound, "no API config file matches apim-apis-"+env+"/"+pattern+"/*.json", nil)
+	}
+
+	// a change of backends.template.json may change the backend of any API
+	var changed map[string]bool
+	if options.ChangedSince != "" {
+		changed, err = changedFiles(options.ChangedSince, "apim-apis-"+env)
+		if err != nil {
+			return nil, err
+		}
+		templates, err := changedFiles(options.ChangedSince, "templates")
+		if err != nil {
+			return nil, err
+		}
+		if templates[filepath.Join("templates", "backends.template.json")] {
+			changed = nil
+		}
+	}
+
+	backends, err := e.loadParseBackends(resourceGroup, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	e.Backends = backends.index
+
+	// load and check the files, an apiname is parsed from the file of its directory ({apiname}/*.json) or else the first file
+	outcomes := make([]ParseOutcome, len(files))
+	apis := make([]models.API, len(files))
+	owners := map[string]int{}
+	for i, file := range files {
+		outcomes[i] = ParseOutcome{File: file, APIID: filepath.Base(filepath.Dir(file)), Status: ParseFailed}
+		api, err := loadApi(file)
+		switch {
+		case err != nil:
+			outcomes[i].Reason = "cannot load API config: " + err.Error()
+		case api.Apiname == "":
+			outcomes[i].Reason = "apiname is empty"
+		case len(api.Operations) == 0:
+			outcomes[i].Status, outcomes[i].Reason = ParseSkipped, "no operations"
+		default:
+			apis[i] = api
+			outcomes[i].Status = ""
+			if owner, ok := owners[api.Apiname]; !ok || (outcomes[owner].APIID != api.Apiname && outcomes[i].APIID == api.Apiname) {
+				owners[api.Apiname] = i
+			}
+		}
+	}
+	for i := range outcomes {
+		if outcomes[i].Status != "" {
+			continue
+		}
+		if owner := owners[apis[i].Apiname]; owner != i {
+			outcomes[i].Status, outcomes[i].Reason = ParseSkipped, "apiname "+apis[i].Apiname+" is parsed from "+outcomes[owner].File
+		}
+	}
+
+	manifest := loadParseManifest()
+	entries := make([]parseManifestEntry, len(files))
+	for i := range outcomes {
+		if outcomes[i].Status != "" {
+			continue
+		}
+		if changed != nil && !changed[filepath.Clean(files[i])] {
+			outcomes[i].Status, outcomes[i].Reason = ParseSkipped, "not changed since "+options.ChangedSince
+			continue
+		}
+		entry, err := e.parseManifestEntry(files[i], apis[i], backends.template, serviceName)
+		if err != nil {
+			outcomes[i].Status, outcomes[i].Reason = ParseFailed, "cannot hash API config: "+err.Error()
+			continue
+		}
+		entries[i] = entry
+		if !options.Force && manifest.unchanged(apis[i].Apiname, entry) {
+			recorded := manifest.APIs[apis[i].Apiname]
+			outcomes[i].Status, outcomes[i].Reason = ParseSkipped, "unchanged"
+			outcomes[i].Result = ParseResult{APIName: apis[i].Apiname, BackendID: recorded.BackendID, Files: recorded.Files}
+		}
+	}
+
+	var mu sync.Mutex
+	parsed := 0
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < e.parallel(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := e.Context.Err(); err != nil {
+					outcomes[i].Status, outcomes[i].Reason = ParseSkipped, err.Error()
+					continue
+				}
+				result, err := e.parseAPI(apis[i], backends.template, resourceGroup, serviceName)
+				outcomes[i].Result = result
+				if err != nil {
+					outcomes[i].Status, outcomes[i].Reason = ParseFailed, err.Error()
+					continue
+				}
+				outcomes[i].Status = ParseSucceeded
+				mu.Lock()
+				manifest.record(entries[i], result)
+				parsed++
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range outcomes {
+		if outcomes[i].Status == "" {
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if parsed > 0 {
+		if err := manifest.write(); err != nil {
+			return outcomes, fmt.Errorf("cannot write %s: %w", ParseManifestPath(), err)
+		}
+	}
+	return outcomes, nil
+}
+
+// Number of workers of ParseAll, default is 8
+func (e Engine) parallel() int {
+	if e.Parallel <= 0 {
+		return 8
+	}
+	return e.Parallel
+}
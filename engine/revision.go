@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/tarathep/apimtool/apim"
+	"github.com/tarathep/apimtool/models"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	operationIDInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+	operationIDDashes       = regexp.MustCompile(`-{2,}`)
+)
+
+// Content of a new revision of the API from the source files of parse in sourcePath, default ./sources/{apiID}:
+// config.yml, its policy file and the operations of {name}.csv. ErrNotFound if the API is not parsed
+func LoadRevisionConfig(apiID, sourcePath string) (apim.RevisionConfig, error) {
+	if sourcePath == "" {
+		sourcePath = filepath.Join("sources", apiID)
+	}
+
+	data, err := os.ReadFile(filepath.Join(sourcePath, "config.yml"))
+	if err != nil {
+		return apim.RevisionConfig{}, apim.NewError(apim.ErrNotFound, "config.yml of API "+apiID+" not found in "+sourcePath+", parse the API first", err)
+	}
+	configYML := models.ConfigYML{}
+	if err := yaml.Unmarshal(data, &configYML); err != nil {
+		return apim.RevisionConfig{}, err
+	}
+	var apiConfig *models.APIConfig
+	for i := range configYML.Apis {
+		if configYML.Apis[i].Name == apiID {
+			apiConfig = &configYML.Apis[i]
+		}
+	}
+	if apiConfig == nil {
+		return apim.RevisionConfig{}, apim.NewError(apim.ErrNotFound, "API "+apiID+" not found in "+filepath.Join(sourcePath, "config.yml"), nil)
+	}
+
+	config := apim.RevisionConfig{
+		DisplayName:           apiConfig.Name,
+		Path:                  apiConfig.Suffix,
+		SubscriptionRequired:  apiConfig.AuthenticationSettings.SubscriptionKeyRequired,
+		SubscriptionKeyHeader: apiConfig.SubscriptionKeyParameterNames.Header,
+		SubscriptionKeyQuery:  apiConfig.SubscriptionKeyParameterNames.Query,
+	}
+	for _, protocol := range strings.Split(apiConfig.Protocols, ",") {
+		if protocol = strings.TrimSpace(protocol); protocol != "" {
+			config.Protocols = append(config.Protocols, protocol)
+		}
+	}
+
+	if apiConfig.Policy != "" {
+		policy, err := os.ReadFile(filepath.Join(sourcePath, apiConfig.Policy))
+		if err != nil {
+			return config, apim.NewError(apim.ErrNotFound, "policy "+apiConfig.Policy+" of API "+apiID+" not found in "+sourcePath, err)
+		}
+		config.Policy = string(policy)
+	}
+
+	file, err := os.Open(filepath.Join(sourcePath, apiConfig.Name+".csv"))
+	if err != nil {
+		return config, apim.NewError(apim.ErrNotFound, "operations "+apiConfig.Name+".csv of API "+apiID+" not found in "+sourcePath, err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return config, err
+	}
+	for _, record := range records {
+		if len(record) != 3 {
+			continue
+		}
+		config.Operations = append(config.Operations, apim.RevisionOperation{
+			ID:          operationID(record[0]),
+			DisplayName: record[0],
+			Method:      strings.ToUpper(record[1]),
+			URLTemplate: record[2],
+		})
+	}
+	return config, nil
+}
+
+// Operation ID of the operation name, characters other than letters, digits, - and _ are replaced by -, lower case
+func operationID(name string) string {
+	id := operationIDInvalidChars.ReplaceAllString(strings.ToLower(name), "-")
+	return strings.Trim(operationIDDashes.ReplaceAllString(id, "-"), "-")
+}
@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tarathep/apimtool/apim"
+	"github.com/tarathep/apimtool/models"
+)
+
+func TestLoadRevisionConfig(t *testing.T) {
+	api := models.API{}
+	if err := json.Unmarshal([]byte(`{
+		"apiname": "orders",
+		"policies": {"backend-url": "https://a.com", "set-headers": [{"name": "x-env", "value": "dev"}]},
+		"operations": [{"name": "Get Order", "method": "get", "url": "/orders/{id}"}, {"name": "create", "method": "POST", "url": "/orders"}]
+	}`), &api); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "orders")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := generateXMLApiPolicyHeaders(dir, api, "be1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := generateCSV(dir, api); err != nil {
+		t.Fatal(err)
+	}
+	if err := generateConfigYML(dir, api, "apim-my-name"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "config.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "apimServiceName: apim-my-name\n") {
+		t.Errorf("config.yml is not of the service:\n%s", data)
+	}
+
+	config, err := LoadRevisionConfig("orders", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.DisplayName != "orders" || config.Path != "orders" || !reflect.DeepEqual(config.Protocols, []string{"https"}) {
+		t.Errorf("config = %+v", config)
+	}
+	if !strings.Contains(config.Policy, `backend-id="be1"`) || !strings.Contains(config.Policy, "x-env") {
+		t.Errorf("policy = %s", config.Policy)
+	}
+	want := []apim.RevisionOperation{
+		{ID: "get-order", DisplayName: "Get Order", Method: "GET", URLTemplate: "/orders/{id}"},
+		{ID: "create", DisplayName: "create", Method: "POST", URLTemplate: "/orders"},
+	}
+	if !reflect.DeepEqual(config.Operations, want) {
+		t.Errorf("operations = %+v, want %+v", config.Operations, want)
+	}
+
+	if _, err := LoadRevisionConfig("payments", dir); !errors.Is(err, apim.ErrNotFound) {
+		t.Errorf("LoadRevisionConfig of other API: error = %v, want ErrNotFound", err)
+	}
+	if _, err := LoadRevisionConfig("orders", t.TempDir()); !errors.Is(err, apim.ErrNotFound) {
+		t.Errorf("LoadRevisionConfig of unparsed API: error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestOperationID(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"get", "get"},
+		{"Get Order", "get-order"},
+		{"get_order", "get_order"},
+		{"  list / orders (v2) ", "list-orders-v2"},
+		{"a--b", "a-b"},
+	}
+	for _, tt := range tests {
+		if got := operationID(tt.name); got != tt.want {
+			t.Errorf("operationID(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
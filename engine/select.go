@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/tarathep/apimtool/apim"
+	"github.com/tarathep/apimtool/models"
+)
+
+// Rules of selecting the backend of an API when its backend URL is used by more than one backend
+const (
+	SelectedOnly      = "only"
+	SelectedBackendID = "backend-id"
+	SelectedProtocol  = "protocol"
+	SelectedName      = "name"
+	SelectedChoice    = "choice"
+	SelectedFirst     = "first"
+)
+
+// Preference of backends when a backend URL is used by more than one backend. Backends of Protocol are kept, then the
+// first pattern of Names (path.Match) matching one backend selects it. Strict fails instead of selecting the first ID
+type BackendPreference struct {
+	Protocol string
+	Names    []string
+	Strict   bool
+}
+
+// Choice of a backend of candidates, e.g. asked to the user
+type BackendChooser func(apiname string, candidates []apim.Backend) (string, error)
+
+// Error if a name pattern is invalid
+func (p BackendPreference) Validate() error {
+	for _, pattern := range p.Names {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid backend name pattern %s: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Select the backend of the API of the backend IDs of its URL, sorted. backend-id of the API config is used if set, then
+// e.BackendPreference, then e.ChooseBackend, then the first ID unless the preference is strict. Returns the rule used
+func (e Engine) selectBackend(api models.API, ids []string) (string, string, error) {
+	sort.Strings(ids)
+	if api.Policies.BackendID != "" {
+		for _, id := range ids {
+			if strings.EqualFold(id, api.Policies.BackendID) {
+				return id, SelectedBackendID, nil
+			}
+		}
+		return "", "", apim.NewError(apim.ErrNotFound, "backend-id "+api.Policies.BackendID+" of API config is not a backend of ["+
+			api.Policies.BackendURL+"], backends are "+strings.Join(ids, ", "), nil)
+	}
+	if len(ids) == 1 {
+		return ids[0], SelectedOnly, nil
+	}
+
+	candidates := make([]apim.Backend, 0, len(ids))
+	for _, id := range ids {
+		backend := apim.Backend{Name: id}
+		if e.Backends != nil {
+			if b, ok := e.Backends.Backend(id); ok {
+				backend = b
+			}
+		}
+		candidates = append(candidates, backend)
+	}
+
+	rule := ""
+	if e.BackendPreference.Protocol != "" {
+		matches := []apim.Backend{}
+		for _, backend := range candidates {
+			if strings.EqualFold(backend.Protocol, e.BackendPreference.Protocol) {
+				matches = append(matches, backend)
+			}
+		}
+		if len(matches) == 1 {
+			return matches[0].Name, SelectedProtocol, nil
+		}
+		if len(matches) > 1 {
+			candidates, rule = matches, SelectedProtocol
+		}
+	}
+	for _, pattern := range e.BackendPreference.Names {
+		matches := []apim.Backend{}
+		for _, backend := range candidates {
+			if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(backend.Name)); ok {
+				matches = append(matches, backend)
+			}
+		}
+		if len(matches) == 1 {
+			return matches[0].Name, SelectedName, nil
+		}
+		if len(matches) > 1 {
+			candidates, rule = matches, SelectedName
+		}
+	}
+
+	if e.ChooseBackend != nil {
+		id, err := e.ChooseBackend(api.Apiname, candidates)
+		if err != nil {
+			return "", "", err
+		}
+		for _, backend := range candidates {
+			if backend.Name == id {
+				return id, SelectedChoice, nil
+			}
+		}
+		return "", "", fmt.Errorf("backend %s is not a backend of [%s]", id, api.Policies.BackendURL)
+	}
+
+	names := make([]string, 0, len(candidates))
+	for _, backend := range candidates {
+		names = append(names, backend.Name)
+	}
+	if e.BackendPreference.Strict {
+		by := ""
+		if rule != "" {
+			by = " after the " + rule + " preference"
+		}
+		return "", "", fmt.Errorf("backend URL [%s] is used by backends %s%s, set backend-id of the API config", api.Policies.BackendURL, strings.Join(names, ", "), by)
+	}
+	return names[0], SelectedFirst, nil
+}
@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/tarathep/apimtool/apim"
+)
+
+// Resource of ARM template with the properties of backends, APIs, operations and policies
+type templateResource struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Properties struct {
+		URL      string `json:"url"`
+		Protocol string `json:"protocol"`
+		TLS      struct {
+			ValidateCertificateChain bool `json:"validateCertificateChain"`
+			ValidateCertificateName  bool `json:"validateCertificateName"`
+		} `json:"tls"`
+		Path          string   `json:"path"`
+		Protocols     []string `json:"protocols"`
+		ServiceURL    string   `json:"serviceUrl"`
+		Method        string   `json:"method"`
+		URLTemplate   string   `json:"urlTemplate"`
+		Value         string   `json:"value"`
+		PolicyContent string   `json:"policyContent"`
+	} `json:"properties"`
+	Resources []templateResource `json:"resources"`
+}
+
+// parameters('...') and variables('...') of template expressions
+var templateFunctionPattern = regexp.MustCompile(`(parameters|variables)\('[^']*'\)`)
+
+// Segments of resource name after the service name, e.g. [concat(parameters('ApimServiceName'), '/echo-api/get')] is echo-api, get
+func resourceNameSegments(name string) []string {
+	path := name
+	if strings.HasPrefix(name, "[") {
+		path = "/" + strings.Join(getQuotedString(templateFunctionPattern.ReplaceAllString(name, "")), "")
+	}
+	segments := []string{}
+	for i, segment := range strings.Split(path, "/") {
+		if i > 0 && segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// State of ARM templates, all *.template.json files in dir and its sub directories
+func TemplateState(dir string) (apim.State, error) {
+	state := apim.NewState(dir)
+
+	resources := []templateResource{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(info.Name(), ".template.json") {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		template := struct {
+			Resources []templateResource `json:"resources"`
+		}{}
+		if err := json.Unmarshal(data, &template); err != nil {
+			return fmt.Errorf("cannot parse %s: %w", path, err)
+		}
+		resources = append(resources, flattenResources(template.Resources)...)
+		return nil
+	})
+	if err != nil {
+		return state, err
+	}
+	if len(resources) == 0 {
+		return state, apim.NewError(apim.ErrNotFound, "no *.template.json resources found in "+dir, nil)
+	}
+
+	api := func(id string) apim.APIState {
+		if s, ok := state.APIs[id]; ok {
+			return s
+		}
+		return apim.APIState{Protocols: []string{}, Operations: map[string]apim.OperationState{}}
+	}
+
+	// fields are set on the entity found so far, resources can be in any order
+	for _, resource := range resources {
+		segments := resourceNameSegments(resource.Name)
+		p := resource.Properties
+		policy := p.Value
+		if policy == "" {
+			policy = p.PolicyContent
+		}
+
+		switch kind := resourceKind(resource.Type); {
+		case kind == "backends" && len(segments) == 1:
+			state.Backends[segments[0]] = apim.BackendState{URL: p.URL, Protocol: p.Protocol,
+				ValidateCertificateChain: p.TLS.ValidateCertificateChain, ValidateCertificateName: p.TLS.ValidateCertificateName}
+		case kind == "apis" && len(segments) == 1:
+			s := api(segments[0])
+			s.Path, s.ServiceURL = p.Path, p.ServiceURL
+			if p.Protocols != nil {
+				s.Protocols = p.Protocols
+			}
+			state.APIs[segments[0]] = s
+		case kind == "apis/policies" && len(segments) >= 1:
+			s := api(segments[0])
+			s.Policy = policy
+			state.APIs[segments[0]] = s
+		case kind == "apis/operations" && len(segments) == 2:
+			s := api(segments[0])
+			operation := s.Operations[segments[1]]
+			operation.Method, operation.URLTemplate = p.Method, p.URLTemplate
+			s.Operations[segments[1]] = operation
+			state.APIs[segments[0]] = s
+		case kind == "apis/operations/policies" && len(segments) >= 2:
+			s := api(segments[0])
+			operation := s.Operations[segments[1]]
+			operation.Policy = policy
+			s.Operations[segments[1]] = operation
+			state.APIs[segments[0]] = s
+		}
+	}
+	return state, nil
+}
+
+// Kind of APIM resource type, Microsoft.ApiManagement/service/apis/operations is apis/operations
+func resourceKind(resourceType string) string {
+	return strings.TrimPrefix(strings.ToLower(resourceType), "microsoft.apimanagement/service/")
+}
+
+// Resources with their nested resources
+func flattenResources(resources []templateResource) []templateResource {
+	flat := []templateResource{}
+	for _, resource := range resources {
+		flat = append(flat, resource)
+		flat = append(flat, flattenResources(resource.Resources)...)
+	}
+	return flat
+}
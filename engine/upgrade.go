@@ -0,0 +1,243 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tarathep/apimtool/apim"
+)
+
+// Resource type with API version of Bicep, e.g. 'Microsoft.ApiManagement/service/backends@2021-08-01'
+var bicepResourceTypePattern = regexp.MustCompile(`('Microsoft\.ApiManagement/[^'@]+@)([^']+)(')`)
+
+// Position of a string value in JSON, the bytes between the quotes
+type jsonSpan struct {
+	start, end int
+	value      string
+}
+
+// Changes of *.template.json and *.bicep in dir and its sub directories, or the file if path is a file, to the API version
+// and schema of e.Template. apiVersion of Microsoft.ApiManagement resources and $schema are rewritten in place to keep the
+// format of the files. Templates are not downgraded, error if a resource has a newer API version. Unchanged files are not returned
+func (e Engine) PlanUpgradeTemplates(path string) ([]FileChange, error) {
+	template := e.Template.WithDefaults()
+	if err := template.Validate(); err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, apim.NewError(apim.ErrNotFound, path+" not found", err)
+	}
+	if info.IsDir() {
+		err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			if strings.HasSuffix(info.Name(), ".template.json") || strings.HasSuffix(info.Name(), ".bicep") {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		files = append(files, path)
+	}
+	if len(files) == 0 {
+		return nil, apim.NewError(apim.ErrNotFound, "no *.template.json or *.bicep found in "+path, nil)
+	}
+	sort.Strings(files)
+
+	changes := []FileChange{}
+	for _, file := range files {
+		before, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var after []byte
+		if strings.HasSuffix(file, ".bicep") {
+			after, err = upgradeBicep(before, template)
+		} else {
+			after, err = upgradeTemplateJSON(before, template)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot upgrade %s: %w", file, err)
+		}
+		if !bytes.Equal(before, after) {
+			changes = append(changes, FileChange{Path: file, Before: before, After: after})
+		}
+	}
+	return changes, nil
+}
+
+func upgradeBicep(content []byte, template apim.TemplateOptions) ([]byte, error) {
+	for _, m := range bicepResourceTypePattern.FindAllSubmatch(content, -1) {
+		if err := checkUpgrade(string(m[2]), template.APIVersion); err != nil {
+			return nil, err
+		}
+	}
+	return bicepResourceTypePattern.ReplaceAll(content, []byte("${1}"+template.APIVersion+"${3}")), nil
+}
+
+func upgradeTemplateJSON(content []byte, template apim.TemplateOptions) ([]byte, error) {
+	schema, versions, err := templateSpans(content)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTemplateProperties(content, template); err != nil {
+		return nil, err
+	}
+	replacements := []jsonSpan{}
+	for _, version := range versions {
+		// expressions e.g. [variables('apiVersion')] are kept
+		if strings.HasPrefix(version.value, "[") {
+			continue
+		}
+		if err := checkUpgrade(version.value, template.APIVersion); err != nil {
+			return nil, err
+		}
+		replacements = append(replacements, jsonSpan{start: version.start, end: version.end, value: template.APIVersion})
+	}
+	if schema != nil {
+		replacements = append(replacements, jsonSpan{start: schema.start, end: schema.end, value: template.Schema})
+	}
+
+	// replace from the end so the positions before stay valid
+	sort.Slice(replacements, func(i, j int) bool { return replacements[i].start > replacements[j].start })
+	after := append([]byte{}, content...)
+	for _, r := range replacements {
+		after = append(after[:r.start], append([]byte(r.value), after[r.end:]...)...)
+	}
+	return after, nil
+}
+
+// Error if a Microsoft.ApiManagement resource, top-level or nested of full type, has a property not supported by the API
+// version of the template, e.g. contact of an API before 2021-04-01-preview
+func checkTemplateProperties(content []byte, template apim.TemplateOptions) error {
+	var document struct {
+		Resources []json.RawMessage `json:"resources"`
+	}
+	if err := json.Unmarshal(content, &document); err != nil {
+		return err
+	}
+
+	var check func(resources []json.RawMessage) error
+	check = func(resources []json.RawMessage) error {
+		for _, raw := range resources {
+			var resource struct {
+				Type       string                 `json:"type"`
+				Name       string                 `json:"name"`
+				Properties map[string]interface{} `json:"properties"`
+				Resources  []json.RawMessage      `json:"resources"`
+			}
+			if err := json.Unmarshal(raw, &resource); err != nil {
+				continue
+			}
+			const prefix = "microsoft.apimanagement/service/"
+			if strings.HasPrefix(strings.ToLower(resource.Type), prefix) {
+				kind := strings.ToLower(resource.Type[len(prefix):])
+				if unsupported := template.Unsupported(kind, resource.Properties); len(unsupported) > 0 {
+					return fmt.Errorf("%s of %s %s is not supported by API version %s", strings.Join(unsupported, ", "), kind, resource.Name, template.APIVersion)
+				}
+			}
+			if err := check(resource.Resources); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return check(document.Resources)
+}
+
+func checkUpgrade(from, to string) error {
+	if apim.CompareAPIVersions(from, to) > 0 {
+		return fmt.Errorf("API version %s is newer than %s, templates are not downgraded", from, to)
+	}
+	return nil
+}
+
+// Position of $schema of the template and apiVersion of objects of Microsoft.ApiManagement resources at any depth
+func templateSpans(content []byte) (*jsonSpan, []jsonSpan, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	versions := []jsonSpan{}
+	var schema *jsonSpan
+
+	// position of the string just read, values of these keys are plain strings without escapes
+	stringSpan := func(value string) jsonSpan {
+		end := int(decoder.InputOffset()) - 1
+		return jsonSpan{start: bytes.LastIndexByte(content[:end], '"') + 1, end: end, value: value}
+	}
+
+	var value func(token json.Token, depth int) error
+	value = func(token json.Token, depth int) error {
+		delim, ok := token.(json.Delim)
+		if !ok {
+			return nil
+		}
+		if delim == '[' {
+			for decoder.More() {
+				token, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				if err := value(token, depth+1); err != nil {
+					return err
+				}
+			}
+			_, err := decoder.Token()
+			return err
+		}
+
+		resourceType := ""
+		var apiVersion *jsonSpan
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			token, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			if s, ok := token.(string); ok {
+				switch {
+				case key == "type":
+					resourceType = s
+				case key == "apiVersion":
+					span := stringSpan(s)
+					apiVersion = &span
+				case key == "$schema" && depth == 0:
+					span := stringSpan(s)
+					schema = &span
+				}
+				continue
+			}
+			if err := value(token, depth+1); err != nil {
+				return err
+			}
+		}
+		if apiVersion != nil && strings.HasPrefix(strings.ToLower(resourceType), "microsoft.apimanagement/") {
+			versions = append(versions, *apiVersion)
+		}
+		_, err := decoder.Token()
+		return err
+	}
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := value(token, 0); err != nil {
+		return nil, nil, err
+	}
+	return schema, versions, nil
+}
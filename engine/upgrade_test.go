@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tarathep/apimtool/apim"
+)
+
+const upgradeTemplate = `{
+	"$schema": "https://schema.management.azure.com/schemas/2015-01-01/deploymentTemplate.json#",
+	"contentVersion": "1.0.0.0",
+	"resources": [
+		{
+			"type": "Microsoft.ApiManagement/service/apis",
+			"apiVersion": "2020-12-01",
+			"name": "[concat(parameters('ApimServiceName'), '/echo')]",
+			"properties": {"displayName": "echo", "path": "echo"},
+			"resources": [
+				{
+					"type": "Microsoft.ApiManagement/service/apis/operations",
+					"apiVersion": "2020-12-01",
+					"name": "[concat(parameters('ApimServiceName'), '/echo/get')]",
+					"properties": {"method": "GET", "urlTemplate": "/"}
+				}
+			]
+		},
+		{
+			"type": "Microsoft.ApiManagement/service/backends",
+			"apiVersion": "[variables('apiVersion')]",
+			"name": "[concat(parameters('ApimServiceName'), '/be1')]",
+			"properties": {"url": "https://a.com", "protocol": "http"}
+		},
+		{
+			"type": "Microsoft.Storage/storageAccounts",
+			"apiVersion": "2019-06-01",
+			"name": "storage"
+		}
+	]
+}
+`
+
+func TestUpgradeTemplateJSON(t *testing.T) {
+	template := apim.TemplateOptions{APIVersion: "2021-08-01"}.WithDefaults()
+	after, err := upgradeTemplateJSON([]byte(upgradeTemplate), template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.NewReplacer(
+		`"apiVersion": "2020-12-01"`, `"apiVersion": "2021-08-01"`,
+		"https://schema.management.azure.com/schemas/2015-01-01/deploymentTemplate.json#", apim.DefaultTemplateSchema,
+	).Replace(upgradeTemplate)
+	if string(after) != want {
+		t.Errorf("upgradeTemplateJSON =\n%s\nwant\n%s", after, want)
+	}
+
+	// upgrading again changes nothing
+	again, err := upgradeTemplateJSON(after, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(after) {
+		t.Errorf("upgradeTemplateJSON of upgraded template changed it:\n%s", again)
+	}
+}
+
+func TestUpgradeTemplateJSONErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		apiVersion string
+		want       string
+	}{
+		{"downgrade", upgradeTemplate, "2019-12-01", "newer than 2019-12-01"},
+		{"preview before stable", strings.ReplaceAll(upgradeTemplate, "2020-12-01", "2021-04-01"), "2021-04-01-preview", "newer than 2021-04-01-preview"},
+		{"unsupported API property", strings.Replace(upgradeTemplate, `"path": "echo"`, `"path": "echo", "contact": {}`, 1), "2021-01-01-preview",
+			"contact of apis [concat(parameters('ApimServiceName'), '/echo')] is not supported by API version 2021-01-01-preview"},
+		{"unsupported backend property", strings.Replace(upgradeTemplate, `"protocol": "http"`, `"protocol": "http", "circuitBreaker": {}`, 1), "2022-08-01",
+			"circuitBreaker of backends"},
+		{"invalid JSON", "{", "2021-08-01", "unexpected"},
+	}
+	for _, tt := range tests {
+		_, err := upgradeTemplateJSON([]byte(tt.content), apim.TemplateOptions{APIVersion: tt.apiVersion}.WithDefaults())
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// properties of newer API versions are upgraded to the versions supporting them
+func TestUpgradeTemplateJSONNewerProperties(t *testing.T) {
+	content := strings.Replace(upgradeTemplate, `"protocol": "http"`, `"protocol": "http", "circuitBreaker": {}`, 1)
+	after, err := upgradeTemplateJSON([]byte(content), apim.TemplateOptions{APIVersion: "2023-03-01-preview"}.WithDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(after), `"apiVersion": "2023-03-01-preview"`) || !strings.Contains(string(after), `"circuitBreaker": {}`) {
+		t.Errorf("upgradeTemplateJSON =\n%s", after)
+	}
+}
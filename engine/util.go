@@ -1,12 +1,11 @@
 package engine
 
 import (
-	"net/url"
 	"os"
 	"regexp"
+	"strings"
 
-	"github.com/fatih/color"
-	"github.com/rs/zerolog/log"
+	"github.com/tarathep/apimtool/apim"
 )
 
 func getQuotedString(s string) []string {
@@ -20,21 +19,20 @@ func getQuotedString(s string) []string {
 	return ss
 }
 
-func checkPaths(paths []string) bool {
+func checkPaths(paths []string) error {
 	for _, checkdir := range paths {
 		if _, err := os.Stat(checkdir); os.IsNotExist(err) {
-			color.New(color.FgYellow).Println("directory " + checkdir + " not found!")
-			log.Logger.Warn().Msg("directory " + checkdir + " not found!")
-			return false
+			return apim.NewError(apim.ErrNotFound, "directory "+checkdir+" not found", nil)
 		}
 	}
-	return true
+	return nil
 }
 
-func urlParse(url_ string) {
-	_, err := url.Parse(url_)
-	if err != nil {
-		color.New(color.FgRed).Println("URL Parsing Error")
-		log.Logger.Err(err).Msg("URL Parsing Error")
+// Get backend ID from resource name [concat(parameters('ApimServiceName'), '/{backendID}')], empty if not matched
+func backendIDfromResourceName(name string) string {
+	quoted := getQuotedString(name)
+	if len(quoted) < 2 {
+		return ""
 	}
+	return strings.ReplaceAll(quoted[1], "/", "")
 }
@@ -0,0 +1,333 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tarathep/apimtool/apim"
+)
+
+// Kinds of issue of template validation
+const (
+	IssueSchema              = "schema"
+	IssueName                = "invalid-name"
+	IssueDuplicateID         = "duplicate-id"
+	IssueDuplicateURL        = "duplicate-url"
+	IssueURL                 = "invalid-url"
+	IssueProtocol            = "invalid-protocol"
+	IssueAPIVersion          = "apiversion-mismatch"
+	IssueUndeclaredParameter = "undeclared-parameter"
+)
+
+// Issue of a template file, Resource is the name of the resource if the issue is of a resource
+type ValidationIssue struct {
+	File     string `json:"file"`
+	Resource string `json:"resource,omitempty"`
+	Kind     string `json:"kind"`
+	Detail   string `json:"detail"`
+}
+
+// Result of validation, the files validated and their issues
+type ValidationReport struct {
+	Files  []string          `json:"files"`
+	Issues []ValidationIssue `json:"issues"`
+}
+
+var (
+	contentVersionPattern     = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+\.[0-9]+$`)
+	parameterReferencePattern = regexp.MustCompile(`parameters\('([^']*)'\)`)
+
+	// properties of deploymentTemplate.json, other properties are not allowed by the schema
+	templateProperties  = []string{"$schema", "contentVersion", "apiProfile", "parameters", "variables", "functions", "resources", "outputs", "metadata", "definitions"}
+	parameterTypes      = []string{"string", "securestring", "int", "bool", "object", "secureobject", "array"}
+	backendProtocols    = []string{"http", "soap"}
+	validatedURLSchemes = []string{"http", "https"}
+)
+
+// Resource of template being validated with the file it is declared in. Type and segments of the name are of the
+// resource path, e.g. of a resource nested in its parent
+type validatedResource struct {
+	file         string
+	resource     templateResource
+	raw          map[string]interface{}
+	resourceType string
+	segments     []string
+	nested       bool
+}
+
+// Validate *.template.json in dir and its sub directories, or the file if path is a file. Templates are checked offline:
+// schema of deployment template, resource names, unique backend IDs and URLs per protocol, URLs and protocols of backends,
+// one apiVersion per resource type and parameters referenced but not declared
+func ValidateTemplates(path string) (ValidationReport, error) {
+	report := ValidationReport{Files: []string{}, Issues: []ValidationIssue{}}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return report, apim.NewError(apim.ErrNotFound, path+" not found", err)
+	}
+	if info.IsDir() {
+		err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || !strings.HasSuffix(info.Name(), ".template.json") {
+				return err
+			}
+			report.Files = append(report.Files, file)
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+	} else {
+		report.Files = append(report.Files, path)
+	}
+	if len(report.Files) == 0 {
+		return report, apim.NewError(apim.ErrNotFound, "no *.template.json found in "+path, nil)
+	}
+	sort.Strings(report.Files)
+
+	resources := []validatedResource{}
+	for _, file := range report.Files {
+		issues, fileResources := validateTemplateFile(file)
+		report.Issues = append(report.Issues, issues...)
+		resources = append(resources, fileResources...)
+	}
+	report.Issues = append(report.Issues, validateResources(resources)...)
+	return report, nil
+}
+
+// Validate schema and parameters of a template file, return its resources for the checks across files
+func validateTemplateFile(file string) ([]ValidationIssue, []validatedResource) {
+	issues := []ValidationIssue{}
+	issue := func(kind, format string, a ...interface{}) {
+		issues = append(issues, ValidationIssue{File: file, Kind: kind, Detail: fmt.Sprintf(format, a...)})
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		issue(IssueSchema, "cannot read file: %v", err)
+		return issues, nil
+	}
+	template := map[string]interface{}{}
+	if err := json.Unmarshal(data, &template); err != nil {
+		issue(IssueSchema, "invalid JSON: %v", err)
+		return issues, nil
+	}
+
+	for key := range template {
+		if !containsFold(templateProperties, key) {
+			issue(IssueSchema, "property %s is not allowed in deployment template", key)
+		}
+	}
+	if schema, _ := template["$schema"].(string); !strings.Contains(schema, "deploymentTemplate.json") {
+		issue(IssueSchema, "$schema is not a deployment template schema: %q", schema)
+	}
+	if version, _ := template["contentVersion"].(string); !contentVersionPattern.MatchString(version) {
+		issue(IssueSchema, "contentVersion must be of format 1.0.0.0: %q", version)
+	}
+
+	declared := map[string]bool{}
+	if parameters, ok := template["parameters"]; ok {
+		definitions, ok := parameters.(map[string]interface{})
+		if !ok {
+			issue(IssueSchema, "parameters must be an object")
+		}
+		for name, definition := range definitions {
+			declared[name] = true
+			d, _ := definition.(map[string]interface{})
+			if t, _ := d["type"].(string); !containsFold(parameterTypes, t) {
+				issue(IssueSchema, "parameter %s has invalid type %q", name, t)
+			}
+		}
+	}
+
+	rawResources, ok := template["resources"].([]interface{})
+	if !ok {
+		issue(IssueSchema, "resources must be an array")
+	}
+	resources, resourceIssues := validateRawResources(file, rawResources, "resources", nil)
+	issues = append(issues, resourceIssues...)
+
+	// parameters('..') of any expression of the template must be declared
+	referenced := map[string]bool{}
+	for _, m := range parameterReferencePattern.FindAllStringSubmatch(string(data), -1) {
+		referenced[m[1]] = true
+	}
+	names := []string{}
+	for name := range referenced {
+		if !declared[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		issue(IssueUndeclaredParameter, "parameter %s is referenced but not declared", name)
+	}
+	return issues, resources
+}
+
+// Resources of a resources array and their nested resources, name and type of a nested resource are relative to its parent
+func validateRawResources(file string, rawResources []interface{}, at string, parent *validatedResource) ([]validatedResource, []ValidationIssue) {
+	issues := []ValidationIssue{}
+	resources := []validatedResource{}
+	for i, raw := range rawResources {
+		r, ok := raw.(map[string]interface{})
+		if !ok {
+			issues = append(issues, ValidationIssue{File: file, Kind: IssueSchema, Detail: fmt.Sprintf("%s[%d] must be an object", at, i)})
+			continue
+		}
+		missing := []string{}
+		for _, key := range []string{"type", "name", "apiVersion"} {
+			if s, _ := r[key].(string); s == "" {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) > 0 {
+			issues = append(issues, ValidationIssue{File: file, Kind: IssueSchema, Detail: fmt.Sprintf("%s[%d] has no %s", at, i, strings.Join(missing, ", "))})
+			continue
+		}
+
+		var resource templateResource
+		data, _ := json.Marshal(r)
+		if err := json.Unmarshal(data, &resource); err != nil {
+			issues = append(issues, ValidationIssue{File: file, Resource: fmt.Sprint(r["name"]), Kind: IssueSchema, Detail: "invalid properties: " + err.Error()})
+			continue
+		}
+		v := validatedResource{file: file, resource: resource, raw: r, resourceType: resource.Type, segments: resourceNameSegments(resource.Name)}
+		if parent != nil && !strings.Contains(resource.Type, "/") {
+			// e.g. type operations named get in apis echo-api is apis/operations echo-api/get
+			v.nested = true
+			v.resourceType = parent.resourceType + "/" + resource.Type
+			v.segments = append(append([]string{}, parent.segments...), resourceNameSegments("/"+resource.Name)...)
+		}
+		resources = append(resources, v)
+
+		if children, ok := r["resources"].([]interface{}); ok {
+			nested, nestedIssues := validateRawResources(file, children, fmt.Sprintf("%s[%d].resources", at, i), &v)
+			resources = append(resources, nested...)
+			issues = append(issues, nestedIssues...)
+		}
+	}
+	return resources, issues
+}
+
+// Validate names, backends and apiVersion of resources across template files
+func validateResources(resources []validatedResource) []ValidationIssue {
+	issues := []ValidationIssue{}
+	issue := func(r validatedResource, kind, format string, a ...interface{}) {
+		issues = append(issues, ValidationIssue{File: r.file, Resource: r.resource.Name, Kind: kind, Detail: fmt.Sprintf(format, a...)})
+	}
+
+	ids := map[string]validatedResource{}
+	urls := map[string]validatedResource{}
+	versions := map[string]map[string]int{}
+	for _, r := range resources {
+		kind := resourceKind(r.resourceType)
+		if !strings.HasPrefix(strings.ToLower(r.resourceType), "microsoft.apimanagement/service/") {
+			continue
+		}
+
+		apiVersion, _ := r.raw["apiVersion"].(string)
+		if versions[kind] == nil {
+			versions[kind] = map[string]int{}
+		}
+		versions[kind][apiVersion]++
+
+		// name of APIM resource has a segment per level of its type, e.g. '/echo-api/get' of apis/operations
+		segments := r.segments
+		label := strings.Join(segments, "/")
+		validName := len(segments) == len(strings.Split(kind, "/"))
+		if !validName {
+			issue(r, IssueName, "name of %s must have %d segment(s) after the service name, got %d %v",
+				kind, len(strings.Split(kind, "/")), len(segments), segments)
+			label = r.resource.Name
+		} else if first, ok := ids[kind+"/"+label]; ok {
+			issue(r, IssueDuplicateID, "%s %s is also declared in %s", kind, label, first.file)
+		} else {
+			ids[kind+"/"+label] = r
+		}
+
+		p := r.resource.Properties
+		switch kind {
+		case "backends":
+			// parse reads backend IDs of top-level resources by backendIDfromResourceName
+			if r.nested {
+				issue(r, IssueName, "backend %s is nested, parse reads backends of top-level resources only", label)
+			} else if id := backendIDfromResourceName(r.resource.Name); validName && id != label {
+				issue(r, IssueName, "backend ID of name is %q for parse, expected %s of [concat(parameters('ApimServiceName'), '/%s')]", id, label, label)
+			}
+			if !containsFold(backendProtocols, p.Protocol) {
+				issue(r, IssueProtocol, "protocol of backend %s must be http or soap, got %q", label, p.Protocol)
+			}
+			if !validateURL(r, p.URL, "url of backend "+label, issue) {
+				continue
+			}
+			key := strings.ToLower(p.Protocol) + " " + apim.NormalizeURL(p.URL)
+			if first, ok := urls[key]; ok {
+				issue(r, IssueDuplicateURL, "URL %s (%s) of backend %s is used by backend %s", p.URL, p.Protocol, label,
+					strings.Join(first.segments, "/"))
+			} else {
+				urls[key] = r
+			}
+		case "apis":
+			if p.ServiceURL != "" {
+				validateURL(r, p.ServiceURL, "serviceUrl of API "+label, issue)
+			}
+		}
+	}
+
+	// the most used apiVersion of a resource type is expected
+	for _, r := range resources {
+		kind := resourceKind(r.resourceType)
+		apiVersion, _ := r.raw["apiVersion"].(string)
+		if counts := versions[kind]; len(counts) > 1 {
+			expected := mostUsed(counts)
+			if apiVersion != expected {
+				issue(r, IssueAPIVersion, "apiVersion %s of %s, other resources of the type use %s", apiVersion, kind, expected)
+			}
+		}
+	}
+	return issues
+}
+
+// Check URL is absolute http(s) URL, template expressions are not checked
+func validateURL(r validatedResource, rawURL, what string, issue func(r validatedResource, kind, format string, a ...interface{})) bool {
+	if strings.HasPrefix(rawURL, "[") {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || !containsFold(validatedURLSchemes, u.Scheme) {
+		issue(r, IssueURL, "%s is not a valid http(s) URL: %q", what, rawURL)
+		return false
+	}
+	return true
+}
+
+// Key of the largest count, the smallest key of a tie
+func mostUsed(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	most := keys[0]
+	for _, key := range keys {
+		if counts[key] > counts[most] {
+			most = key
+		}
+	}
+	return most
+}
+
+func containsFold(items []string, s string) bool {
+	for _, item := range items {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
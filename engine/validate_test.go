@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tarathep/apimtool/apim"
+)
+
+// Resource of backend {id} in backends.template.json format
+func backendResource(name, url, protocol, apiVersion string) string {
+	return fmt.Sprintf(`{"type": "Microsoft.ApiManagement/service/backends", "apiVersion": %q, "name": %q, "properties": {"url": %q, "protocol": %q}}`,
+		apiVersion, name, url, protocol)
+}
+
+func backendName(id string) string {
+	return "[concat(parameters('ApimServiceName'), '/" + id + "')]"
+}
+
+// Deployment template of the resources, ApimServiceName is declared
+func deploymentTemplate(resources ...string) string {
+	return `{
+  "$schema": "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#",
+  "contentVersion": "1.0.0.0",
+  "parameters": {"ApimServiceName": {"type": "string"}},
+  "resources": [` + strings.Join(resources, ",\n") + `]
+}`
+}
+
+func TestValidateTemplates(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     []string
+	}{
+		{"valid", deploymentTemplate(
+			backendResource(backendName("be1"), "https://a.com", "http", "2021-08-01"),
+			backendResource(backendName("be2"), "https://a.com", "soap", "2021-08-01"),
+			backendResource(backendName("be3"), "[parameters('ApimServiceName')]", "http", "2021-08-01")),
+			[]string{}},
+		{"schema", strings.Replace(deploymentTemplate(), `"contentVersion": "1.0.0.0"`, `"contentVersion": "1.0", "extra": true`, 1),
+			[]string{IssueSchema, IssueSchema}},
+		{"resource without name", deploymentTemplate(`{"type": "Microsoft.ApiManagement/service/backends", "apiVersion": "2021-08-01"}`),
+			[]string{IssueSchema}},
+		{"invalid-name", deploymentTemplate(
+			backendResource(backendName("be1/extra"), "https://a.com", "http", "2021-08-01")),
+			[]string{IssueName}},
+		{"duplicate-id", deploymentTemplate(
+			backendResource(backendName("be1"), "https://a.com", "http", "2021-08-01"),
+			backendResource(backendName("be1"), "https://b.com", "http", "2021-08-01")),
+			[]string{IssueDuplicateID}},
+		{"duplicate-url", deploymentTemplate(
+			backendResource(backendName("be1"), "https://a.com", "http", "2021-08-01"),
+			backendResource(backendName("be2"), "HTTPS://A.com:443/", "http", "2021-08-01")),
+			[]string{IssueDuplicateURL}},
+		{"invalid-url", deploymentTemplate(
+			backendResource(backendName("be1"), "ftp://a.com", "http", "2021-08-01"),
+			backendResource(backendName("be2"), "a.com/path", "http", "2021-08-01")),
+			[]string{IssueURL, IssueURL}},
+		{"invalid-protocol", deploymentTemplate(
+			backendResource(backendName("be1"), "https://a.com", "grpc", "2021-08-01")),
+			[]string{IssueProtocol}},
+		{"apiversion-mismatch", deploymentTemplate(
+			backendResource(backendName("be1"), "https://a.com", "http", "2021-08-01"),
+			backendResource(backendName("be2"), "https://b.com", "http", "2021-08-01"),
+			backendResource(backendName("be3"), "https://c.com", "http", "2020-12-01")),
+			[]string{IssueAPIVersion}},
+		{"undeclared-parameter", strings.Replace(deploymentTemplate(
+			backendResource(backendName("be1"), "https://a.com", "http", "2021-08-01")),
+			`"parameters": {"ApimServiceName": {"type": "string"}},`, "", 1),
+			[]string{IssueUndeclaredParameter}},
+		// names of fewer than two quoted strings made parse panic by index out of range
+		{"unquoted name", deploymentTemplate(
+			backendResource("be1", "https://a.com", "http", "2021-08-01"),
+			backendResource("[parameters('ApimServiceName')]", "https://b.com", "http", "2021-08-01")),
+			[]string{IssueName, IssueName}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "backends.template.json")
+			if err := os.WriteFile(file, []byte(tt.template), 0600); err != nil {
+				t.Fatal(err)
+			}
+			report, err := ValidateTemplates(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			kinds := []string{}
+			for _, issue := range report.Issues {
+				kinds = append(kinds, issue.Kind)
+			}
+			if !reflect.DeepEqual(kinds, tt.want) {
+				t.Errorf("issues = %+v, want kinds %v", report.Issues, tt.want)
+			}
+
+			// parse reads the same file without panic
+			TemplateBackendIDs(file)
+			if backendTemplate, err := loadBackendTemplate(file); err == nil {
+				if _, err := getBackendIDfromURLsourceTemplate(backendTemplate, "https://a.com", apim.URLMatchExact); err != nil {
+					t.Errorf("getBackendIDfromURLsourceTemplate: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// Issues across files of a directory, other files than *.template.json are skipped
+func TestValidateTemplatesDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"backends.template.json":     deploymentTemplate(backendResource(backendName("be1"), "https://a.com", "http", "2021-08-01")),
+		"apis/more.template.json":    deploymentTemplate(backendResource(backendName("be1"), "https://b.com", "http", "2021-08-01")),
+		"apis/parameters.json":       "{",
+		"apis/invalid.template.json": "{",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := ValidateTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Files) != 3 {
+		t.Errorf("files = %v, want the 3 *.template.json", report.Files)
+	}
+	kinds := []string{}
+	for _, issue := range report.Issues {
+		kinds = append(kinds, filepath.Base(issue.File)+" "+issue.Kind)
+	}
+	if want := []string{"invalid.template.json " + IssueSchema, "backends.template.json " + IssueDuplicateID}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("issues = %v, want %v", kinds, want)
+	}
+
+	if _, err := ValidateTemplates(filepath.Join(dir, "none")); !errors.Is(err, apim.ErrNotFound) {
+		t.Errorf("ValidateTemplates of missing path: error = %v, want ErrNotFound", err)
+	}
+	if _, err := ValidateTemplates(t.TempDir()); !errors.Is(err, apim.ErrNotFound) {
+		t.Errorf("ValidateTemplates of directory without templates: error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/jessevdk/go-flags"
+	"github.com/tarathep/apimtool/apim"
+)
+
+// Exit codes per class of error, documented in README
+const (
+	ExitOK           = 0
+	ExitError        = 1
+	ExitUsage        = 2
+	ExitNotFound     = 3
+	ExitDuplicateURL = 4
+	ExitDuplicateID  = 5
+	ExitThrottled    = 6
+	ExitAuthFailed   = 7
+	ExitAborted      = 8
+	ExitProtected    = 9
+	ExitDifferent    = 10
+	ExitInvalid      = 11
+	ExitInterrupted  = 130
+)
+
+// Class of error and its exit code
+func errorClass(err error) (string, int) {
+	var flagsErr *flags.Error
+	switch {
+	case err == nil:
+		return "", ExitOK
+	case errors.As(err, &flagsErr):
+		return "usage", ExitUsage
+	case errors.Is(err, apim.ErrNotFound):
+		return "not-found", ExitNotFound
+	case errors.Is(err, apim.ErrDuplicateURL):
+		return "duplicate-url", ExitDuplicateURL
+	case errors.Is(err, apim.ErrDuplicateID):
+		return "duplicate-id", ExitDuplicateID
+	case errors.Is(err, apim.ErrThrottled):
+		return "throttled", ExitThrottled
+	case errors.Is(err, apim.ErrAuthFailed):
+		return "auth-failed", ExitAuthFailed
+	case errors.Is(err, errAborted):
+		return "aborted", ExitAborted
+	case errors.Is(err, errProtected):
+		return "protected", ExitProtected
+	case errors.Is(err, errDifferent):
+		return "different", ExitDifferent
+	case errors.Is(err, errInvalid):
+		return "invalid", ExitInvalid
+	case errors.Is(err, context.Canceled):
+		return "interrupted", ExitInterrupted
+	}
+	return "error", ExitError
+}
+
+// Error object written to stderr with --error-format json
+type errorOutput struct {
+	Error    string `json:"error"`
+	Message  string `json:"message"`
+	Command  string `json:"command,omitempty"`
+	ExitCode int    `json:"exitCode"`
+}
+
+// Write err to stderr in the format of --error-format and return its exit code
+func reportError(parser *flags.Parser, err error) int {
+	class, code := errorClass(err)
+
+	if options.ErrorFormat == "json" {
+		out := errorOutput{Error: class, Message: err.Error(), ExitCode: code}
+		if parser.Active != nil {
+			out.Command = commandPath(parser.Active)
+		}
+		data, _ := json.Marshal(out)
+		fmt.Fprintln(os.Stderr, string(data))
+		return code
+	}
+
+	if code == ExitUsage {
+		color.New(color.FgHiRed).Fprintln(os.Stderr, err)
+		fmt.Fprint(os.Stderr, "\n")
+		parser.WriteHelp(os.Stderr)
+		return code
+	}
+	printError(err)
+	return code
+}
+
+// Full name of the command, e.g. apim backend list
+func commandPath(command *flags.Command) string {
+	name := command.Name
+	for active := command.Active; active != nil; active = active.Active {
+		name += " " + active.Name
+	}
+	return name
+}
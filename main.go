@@ -2,54 +2,65 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"os"
+	"os/signal"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
 	"github.com/fatih/color"
 	"github.com/jessevdk/go-flags"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/rs/zerolog/pkgerrors"
 	"github.com/tarathep/apimtool/apim"
-	"github.com/tarathep/apimtool/engine"
+	"github.com/tarathep/apimtool/arm"
 )
 
 const version string = "1.0.0"
 const label string = `Azure API Management Tool ` + version + `
 Repository : https://github.com/tarathep/apimtool`
 
+// Global options, available for every command
 type Options struct {
 	Version bool `short:"v" long:"version" description:"Version"`
 
-	SubscriptionID string `long:"subscription-id" description:"Subscription ID"`
-	ResourceGroup  string `short:"g" long:"resource-group" description:"Resource group"`
-	Location       string `short:"l" long:"location" description:"Location"`
-	ServiceName    string `short:"n" long:"service-name" description:"Name"`
+	Logging bool `long:"logging" description:"Console log"`
 
-	Filter            string `long:"filter" description:"Filter"`
-	FilterDisplayName string `long:"filter-display-name" description:"Filter of APIs by displayName."`
-	Top               string `long:"top" description:"Number of records to return."`
+	Parallel int           `long:"parallel" default:"8" description:"Number of concurrent requests to Azure"`
+	Cache    time.Duration `long:"cache" description:"Cache backends locally with TTL (e.g. 10m), disabled by default"`
+	URLMatch string        `long:"url-match" env:"APIMTOOL_URL_MATCH" description:"Matching of backend URLs by lookups: exact, or prefix of the backend path" choice:"exact" choice:"prefix" default:"prefix"`
 
-	BackendID string `long:"backend-id" description:"Backend ID on APIM."`
-	URL       string `long:"url" description:"URL endpoint"`
-	Protocol  string `long:"protocol" description:"protocol to communcation"`
+	Confirm         bool `short:"y" long:"confirm" description:"Do not prompt for confirmation"`
+	AllowProduction bool `long:"allow-production" description:"Allow changes on protected services of config"`
 
-	FilePath    string `long:"file-path" description:"File Path"`
-	Environment string `long:"env" description:"Environment"`
-	ApiID       string `long:"api-id"`
+	ErrorFormat string `long:"error-format" description:"Format of errors written to stderr" choice:"text" choice:"json" default:"text"`
 
-	Helps   bool   `long:"help" description:"help"`
-	Token   string `long:"token" description:"Personal Access Token"`
-	Logging bool   `long:"logging" description:"Console log"`
-
-	Option string `short:"o" long:"option" description:"Option"`
+	TemplateAPIVersion string `long:"template-api-version" env:"APIMTOOL_TEMPLATE_API_VERSION" description:"API version of resources of generated templates, default of config or 2021-01-01-preview"`
+	TemplateSchema     string `long:"template-schema" env:"APIMTOOL_TEMPLATE_SCHEMA" description:"Deployment template schema of generated templates, default of config or 2019-04-01"`
+}
 
-	Confirm bool `short:"y"`
+// Authentication options, available for every command and read from environment variables when not set
+type AuthOptions struct {
+	Method             string `long:"auth" env:"APIMTOOL_AUTH" description:"Authentication method: default, cli, secret, certificate, workload-identity, managed-identity or device-code" default:"default"`
+	TenantID           string `long:"tenant-id" env:"AZURE_TENANT_ID" description:"Tenant ID of service principal, workload identity or device code"`
+	ClientID           string `long:"client-id" env:"AZURE_CLIENT_ID" description:"Client ID of service principal, workload identity, managed identity or device code"`
+	CertificatePath    string `long:"certificate-path" env:"AZURE_CLIENT_CERTIFICATE_PATH" description:"Path to PEM or PKCS12 certificate of service principal"`
+	FederatedTokenFile string `long:"federated-token-file" env:"AZURE_FEDERATED_TOKEN_FILE" description:"Path to federated token of workload identity"`
+	Cloud              string `long:"cloud" env:"APIMTOOL_AZURE_CLOUD" description:"Azure cloud" choice:"public" choice:"china" choice:"usgov" default:"public"`
+	ARMEndpoint        string `long:"arm-endpoint" env:"APIMTOOL_ARM_ENDPOINT" description:"Resource Manager endpoint instead of the endpoint of the cloud, e.g. a stand-in server for tests"`
 }
 
+var (
+	options     Options
+	authOptions AuthOptions
+	ctx         context.Context
+)
+
 func main() {
 	//init log
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
@@ -58,183 +69,53 @@ func main() {
 	log.Logger = log.With().Caller().Logger()
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
 
-	var options Options
-	parser := flags.NewParser(&options, flags.PrintErrors|flags.PassDoubleDash)
-	if _, err := parser.Parse(); err != nil {
-		log.Error().Err(err)
-		color.New(color.FgHiRed).Println("Error")
+	// cancel in-flight requests to Azure on Ctrl+C
+	var stop context.CancelFunc
+	ctx, stop = signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
+	parser := flags.NewNamedParser("apimtool", flags.HelpFlag|flags.PassDoubleDash)
+	parser.LongDescription = label
+	parser.SubcommandsOptional = true
+	if _, err := parser.AddGroup("Global Options", "", &options); err != nil {
+		log.Fatal().Err(err).Msg("cannot add global options")
+	}
+	if _, err := parser.AddGroup("Authentication Options", "", &authOptions); err != nil {
+		log.Fatal().Err(err).Msg("cannot add authentication options")
+	}
+	addCommands(parser)
+	parser.CommandHandler = func(command flags.Commander, args []string) error {
+		// positional args of commands are declared with positional-args, other args are not expected
+		if command == nil {
+			if len(args) > 0 {
+				return &flags.Error{Type: flags.ErrUnknownCommand, Message: "unknown command `" + args[0] + "', use `apimtool --help' to list the commands"}
+			}
+			return nil
+		}
+		currentCommand = commandPath(parser.Active)
+		if len(args) > 0 {
+			return &flags.Error{Type: flags.ErrUnknownFlag, Message: "unexpected argument(s) " + strings.Join(args, " ") + " of `" + currentCommand + "'"}
+		}
+		return command.Execute(args)
 	}
 
-	flags.NewIniParser(parser)
+	if _, err := parser.Parse(); err != nil {
+		var flagsErr *flags.Error
+		if errors.As(err, &flagsErr) && flagsErr.Type == flags.ErrHelp {
+			fmt.Print(flagsErr.Message + "\n")
+			return
+		}
 
-	if options.Version {
-		fmt.Print("apimtool version " + version + "\n")
-		return
+		os.Exit(reportError(parser, err))
 	}
 
-	if options.Helps {
-		fmt.Print(label)
+	if parser.Active != nil {
+		return
 	}
 
-	if len(os.Args) > 1 {
-
-		switch os.Args[1] {
-		case "parse":
-			{
-				// PREPARATION and AUTH
-				apimEnv := apim.Env()
-
-				cred, err := azidentity.NewDefaultAzureCredential(nil)
-				if err != nil {
-					log.Error().Err(err).Msg("apim azidentity error")
-					os.Exit(-1)
-				}
-
-				e := engine.Engine{APIM: apim.APIM{
-					SubscriptionID: apimEnv.SubscriptionID,
-					Location:       apimEnv.Location,
-					Credential:     cred,
-					Context:        context.Background(),
-				}}
-
-				if options.ResourceGroup != "" && options.ServiceName != "" && options.Environment != "" && options.ApiID != "" {
-					//go run main.go parse --env dev --api-id digital-trading --resource-group rg-tarathec-poc-az-asse-sbx-001 --service-name apimpocazassesbx003
-					e.ConfigParser(options.Environment, options.ApiID, options.ResourceGroup, options.ServiceName, options.FilePath)
-					return
-				}
-
-				printExCommand("--resource-group/-g, --service-name/-n --env --api-id\nthe directories and config files are required: ./apis/dev/{api-id}.json ./apim-dev/sources/ ./apim-dev/templates/backends.template.json or use --file-path", true, "apimtool parse --resource-group", "myresourcegroup", "--service-name", "myservice", "--env", "dev", "--api-id", "api-name-id")
-				printExCommand("", false, "apimtool parse --resource-group", "myresourcegroup", "--service-name", "myservice", "--env", "dev", "--api-id", "api-name-id", "--file-path", "./path-to-api/api.json")
-				printLast()
-				return
-			}
-		case "apim":
-			{
-				// PREPARATION and AUTH
-				apimEnv := apim.Env()
-				cred, err := azidentity.NewDefaultAzureCredential(nil)
-				if err != nil {
-					log.Error().Err(err).Msg("apim azidentity error")
-					os.Exit(-1)
-				}
-
-				apim := apim.APIM{
-					SubscriptionID: apimEnv.SubscriptionID,
-					Location:       apimEnv.Location,
-					Credential:     cred,
-					Context:        context.Background(),
-				}
-
-				if len(os.Args) > 2 && os.Args[2] == "api" {
-					if len(os.Args) > 3 && os.Args[3] == "list" {
-						if options.ResourceGroup != "" && options.ServiceName != "" {
-							apim.ListAPI(options.ResourceGroup, options.ServiceName, options.FilterDisplayName, options.Option)
-							return
-						}
-
-						printExCommand("--resource-group/-g, --service-name/-n", true, "apimtool apim api list --resource-group", "myresourcegroup", "--service-name", "myservice")
-						printExCommand("", false, "apimtool apim api list --resource-group", "myresourcegroup", "--service-name", "myservice", "--filter-display-name", "myfilterdisplay")
-						printExCommand("", false, "apimtool apim api list --resource-group", "myresourcegroup", "--service-name", "myservice", "--filter-display-name", "myfilterdisplay", "--option", "table/list")
-
-					}
-				}
-				if len(os.Args) > 2 && os.Args[2] == "backend" {
-
-					if len(os.Args) > 3 && os.Args[3] == "api" {
-						if len(os.Args) > 4 && os.Args[4] == "depend" {
-							if len(os.Args) > 5 && os.Args[5] == "list" {
-								if (options.ResourceGroup != "" && options.ServiceName != "") && (options.BackendID != "" || options.URL != "") {
-									apim.ListAPIsDependingOnBackend(options.ResourceGroup, options.ServiceName, options.BackendID, options.URL)
-									return
-								}
-
-								printExCommand("--resource-group/-g, --service-name/-n --backend-id or --url", true, "apimtool apim backend api depend list --resource-group", "myresourcegroup", "--service-name", "myservice", "--backend-id", "mybackend-id", "--url", "https://127.0.0.1")
-								printExCommand("", false, "apimtool apim backend api depend list --resource-group", "myresourcegroup", "--service-name", "myservice", "--backend-id", "mybackend-id")
-								printExCommand("", false, "apimtool apim backend api depend list --resource-group", "myresourcegroup", "--service-name", "myservice", "--url", "https://127.0.0.1")
-							}
-							if len(os.Args) > 5 && os.Args[5] == "update" {
-								//UPDATE BACKEND TO APIS
-							}
-						}
-					}
-
-					if len(os.Args) > 3 && os.Args[3] == "list" {
-						if options.ResourceGroup != "" && options.ServiceName != "" {
-							apim.ListBackend(options.ResourceGroup, options.ServiceName, options.FilterDisplayName, options.Option)
-							return
-						}
-
-						printExCommand("--resource-group/-g, --service-name/-n", true, "apimtool apim backend list --resource-group", "myresourcegroup", "--service-name", "myservice")
-						printExCommand("", false, "apimtool apim backend list --resource-group", "myresourcegroup", "--service-name", "myservice", "--filter-display-name", "myfilterdisplay")
-						printExCommand("", false, "apimtool apim backend list --resource-group", "myresourcegroup", "--service-name", "myservice", "--filter-display-name", "myfilterdisplay", "--option", "table/list")
-					}
-
-					//Create or Update Backend URL directly to APIM (Not update at backends.template.json)
-					if len(os.Args) > 3 && os.Args[3] == "create" {
-						if options.ResourceGroup != "" && options.ServiceName != "" && options.BackendID != "" {
-							apim.CreateOrUpdateBackend(options.ResourceGroup, options.ServiceName, options.BackendID, options.URL, options.Protocol)
-							return
-						}
-						//go run main.go apim backend create --resource-group rg-tarathec-poc-az-asse-sbx-001 --service-name apimpocazassesbx003 --backend-id hello --url https://tarathep.com --protocol soap
-						printExCommand("--resource-group/-g, --service-name/-n --backend-id --url --protocol {http/soap}", true, "apimtool apim backend create --resource-group", "myresourcegroup", "--service-name", "myservice", "--backend-id", "my-backend-id", "--url", "https://127.0.0.1:8081", "--protocol", "http")
-					}
-				}
-				printLast()
-				return
-			}
-		case "template":
-			{
-				//trust
-				if len(os.Args) > 2 && os.Args[2] == "backend" {
-					if len(os.Args) > 3 && os.Args[3] == "export" {
-
-						// PREPARATION and AUTH
-						apimEnv := apim.Env()
-						cred, err := azidentity.NewDefaultAzureCredential(nil)
-						if err != nil {
-							log.Error().Err(err).Msg("apim azidentity error")
-							os.Exit(-1)
-						}
-
-						apim := apim.APIM{
-							SubscriptionID: apimEnv.SubscriptionID,
-							Location:       apimEnv.Location,
-							Credential:     cred,
-							Context:        context.Background(),
-						}
-
-						if options.ResourceGroup != "" && options.ServiceName != "" {
-							apim.ExportBackendsTemplate(options.ResourceGroup, options.ServiceName, options.FilePath)
-							return
-						}
-						printExCommand("--resource-group/-g, --service-name/-n", true, "apimtool template backend export --resource-group", "myresourcegroup", "--service-name", "myservice")
-						printExCommand("--resource-group/-g, --service-name/-n", false, "apimtool template backend export --resource-group", "myresourcegroup", "--service-name", "myservice", "--file-path", "./templates/")
-					}
-
-					if len(os.Args) > 3 && os.Args[3] == "create" {
-						if options.BackendID != "" && options.URL != "" && options.Protocol != "" {
-							e := engine.Engine{}
-							e.AddBackendTemplateJSON(options.BackendID, options.URL, options.Protocol)
-							return
-						}
-						printExCommand("--backend-id --url --protocol {http/soap}\nthe directories and config files are required: ./templates/backends.template.json", true, "apimtool template backend create", "--backend-id", "my-backend-id", "--url", "https://127.0.0.1:8081", "--protocol", "http")
-					}
-
-					// bug
-					if len(os.Args) > 3 && os.Args[3] == "delete" {
-						if options.BackendID != "" {
-							e := engine.Engine{}
-							e.DeleteBackendTemplateJSONByID(options.BackendID)
-							return
-						}
-						printExCommand("--env --backend-id\nthe directories and config files are required: ./templates/backends.template.json", true, "apimtool template backend delete", "--backend-id", "my-backend-id")
-					}
-					printLast()
-					return
-				}
-			}
-		}
+	if options.Version {
+		fmt.Print("apimtool version " + version + "\n")
+		return
 	}
 
 	color.New(color.FgHiBlue).Println(`
@@ -247,33 +128,81 @@ func main() {
 	fmt.Print("\nWelcome to the APIM Tool CLI!\n")
 
 	fmt.Print("To support configuration of Microsoft Azure API Management\nUse `apimtool --version` to display the current version.\n")
+	fmt.Print("Use `apimtool {command} --help` to display the usage of a command.\n")
 	fmt.Print("Here are the base commands:\n\n")
 
-	fmt.Print("\tparse \t\t: Parsing Configuration files to Source files to support Azure API Management DevOps Resource Kit,\n\t\t\t please refer https://github.com/Azure/azure-api-management-devops-resource-kit\n")
-	fmt.Print("\tapim \t\t: Manage Azure API Management services.\n")
-	fmt.Print("\ttemplate \t: Manage template files configuration to support Azure Resource Manager template.\n\n")
+	for _, command := range parser.Commands() {
+		tabs := "\t\t"
+		if len(command.Name) >= 8 {
+			tabs = "\t"
+		}
+		fmt.Print("\t" + command.Name + " " + tabs + ": " + command.ShortDescription + "\n")
+	}
+	fmt.Print("\n")
 
 	printLast()
 
 }
 
-func printExCommand(req string, header bool, options ...string) {
-	if req != "" {
-		color.New(color.FgHiRed).Print("the following arguments are required: " + req + "\n")
+// PREPARATION and AUTH
+func newAPIM() (apim.APIM, error) {
+	apimEnv, err := apim.Env()
+	if err != nil {
+		return apim.APIM{}, err
 	}
 
-	if header {
-		fmt.Print("\nExamples:\n")
+	cred, cloud, err := newCredential(authOptions)
+	if err != nil {
+		return apim.APIM{}, err
 	}
-	for i, option := range options {
-		if (i % 2) == 0 {
-			color.New(color.FgHiBlue).Print(option)
-		} else {
-			fmt.Print(option)
-		}
-		fmt.Print(" ")
+	template, err := templateOptions()
+	if err != nil {
+		return apim.APIM{}, err
 	}
-	fmt.Print("\n\n")
+
+	return apim.APIM{
+		SubscriptionID: apimEnv.SubscriptionID,
+		Location:       apimEnv.Location,
+		Credential:     cred,
+		Cloud:          cloud,
+		Context:        ctx,
+		Parallel:       options.Parallel,
+		Cache:          options.Cache,
+		Template:       template,
+		URLMatch:       options.URLMatch,
+	}, nil
+}
+
+// ARM client of the subscription and credential of a
+func newARM(a apim.APIM) arm.ARM {
+	return arm.ARM{
+		SubscriptionID: a.SubscriptionID,
+		Location:       a.Location,
+		Credential:     a.Credential,
+		Cloud:          a.Cloud,
+		Context:        a.Context,
+	}
+}
+
+// Credential and cloud of the authentication options
+func newCredential(o AuthOptions) (azcore.TokenCredential, cloud.Configuration, error) {
+	cloud, err := apim.Cloud(o.Cloud)
+	if err != nil {
+		return nil, cloud, err
+	}
+	if o.ARMEndpoint != "" {
+		cloud = apim.WithResourceManagerEndpoint(cloud, o.ARMEndpoint)
+	}
+
+	cred, err := apim.NewCredential(apim.CredentialOptions{
+		Method:             o.Method,
+		TenantID:           o.TenantID,
+		ClientID:           o.ClientID,
+		CertificatePath:    o.CertificatePath,
+		FederatedTokenFile: o.FederatedTokenFile,
+		Cloud:              cloud,
+	})
+	return cred, cloud, err
 }
 
 func printLast() {
@@ -1,12 +1,16 @@
 package models
 
 type API struct {
-	Version  string   `json:"version"`
-	Apiname  string   `json:"apiname"`
-	Env      string   `json:"env"`
-	Tags     []string `json:"tags"`
-	Policies struct {
+	Version          string   `json:"version"`
+	VersioningScheme string   `json:"versioning-scheme"`
+	Revision         int      `json:"revision"`
+	Apiname          string   `json:"apiname"`
+	Env              string   `json:"env"`
+	Tags             []string `json:"tags"`
+	Policies         struct {
 		BackendURL string `json:"backend-url"`
+		// backend of the policy when backend-url is used by more than one backend
+		BackendID  string `json:"backend-id,omitempty"`
 		SetHeaders []struct {
 			Name  string `json:"name"`
 			Value string `json:"value"`
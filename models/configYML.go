@@ -1,10 +1,19 @@
 package models
 
 type ConfigYML struct {
-	Version         string      `yaml:"version"`
-	ApimServiceName string      `yaml:"apimServiceName"`
-	Apis            []APIConfig `yaml:"apis"`
-	OutputLocation  string      `yaml:"outputLocation"`
+	Version         string             `yaml:"version"`
+	ApimServiceName string             `yaml:"apimServiceName"`
+	APIVersionSets  []APIVersionSetYML `yaml:"apiVersionSets,omitempty"`
+	Apis            []APIConfig        `yaml:"apis"`
+	OutputLocation  string             `yaml:"outputLocation"`
+}
+
+type APIVersionSetYML struct {
+	ID                string `yaml:"id"`
+	DisplayName       string `yaml:"displayName"`
+	VersioningScheme  string `yaml:"versioningScheme"`
+	VersionQueryName  string `yaml:"versionQueryName,omitempty"`
+	VersionHeaderName string `yaml:"versionHeaderName,omitempty"`
 }
 
 type APIConfig struct {
@@ -14,6 +23,8 @@ type APIConfig struct {
 	Suffix                 string `yaml:"suffix"`
 	Protocols              string `yaml:"protocols"`
 	Revision               int    `yaml:"revision"`
+	APIVersion             string `yaml:"apiVersion,omitempty"`
+	APIVersionSetID        string `yaml:"apiVersionSetId,omitempty"`
 	AuthenticationSettings struct {
 		SubscriptionKeyRequired bool `yaml:"subscriptionKeyRequired"`
 	} `yaml:"authenticationSettings"`
@@ -0,0 +1,662 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/tarathep/apimtool/apim"
+	"github.com/tarathep/apimtool/arm"
+	"github.com/tarathep/apimtool/engine"
+)
+
+func printTitle(title string) {
+	color.New(color.Italic, color.FgHiBlue, color.Bold).Print(title + "\n\n")
+}
+
+func printNotFound() {
+	color.New(color.FgHiBlue).Println("Not Found")
+}
+
+func printTimeUsed(start time.Time) {
+	fmt.Println("\nTime used is ", time.Since(start))
+}
+
+// Print label of a step then Done or Fail of fn, error is returned to be reported by main
+func step(label string, fn func() error) error {
+	color.New(color.FgHiBlack).Print(label + " : ")
+	if err := fn(); err != nil {
+		color.New(color.FgHiRed).Print("Fail\n\n")
+		return err
+	}
+	color.New(color.FgHiGreen).Print("Done\n")
+	return nil
+}
+
+func printError(err error) {
+	color.New(color.FgHiRed).Fprintln(os.Stderr, "ERROR", err)
+}
+
+func protocols(ps []string) string {
+	s := ""
+	for _, p := range ps {
+		s += " " + p
+	}
+	return s
+}
+
+func printBackends(backends []apim.Backend, option string) {
+	if len(backends) == 0 {
+		printNotFound()
+		return
+	}
+
+	switch option {
+	case "", "table":
+		// find max len values for print
+		maxNameSize, maxBackendURLSize := 4, 10
+		for _, backend := range backends {
+			if len(backend.Name) > maxNameSize {
+				maxNameSize = len(backend.Name)
+			}
+			if len(backend.URL) > maxBackendURLSize {
+				maxBackendURLSize = len(backend.URL)
+			}
+		}
+
+		color.New(color.FgHiMagenta).Printf("%*s  %*s  %*s\n", 3, "No.", maxNameSize, "NAME", maxBackendURLSize, "BackendURL")
+		for i, backend := range backends {
+			color.New(color.FgHiWhite).Printf("%*d  %*s  %*s\n", 3, (i + 1), maxNameSize, backend.Name, maxBackendURLSize, backend.URL)
+		}
+	case "list":
+		for i, backend := range backends {
+			color.New(color.FgHiBlack).Print("No : ")
+			fmt.Println(1 + i)
+			color.New(color.FgHiBlack).Print("BACKEND NAME : ")
+			fmt.Println(backend.Name)
+			color.New(color.FgHiBlack).Print("BACKEND URL : ")
+			fmt.Println(backend.URL)
+			color.New(color.FgHiBlack).Print("BACKEND Protocol : ")
+			fmt.Println(backend.Protocol)
+			color.New(color.FgHiWhite).Println("------------------------------------------------------------")
+		}
+	}
+}
+
+// Row of the API table
+type apiRow struct {
+	Name, DisplayName, Protocols, Path, BackendURL string
+}
+
+func printAPITable(rows []apiRow) {
+	if len(rows) == 0 {
+		printNotFound()
+		return
+	}
+
+	// find max len values for print
+	maxApiNameSize, maxDisplayNameSize, maxProtocalSize, maxApiPathSize, maxApiBackendURLSize := 4, 11, 11, 4, 10
+	for _, row := range rows {
+		if len(row.Name) > maxApiNameSize {
+			maxApiNameSize = len(row.Name)
+		}
+		if len(row.DisplayName) > maxDisplayNameSize {
+			maxDisplayNameSize = len(row.DisplayName)
+		}
+		if len(row.Protocols) > maxProtocalSize {
+			maxProtocalSize = len(row.Protocols)
+		}
+		if len(row.Path) > maxApiPathSize {
+			maxApiPathSize = len(row.Path)
+		}
+		if len(row.BackendURL) > maxApiBackendURLSize {
+			maxApiBackendURLSize = len(row.BackendURL)
+		}
+	}
+
+	color.New(color.FgHiMagenta).Printf("%*s  %*s  %*s  %*s  %*s  %*s\n", 3, "No.", maxApiNameSize, "NAME", maxDisplayNameSize, "DisplayName", maxProtocalSize, "Protocol(s)", maxApiPathSize, "Path", maxApiBackendURLSize, "BackendURL")
+	for i, row := range rows {
+		color.New(color.FgHiWhite).Printf("%*d  %*s  %*s  %*s  %*s  %*s\n", 3, (i + 1), maxApiNameSize, row.Name, maxDisplayNameSize, row.DisplayName, maxProtocalSize, row.Protocols, maxApiPathSize, row.Path, maxApiBackendURLSize, row.BackendURL)
+	}
+}
+
+func printAPIs(apis []apim.Api) {
+	rows := []apiRow{}
+	for _, api := range apis {
+		rows = append(rows, apiRow{api.Name, api.DisplayName, protocols(api.Protocols), api.Path, api.BackendURL})
+	}
+	printAPITable(rows)
+}
+
+func printAPIModelTable(apiModels []apim.APIModel) {
+	rows := []apiRow{}
+	for _, api := range apiModels {
+		rows = append(rows, apiRow{api.APIName, api.APIDisplayName, protocols(api.APIProtocols), api.APIPath, api.APIBackendURL})
+	}
+	printAPITable(rows)
+}
+
+func printAPIModels(apiModels []apim.APIModel) {
+	if len(apiModels) == 0 {
+		printNotFound()
+		return
+	}
+
+	for i, model := range apiModels {
+		color.New(color.FgHiBlack).Print("No : ")
+		fmt.Println(1 + i)
+		color.New(color.FgHiBlack).Print("API NAME : ")
+		fmt.Println(model.APIName)
+		color.New(color.FgHiBlack).Print("API DISPLAY NAME : ")
+		fmt.Println(model.APIDisplayName)
+		color.New(color.FgHiBlack).Print("PROTOCOL(s) : ")
+		fmt.Println(model.APIProtocols)
+		color.New(color.FgHiBlack).Print("PATH : ")
+		fmt.Println(model.APIPath)
+		color.New(color.FgHiBlack).Print("Backend URL : ")
+		fmt.Println(model.APIBackendURL)
+		color.New(color.FgHiBlack).Print("Backend Policy ID : ")
+		fmt.Println(model.BackendPolicyID)
+		color.New(color.FgHiBlack).Print("Backend Policy URL : ")
+		fmt.Println(model.BackendPolicyURL)
+
+		color.New(color.FgHiBlack).Print("Operations : \n")
+		for i, operation := range model.Operation {
+			color.New(color.FgHiWhite).Print("  ", (i + 1), " ")
+			switch operation.Method {
+			case "GET":
+				color.New(color.FgHiBlue).Print(operation.Method, " ")
+			case "POST":
+				color.New(color.FgHiGreen).Print(operation.Method, " ")
+			case "PUT":
+				color.New(color.FgHiYellow).Print(operation.Method, " ")
+			case "DELETE":
+				color.New(color.FgHiRed).Print(operation.Method, " ")
+			case "PATCH":
+				color.New(color.FgHiCyan).Print(operation.Method, " ")
+			default:
+				color.New(color.FgHiBlack).Print(operation.Method, " ")
+			}
+			color.New(color.FgHiWhite).Println(operation.Name, operation.URLTemplate)
+		}
+		color.New(color.FgHiWhite).Println("------------------------------------------------------------")
+	}
+}
+
+func printRevisions(revisions []apim.Revision) {
+	if len(revisions) == 0 {
+		printNotFound()
+		return
+	}
+
+	maxDescriptionSize := 11
+	for _, revision := range revisions {
+		if len(revision.Description) > maxDescriptionSize {
+			maxDescriptionSize = len(revision.Description)
+		}
+	}
+
+	color.New(color.FgHiMagenta).Printf("%*s  %*s  %*s  %*s  %*s\n", 8, "Revision", 7, "Current", 6, "Online", 19, "Created", maxDescriptionSize, "Description")
+	for _, revision := range revisions {
+		c := color.New(color.FgHiWhite)
+		if revision.IsCurrent {
+			c = color.New(color.FgHiGreen)
+		}
+		c.Printf("%*s  %*t  %*t  %*s  %*s\n", 8, revision.Revision, 7, revision.IsCurrent, 6, revision.IsOnline, 19, revision.Created, maxDescriptionSize, revision.Description)
+	}
+}
+
+func printVersionSets(versionSets []apim.VersionSet) {
+	if len(versionSets) == 0 {
+		printNotFound()
+		return
+	}
+
+	maxNameSize, maxDisplayNameSize := 4, 11
+	for _, versionSet := range versionSets {
+		if len(versionSet.Name) > maxNameSize {
+			maxNameSize = len(versionSet.Name)
+		}
+		if len(versionSet.DisplayName) > maxDisplayNameSize {
+			maxDisplayNameSize = len(versionSet.DisplayName)
+		}
+	}
+
+	color.New(color.FgHiMagenta).Printf("%*s  %*s  %*s  %*s\n", 3, "No.", maxNameSize, "NAME", maxDisplayNameSize, "DisplayName", 7, "Scheme")
+	for i, versionSet := range versionSets {
+		color.New(color.FgHiWhite).Printf("%*d  %*s  %*s  %*s\n", 3, (i + 1), maxNameSize, versionSet.Name, maxDisplayNameSize, versionSet.DisplayName, 7, versionSet.VersioningScheme)
+	}
+}
+
+func printFindings(findings []apim.Finding) {
+	if len(findings) == 0 {
+		color.New(color.FgHiGreen).Println("No finding")
+		return
+	}
+
+	source := ""
+	for _, finding := range findings {
+		if finding.Source != source {
+			source = finding.Source
+			color.New(color.FgHiMagenta).Println("Source : " + source)
+			color.New(color.FgHiWhite).Println("------------------------------------------------------------")
+		}
+
+		switch finding.Kind {
+		case apim.FindingMissing:
+			color.New(color.FgHiRed).Printf("%-20s ", finding.Kind)
+		case apim.FindingMismatch, apim.FindingDuplicate:
+			color.New(color.FgHiYellow).Printf("%-20s ", finding.Kind)
+		default:
+			color.New(color.FgHiBlack).Printf("%-20s ", finding.Kind)
+		}
+		fmt.Println(finding.Detail)
+	}
+
+	counts := map[string]int{}
+	for _, finding := range findings {
+		counts[finding.Kind]++
+	}
+	fmt.Printf("\n%d finding(s) : %d %s, %d %s, %d %s, %d %s\n", len(findings),
+		counts[apim.FindingMissing], apim.FindingMissing, counts[apim.FindingMismatch], apim.FindingMismatch,
+		counts[apim.FindingDuplicate], apim.FindingDuplicate, counts[apim.FindingOrphan], apim.FindingOrphan)
+}
+
+func printParseResult(result engine.ParseResult) {
+	color.New(color.FgHiBlack).Print("Backend ID : ")
+	fmt.Println(result.BackendID)
+	if len(result.BackendIDs) > 1 {
+		color.New(color.FgHiYellow).Print("Backend URL is used by more than one backend ", result.BackendIDs, ", select "+result.BackendID+" by "+result.BackendSelection+"\n")
+	}
+	for _, backend := range result.CreatedBackends {
+		color.New(color.FgHiYellow).Print("Create backend " + backend.Backend.Name + " (" + backend.Backend.URL + ") in " + createdBackendIn(backend) + "\n")
+	}
+	fmt.Print("\n")
+	for _, file := range result.Files {
+		color.New(color.FgHiBlack).Print("Generate " + file + " : ")
+		color.New(color.FgHiGreen).Print("Done\n")
+	}
+	fmt.Print("\n")
+}
+
+// Where a backend was created by parse, backends.template.json and/or APIM
+func createdBackendIn(backend engine.CreatedBackend) string {
+	in := []string{}
+	if backend.Change != nil {
+		in = append(in, filepath.Base(backend.Change.Path))
+	}
+	if backend.InAPIM {
+		in = append(in, "APIM")
+	}
+	return strings.Join(in, " and ")
+}
+
+func printParseSummary(outcomes []engine.ParseOutcome) {
+	maxAPIIDSize, maxBackendIDSize := 6, 10
+	for _, outcome := range outcomes {
+		if len(outcome.APIID) > maxAPIIDSize {
+			maxAPIIDSize = len(outcome.APIID)
+		}
+		if len(outcome.Result.BackendID) > maxBackendIDSize {
+			maxBackendIDSize = len(outcome.Result.BackendID)
+		}
+	}
+
+	counts := map[string]int{}
+	color.New(color.FgHiMagenta).Printf("%-*s  %-9s  %-*s  %s\n", maxAPIIDSize, "API ID", "Status", maxBackendIDSize, "Backend ID", "Reason")
+	for _, outcome := range outcomes {
+		counts[outcome.Status]++
+		fmt.Printf("%-*s  ", maxAPIIDSize, outcome.APIID)
+		switch outcome.Status {
+		case engine.ParseSucceeded:
+			color.New(color.FgHiGreen).Printf("%-9s  ", outcome.Status)
+		case engine.ParseFailed:
+			color.New(color.FgHiRed).Printf("%-9s  ", outcome.Status)
+		default:
+			color.New(color.FgHiYellow).Printf("%-9s  ", outcome.Status)
+		}
+		fmt.Printf("%-*s  ", maxBackendIDSize, outcome.Result.BackendID)
+		reason := outcome.Reason
+		if reason == "" && len(outcome.Result.BackendIDs) > 1 {
+			reason = "backend URL is used by " + strings.Join(outcome.Result.BackendIDs, ", ") + ", select " + outcome.Result.BackendID + " by " + outcome.Result.BackendSelection
+		}
+		for _, backend := range outcome.Result.CreatedBackends {
+			if reason != "" {
+				reason += ", "
+			}
+			reason += "created backend " + backend.Backend.Name + " in " + createdBackendIn(backend)
+		}
+		color.New(color.FgHiBlack).Println(reason)
+	}
+	fmt.Printf("\n%d API(s) : %d %s, %d %s, %d %s\n", len(outcomes),
+		counts[engine.ParseSucceeded], engine.ParseSucceeded, counts[engine.ParseFailed], engine.ParseFailed, counts[engine.ParseSkipped], engine.ParseSkipped)
+}
+
+// Print request which would be sent to Azure Resource Manager
+func printRequest(request apim.Request) error {
+	return printRequests([]apim.Request{request})
+}
+
+// Print requests which would be sent in order
+func printRequests(requests []apim.Request) error {
+	color.New(color.FgHiYellow).Print("Dry run, request is not sent\n")
+	for _, request := range requests {
+		body, err := json.MarshalIndent(request.Body, "", "  ")
+		if err != nil {
+			return err
+		}
+		color.New(color.FgHiMagenta).Print("\n" + request.Method + " " + request.URL + "\n")
+		fmt.Print(string(body) + "\n")
+	}
+	return nil
+}
+
+// Print unified diff which would be applied
+func printDiff(diff string) {
+	color.New(color.FgHiYellow).Print("Dry run, file is not changed\n\n")
+	if diff == "" {
+		fmt.Print("No change\n")
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			color.New(color.Bold).Println(line)
+		case strings.HasPrefix(line, "@@"):
+			color.New(color.FgHiCyan).Println(line)
+		case strings.HasPrefix(line, "+"):
+			color.New(color.FgHiGreen).Println(line)
+		case strings.HasPrefix(line, "-"):
+			color.New(color.FgHiRed).Println(line)
+		default:
+			fmt.Println(line)
+		}
+	}
+}
+
+func printSnapshot(path string, snapshot apim.Snapshot) {
+	color.New(color.FgHiBlack).Print("Snapshot \t: ")
+	fmt.Println(path)
+	color.New(color.FgHiBlack).Print("Service \t: ")
+	fmt.Println(snapshot.ResourceGroup + "/" + snapshot.ServiceName)
+	color.New(color.FgHiBlack).Print("Created \t: ")
+	fmt.Println(snapshot.CreatedAt.Format(time.RFC3339))
+	color.New(color.FgHiBlack).Print("Entities \t: ")
+	fmt.Printf("%d backend(s), %d API(s), %d named value(s), %d version set(s)\n", len(snapshot.Backends), len(snapshot.APIs), len(snapshot.NamedValues), len(snapshot.VersionSets))
+}
+
+func printValidationReport(report engine.ValidationReport) {
+	byFile := map[string][]engine.ValidationIssue{}
+	for _, issue := range report.Issues {
+		byFile[issue.File] = append(byFile[issue.File], issue)
+	}
+
+	for _, file := range report.Files {
+		issues := byFile[file]
+		if len(issues) == 0 {
+			color.New(color.FgHiGreen).Print("OK   ")
+			fmt.Println(file)
+			continue
+		}
+		color.New(color.FgHiRed).Print("FAIL ")
+		fmt.Println(file)
+		for _, issue := range issues {
+			color.New(color.FgHiYellow).Printf("     %-22s ", issue.Kind)
+			if issue.Resource != "" {
+				color.New(color.FgHiBlack).Print(issue.Resource, " : ")
+			}
+			fmt.Println(issue.Detail)
+		}
+	}
+
+	fmt.Print("\n")
+	if len(report.Issues) == 0 {
+		color.New(color.FgHiGreen).Printf("%d file(s) valid\n", len(report.Files))
+		return
+	}
+	fmt.Printf("%d issue(s) in %d of %d file(s)\n", len(report.Issues), len(byFile), len(report.Files))
+}
+
+func printDifferences(sourceA, sourceB string, differences []apim.Difference) {
+	color.New(color.FgHiBlack).Print("A : ")
+	fmt.Println(sourceA)
+	color.New(color.FgHiBlack).Print("B : ")
+	fmt.Print(sourceB, "\n\n")
+
+	if len(differences) == 0 {
+		color.New(color.FgHiGreen).Println("No difference")
+		return
+	}
+
+	for _, difference := range differences {
+		switch difference.Kind {
+		case apim.DifferenceOnlyInA:
+			color.New(color.FgHiRed).Print("- ", difference.Entity)
+			color.New(color.FgHiBlack).Println("  only in A")
+		case apim.DifferenceOnlyInB:
+			color.New(color.FgHiGreen).Print("+ ", difference.Entity)
+			color.New(color.FgHiBlack).Println("  only in B")
+		default:
+			color.New(color.FgHiYellow).Print("~ ", difference.Entity, " ", difference.Field)
+			if difference.Field == "policy" {
+				fmt.Print("\n")
+				for _, line := range strings.Split(strings.TrimSuffix(engine.UnifiedDiff("A", "B", apim.NormalizePolicy(difference.A), apim.NormalizePolicy(difference.B)), "\n"), "\n")[2:] {
+					fmt.Println("    " + line)
+				}
+				continue
+			}
+			fmt.Print(" : ", difference.A, " -> ", difference.B, "\n")
+		}
+	}
+	fmt.Printf("\n%d difference(s)\n", len(differences))
+}
+
+// Resource ID without subscription and resource group, e.g. Microsoft.ApiManagement/service/myservice/backends/mybackend
+func shortResourceID(id string) string {
+	if i := strings.Index(strings.ToLower(id), "/providers/"); i >= 0 {
+		return id[i+len("/providers/"):]
+	}
+	return id
+}
+
+func printChanges(changes []arm.Change) {
+	if len(changes) == 0 {
+		color.New(color.FgHiGreen).Println("No change")
+		return
+	}
+
+	for _, change := range changes {
+		symbol, c := changeSymbol(change.ChangeType)
+		c.Printf("%-2s %-9s ", symbol, change.ChangeType)
+		fmt.Println(shortResourceID(change.ResourceID))
+
+		switch change.ChangeType {
+		case arm.ChangeCreate:
+			if url := payloadURL(change.After); url != "" {
+				fmt.Println("      url : " + url)
+			}
+		case arm.ChangeDelete:
+			if url := payloadURL(change.Before); url != "" {
+				fmt.Println("      url : " + url)
+			}
+		case arm.ChangeModify:
+			printPropertyChanges(change.Delta, "", "      ")
+		}
+	}
+
+	counts := map[string]int{}
+	for _, change := range changes {
+		counts[change.ChangeType]++
+	}
+	fmt.Printf("\n%d resource(s) : %d to create, %d to modify, %d to delete, %d no change\n", len(changes),
+		counts[arm.ChangeCreate], counts[arm.ChangeModify], counts[arm.ChangeDelete], counts[arm.ChangeNoChange])
+}
+
+// Symbol and color of change type of a resource or a property
+func changeSymbol(changeType string) (string, *color.Color) {
+	switch changeType {
+	case arm.ChangeCreate:
+		return "+", color.New(color.FgHiGreen)
+	case arm.ChangeDelete:
+		return "-", color.New(color.FgHiRed)
+	case arm.ChangeModify, "Array":
+		return "~", color.New(color.FgHiYellow)
+	case arm.ChangeDeploy:
+		return "!", color.New(color.FgHiBlue)
+	}
+	return "=", color.New(color.FgHiBlack)
+}
+
+// url of properties of a resource payload, e.g. of a backend
+func payloadURL(payload interface{}) string {
+	resource, _ := payload.(map[string]interface{})
+	properties, _ := resource["properties"].(map[string]interface{})
+	url, _ := properties["url"].(string)
+	return url
+}
+
+// Policy XML is shown as a diff of the normalized policies, other values in JSON
+func printPropertyChanges(changes []arm.PropertyChange, parent, indent string) {
+	for _, change := range changes {
+		path := change.Path
+		if parent != "" {
+			path = parent + "." + change.Path
+		}
+		if len(change.Children) > 0 {
+			printPropertyChanges(change.Children, path, indent)
+			continue
+		}
+
+		symbol, c := changeSymbol(change.ChangeType)
+		c.Print(indent + symbol + " " + path)
+		if before, after, ok := policyValues(change); ok {
+			fmt.Print("\n")
+			diff := engine.UnifiedDiff("before", "after", apim.NormalizePolicy(before), apim.NormalizePolicy(after))
+			for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+				if strings.HasPrefix(line, "---") || strings.HasPrefix(line, "+++") || line == "" {
+					continue
+				}
+				fmt.Println(indent + "    " + line)
+			}
+			continue
+		}
+		switch change.ChangeType {
+		case arm.ChangeCreate:
+			fmt.Println(" : " + jsonValue(change.After))
+		case arm.ChangeDelete:
+			fmt.Println(" : " + jsonValue(change.Before))
+		default:
+			fmt.Println(" : " + jsonValue(change.Before) + " => " + jsonValue(change.After))
+		}
+	}
+}
+
+// Before and after of a change of policy XML
+func policyValues(change arm.PropertyChange) (string, string, bool) {
+	before, _ := change.Before.(string)
+	after, _ := change.After.(string)
+	if strings.Contains(before, "<policies") || strings.Contains(after, "<policies") {
+		return before, after, true
+	}
+	return "", "", false
+}
+
+func jsonValue(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// What-if changes as markdown, the review artifact of a deployment
+func changesMarkdown(title string, changes []arm.Change) string {
+	var sb strings.Builder
+	sb.WriteString("# " + title + "\n\n")
+	if len(changes) == 0 {
+		sb.WriteString("No change\n")
+		return sb.String()
+	}
+
+	sb.WriteString("|Change|Resource|\n|--|--|\n")
+	for _, change := range changes {
+		sb.WriteString("|" + change.ChangeType + "|`" + shortResourceID(change.ResourceID) + "`|\n")
+	}
+
+	for _, change := range changes {
+		if change.ChangeType != arm.ChangeModify {
+			continue
+		}
+		sb.WriteString("\n## " + change.ChangeType + " `" + shortResourceID(change.ResourceID) + "`\n\n```diff\n")
+		writePropertyChangesMarkdown(&sb, change.Delta, "")
+		sb.WriteString("```\n")
+	}
+	return sb.String()
+}
+
+func writePropertyChangesMarkdown(sb *strings.Builder, changes []arm.PropertyChange, parent string) {
+	for _, change := range changes {
+		path := change.Path
+		if parent != "" {
+			path = parent + "." + change.Path
+		}
+		if len(change.Children) > 0 {
+			writePropertyChangesMarkdown(sb, change.Children, path)
+			continue
+		}
+		if before, after, ok := policyValues(change); ok {
+			sb.WriteString("# " + path + "\n")
+			diff := engine.UnifiedDiff("before", "after", apim.NormalizePolicy(before), apim.NormalizePolicy(after))
+			for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+				if !strings.HasPrefix(line, "---") && !strings.HasPrefix(line, "+++") && line != "" {
+					sb.WriteString(line + "\n")
+				}
+			}
+			continue
+		}
+		if change.ChangeType != arm.ChangeCreate {
+			sb.WriteString("- " + path + ": " + jsonValue(change.Before) + "\n")
+		}
+		if change.ChangeType != arm.ChangeDelete {
+			sb.WriteString("+ " + path + ": " + jsonValue(change.After) + "\n")
+		}
+	}
+}
+
+// Print the change of provisioning state of a resource while deploying
+func printOperationStatus(status arm.OperationStatus) {
+	color.New(color.FgHiBlack).Print(time.Now().Format("15:04:05"), " ")
+	switch status.ProvisioningState {
+	case "Succeeded":
+		color.New(color.FgHiGreen).Printf("%-10s ", status.ProvisioningState)
+	case "Failed":
+		color.New(color.FgHiRed).Printf("%-10s ", status.ProvisioningState)
+	default:
+		color.New(color.FgHiYellow).Printf("%-10s ", status.ProvisioningState)
+	}
+	fmt.Println(status.ResourceType + " " + status.ResourceName)
+}
+
+func printDeploymentFailures(err *arm.DeploymentError) {
+	if len(err.Failures) == 0 {
+		return
+	}
+	color.New(color.FgHiRed).Print("\nFailed resource(s) of deployment " + err.Name + "\n")
+	for _, failure := range err.Failures {
+		color.New(color.FgHiWhite).Println(failure.ResourceType + " " + failure.ResourceName)
+		printErrorDetail(*failure.Error, "  ")
+	}
+	fmt.Print("\n")
+}
+
+func printErrorDetail(detail arm.ErrorDetail, indent string) {
+	color.New(color.FgHiRed).Print(indent + detail.Code + " : ")
+	fmt.Println(detail.Message)
+	for _, d := range detail.Details {
+		printErrorDetail(d, indent+"  ")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/tarathep/apimtool/arm"
+)
+
+// Changes of the what-if result shared with the tests of arm
+func parseChanges(t *testing.T) []arm.Change {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("arm", "testdata", "whatif.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := arm.ParseWhatIf(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return changes
+}
+
+// Output of print without colors
+func captureOutput(t *testing.T, print func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, output, noColor := os.Stdout, color.Output, color.NoColor
+	os.Stdout, color.Output, color.NoColor = w, w, true
+	defer func() { os.Stdout, color.Output, color.NoColor = stdout, output, noColor }()
+
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+	print()
+	w.Close()
+	return <-done
+}
+
+func TestPrintChanges(t *testing.T) {
+	out := captureOutput(t, func() { printChanges(parseChanges(t)) })
+
+	for _, want := range []string{
+		"+  Create    Microsoft.ApiManagement/service/svc/backends/be1\n      url : https://a.com\n",
+		"~  Modify    Microsoft.ApiManagement/service/svc/apis/echo\n",
+		"      ~ properties.serviceUrl : \"https://a.com\" => \"https://b.com\"\n",
+		"      ~ properties.value\n",
+		"+    <set-backend-service backend-id=\"be1\"></set-backend-service>\n",
+		"-  Delete    Microsoft.ApiManagement/service/svc/backends/old\n      url : https://old.com\n",
+		"=  NoChange  Microsoft.ApiManagement/service/svc/apis/same\n",
+		"4 resource(s) : 1 to create, 1 to modify, 1 to delete, 1 no change\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printChanges output has no %q:\n%s", want, out)
+		}
+	}
+
+	if out := captureOutput(t, func() { printChanges([]arm.Change{}) }); out != "No change\n" {
+		t.Errorf("printChanges of no change = %q", out)
+	}
+}
+
+func TestChangesMarkdown(t *testing.T) {
+	md := changesMarkdown("What-if deploy", parseChanges(t))
+
+	for _, want := range []string{
+		"# What-if deploy\n\n|Change|Resource|\n|--|--|\n",
+		"|Create|`Microsoft.ApiManagement/service/svc/backends/be1`|\n",
+		"|Modify|`Microsoft.ApiManagement/service/svc/apis/echo`|\n",
+		"|Delete|`Microsoft.ApiManagement/service/svc/backends/old`|\n",
+		"## Modify `Microsoft.ApiManagement/service/svc/apis/echo`\n\n```diff\n",
+		"- properties.serviceUrl: \"https://a.com\"\n+ properties.serviceUrl: \"https://b.com\"\n",
+		"# properties.value\n", "+    <set-backend-service backend-id=\"be1\"></set-backend-service>\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("changesMarkdown has no %q:\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, "## Create") || strings.Contains(md, "## Delete") {
+		t.Errorf("changesMarkdown has details of create or delete:\n%s", md)
+	}
+
+	if md := changesMarkdown("What-if deploy", []arm.Change{}); md != "# What-if deploy\n\nNo change\n" {
+		t.Errorf("changesMarkdown of no change = %q", md)
+	}
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/tarathep/apimtool/apim"
+	"github.com/tarathep/apimtool/engine"
+)
+
+type UICommand struct {
+	ServiceOptions
+	FilePath string `long:"file-path" description:"Directory to export backends.template.json" default:"./templates"`
+}
+
+func (c *UICommand) Execute(args []string) error {
+	a, err := newAPIM()
+	if err != nil {
+		return err
+	}
+	b := &browser{APIM: a, resourceGroup: c.ResourceGroup, serviceName: c.ServiceName, exportDir: c.FilePath}
+	if err := step("Loading APIs and backends of "+c.ServiceName, b.load); err != nil {
+		return err
+	}
+	return b.run()
+}
+
+// Interactive browser of APIs and backends of a service
+type browser struct {
+	apim.APIM
+	resourceGroup string
+	serviceName   string
+	exportDir     string
+
+	apis     []apim.APIModel
+	backends []apim.Backend
+
+	app    *tview.Application
+	pages  *tview.Pages
+	search *tview.InputField
+	table  *tview.Table
+	detail *tview.TextView
+	status *tview.TextView
+
+	// "apis" or "backends", rows are the indexes of apis or backends shown in table
+	view string
+	rows []int
+}
+
+const helpText = "[yellow]Tab[-] APIs/Backends  [yellow]/[-] Search  [yellow]Enter[-] Operations  [yellow]p[-] Policy  " +
+	"[yellow]r[-] Rebind backend  [yellow]e[-] Export backends  [yellow]Ctrl+R[-] Reload  [yellow]q[-] Quit"
+
+func (b *browser) load() error {
+	apis, backends, err := b.fetch()
+	b.apis, b.backends = apis, backends
+	return err
+}
+
+// APIs and backends of the service sorted by name, backends are loaded again on each fetch
+func (b *browser) fetch() ([]apim.APIModel, []apim.Backend, error) {
+	a := b.APIM
+	a.Backends = nil
+	index, err := a.BackendIndex(b.resourceGroup, b.serviceName)
+	if err != nil {
+		return nil, nil, err
+	}
+	a.Backends = index
+
+	apis, err := a.ListAPIModel(b.resourceGroup, b.serviceName, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	backends := index.Filter("")
+	sort.SliceStable(apis, func(i, j int) bool { return apis[i].APIName < apis[j].APIName })
+	sort.SliceStable(backends, func(i, j int) bool { return backends[i].Name < backends[j].Name })
+	return apis, backends, nil
+}
+
+func (b *browser) run() error {
+	b.app = tview.NewApplication()
+	b.view = "apis"
+
+	b.search = tview.NewInputField().SetLabel("Search: ").SetFieldBackgroundColor(tcell.ColorDefault)
+	b.search.SetChangedFunc(func(string) { b.refresh() })
+	b.search.SetDoneFunc(func(tcell.Key) { b.app.SetFocus(b.table) })
+
+	b.table = tview.NewTable().SetSelectable(true, false).SetFixed(1, 0)
+	b.table.SetBorder(true)
+	b.table.SetSelectionChangedFunc(func(row, column int) { b.showDetail(row) })
+	b.table.SetSelectedFunc(func(row, column int) { b.showOperations(row) })
+	b.table.SetInputCapture(b.tableKeys)
+
+	b.detail = tview.NewTextView().SetDynamicColors(true).SetWrap(true)
+	b.detail.SetBorder(true).SetTitle(" Detail ")
+	b.status = tview.NewTextView().SetDynamicColors(true).SetText(helpText)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(b.search, 1, 0, false).
+		AddItem(tview.NewFlex().
+			AddItem(b.table, 0, 3, true).
+			AddItem(b.detail, 0, 2, false), 0, 1, true).
+		AddItem(b.status, 1, 0, false)
+
+	b.pages = tview.NewPages().AddPage("main", layout, true, true)
+	b.refresh()
+	return b.app.SetRoot(b.pages, true).SetFocus(b.table).Run()
+}
+
+func (b *browser) tableKeys(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyTab:
+		if b.view == "apis" {
+			b.view = "backends"
+		} else {
+			b.view = "apis"
+		}
+		b.refresh()
+		return nil
+	case tcell.KeyCtrlR:
+		b.reload()
+		return nil
+	}
+
+	row, _ := b.table.GetSelection()
+	switch event.Rune() {
+	case '/':
+		b.app.SetFocus(b.search)
+		return nil
+	case 'q':
+		b.app.Stop()
+		return nil
+	case 'p':
+		if api, ok := b.selectedAPI(row); ok {
+			b.showPolicy(api.APIName+" policy", func() (string, error) {
+				return b.GetAPIPolicyXML(b.resourceGroup, b.serviceName, api.APIName)
+			})
+		}
+		return nil
+	case 'r':
+		if api, ok := b.selectedAPI(row); ok {
+			b.rebind(api)
+		}
+		return nil
+	case 'e':
+		b.export()
+		return nil
+	}
+	return event
+}
+
+// Fill table of the view with rows matching search
+func (b *browser) refresh() {
+	query := strings.ToLower(b.search.GetText())
+	b.table.Clear()
+	b.rows = []int{}
+
+	header := func(titles ...string) {
+		for i, title := range titles {
+			b.table.SetCell(0, i, tview.NewTableCell(title).SetTextColor(tcell.ColorFuchsia).SetSelectable(false))
+		}
+	}
+	cell := func(row, column int, text string) {
+		b.table.SetCell(row, column, tview.NewTableCell(tview.Escape(text)).SetExpansion(1))
+	}
+
+	if b.view == "apis" {
+		header("NAME", "Path", "Backend")
+		for i, api := range b.apis {
+			if !strings.Contains(strings.ToLower(api.APIName+" "+api.APIDisplayName+" "+api.APIPath+" "+api.BackendPolicyID), query) {
+				continue
+			}
+			b.rows = append(b.rows, i)
+			cell(len(b.rows), 0, api.APIName)
+			cell(len(b.rows), 1, api.APIPath)
+			cell(len(b.rows), 2, api.BackendPolicyID)
+		}
+		b.table.SetTitle(fmt.Sprintf(" APIs (%d/%d) ", len(b.rows), len(b.apis)))
+	} else {
+		header("NAME", "BackendURL", "Protocol")
+		for i, backend := range b.backends {
+			if !strings.Contains(strings.ToLower(backend.Name+" "+backend.URL), query) {
+				continue
+			}
+			b.rows = append(b.rows, i)
+			cell(len(b.rows), 0, backend.Name)
+			cell(len(b.rows), 1, backend.URL)
+			cell(len(b.rows), 2, backend.Protocol)
+		}
+		b.table.SetTitle(fmt.Sprintf(" Backends (%d/%d) ", len(b.rows), len(b.backends)))
+	}
+
+	b.table.Select(1, 0).ScrollToBeginning()
+	b.showDetail(1)
+}
+
+func (b *browser) selectedAPI(row int) (apim.APIModel, bool) {
+	if b.view != "apis" || row < 1 || row > len(b.rows) {
+		return apim.APIModel{}, false
+	}
+	return b.apis[b.rows[row-1]], true
+}
+
+func (b *browser) selectedBackend(row int) (apim.Backend, bool) {
+	if b.view != "backends" || row < 1 || row > len(b.rows) {
+		return apim.Backend{}, false
+	}
+	return b.backends[b.rows[row-1]], true
+}
+
+func (b *browser) showDetail(row int) {
+	b.detail.Clear()
+	field := func(name, value string) {
+		fmt.Fprintf(b.detail, "[gray]%s :[-] %s\n", name, tview.Escape(value))
+	}
+
+	if api, ok := b.selectedAPI(row); ok {
+		field("API NAME", api.APIName)
+		field("API DISPLAY NAME", api.APIDisplayName)
+		field("PROTOCOL(s)", strings.Join(api.APIProtocols, " "))
+		field("PATH", api.APIPath)
+		field("Backend URL", api.APIBackendURL)
+		field("Backend Policy ID", api.BackendPolicyID)
+		field("Backend Policy URL", api.BackendPolicyURL)
+		fmt.Fprintf(b.detail, "\n[gray]Operations :[-]\n")
+		for _, operation := range api.Operation {
+			fmt.Fprintf(b.detail, "  [%s]%-7s[-] %s\n", methodColor(operation.Method), operation.Method, tview.Escape(operation.URLTemplate))
+		}
+	}
+
+	if backend, ok := b.selectedBackend(row); ok {
+		field("BACKEND NAME", backend.Name)
+		field("BACKEND URL", backend.URL)
+		field("BACKEND Protocol", backend.Protocol)
+		depends := apim.DependingOnBackend(b.apis, backend.Name, "", apim.URLMatchPrefix)
+		fmt.Fprintf(b.detail, "\n[gray]Depending APIs (%d) :[-]\n", len(depends))
+		for _, api := range depends {
+			fmt.Fprintf(b.detail, "  %s  %s\n", tview.Escape(api.APIName), tview.Escape(api.APIPath))
+		}
+	}
+	b.detail.ScrollToBeginning()
+}
+
+func methodColor(method string) string {
+	switch method {
+	case "GET":
+		return "blue"
+	case "POST":
+		return "green"
+	case "PUT":
+		return "yellow"
+	case "DELETE":
+		return "red"
+	case "PATCH":
+		return "aqua"
+	}
+	return "gray"
+}
+
+// Operations of the API, Enter shows the policy of the operation
+func (b *browser) showOperations(row int) {
+	api, ok := b.selectedAPI(row)
+	if !ok {
+		return
+	}
+
+	operations := tview.NewTable().SetSelectable(true, false).SetFixed(1, 0)
+	operations.SetBorder(true).SetTitle(" " + api.APIName + " operations, Enter policy, Esc back ")
+	for i, title := range []string{"NAME", "Method", "URL Template"} {
+		operations.SetCell(0, i, tview.NewTableCell(title).SetTextColor(tcell.ColorFuchsia).SetSelectable(false))
+	}
+	for i, operation := range api.Operation {
+		operations.SetCell(i+1, 0, tview.NewTableCell(tview.Escape(operation.Name)).SetExpansion(1))
+		operations.SetCell(i+1, 1, tview.NewTableCell(operation.Method).SetTextColor(tcell.GetColor(methodColor(operation.Method))))
+		operations.SetCell(i+1, 2, tview.NewTableCell(tview.Escape(operation.URLTemplate)).SetExpansion(1))
+	}
+	operations.SetSelectedFunc(func(row, column int) {
+		if row < 1 || row > len(api.Operation) {
+			return
+		}
+		operation := api.Operation[row-1]
+		b.showPolicy(api.APIName+" "+operation.Name+" policy", func() (string, error) {
+			return b.GetOperationPolicyXML(b.resourceGroup, b.serviceName, api.APIName, operation.Name)
+		})
+	})
+	operations.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEscape {
+			b.pages.RemovePage("operations")
+		}
+	})
+	b.pages.AddPage("operations", operations, true, true)
+}
+
+// Policy XML fetched by get, loaded in background
+func (b *browser) showPolicy(title string, get func() (string, error)) {
+	view := tview.NewTextView().SetDynamicColors(true).SetText("[gray]Loading...")
+	view.SetBorder(true).SetTitle(" " + title + ", Esc back ")
+	view.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEscape {
+			b.pages.RemovePage("policy")
+		}
+	})
+	b.pages.AddPage("policy", view, true, true)
+
+	go func() {
+		policy, err := get()
+		b.app.QueueUpdateDraw(func() {
+			switch {
+			case err != nil:
+				view.SetText("[red]" + tview.Escape(err.Error()))
+			case policy == "":
+				view.SetText("[gray]No policy")
+			default:
+				view.SetText(tview.Escape(policy))
+			}
+		})
+	}()
+}
+
+// Ask to rebind the backend of the API, the backend ID is completed from backends
+func (b *browser) rebind(api apim.APIModel) {
+	if err := b.guard(); err != nil {
+		b.message(err.Error())
+		return
+	}
+
+	backendIDs := []string{}
+	for _, backend := range b.backends {
+		backendIDs = append(backendIDs, backend.Name)
+	}
+
+	form := tview.NewForm()
+	form.AddInputField("Backend ID", api.BackendPolicyID, 40, nil, nil)
+	input := form.GetFormItem(0).(*tview.InputField)
+	input.SetAutocompleteFunc(func(text string) []string {
+		matches := []string{}
+		for _, id := range backendIDs {
+			if text != "" && strings.Contains(strings.ToLower(id), strings.ToLower(text)) {
+				matches = append(matches, id)
+			}
+		}
+		return matches
+	})
+	form.AddButton("Rebind", func() {
+		backendID := strings.TrimSpace(input.GetText())
+		b.pages.RemovePage("rebind")
+		if backendID == "" || backendID == api.BackendPolicyID {
+			return
+		}
+		b.confirm("Rebind API "+api.APIName+" from backend "+api.BackendPolicyID+" to "+backendID+" on "+b.serviceName+"?", func() {
+			b.background("Rebinding "+api.APIName, func() error {
+				record := serviceRecord(b.APIM, b.resourceGroup, b.serviceName, "rebind", "api/"+api.APIName)
+				before, after, err := b.RebindAPIBackend(b.resourceGroup, b.serviceName, api.APIName, api.BackendPolicyID, backendID)
+				if err != nil {
+					return err
+				}
+				record.Before, record.After = before, after
+				record.Diff = engine.UnifiedDiff("a/"+api.APIName+"/policy", "b/"+api.APIName+"/policy", before, after)
+				writeAudit(record)
+				return nil
+			})
+		})
+	})
+	form.AddButton("Cancel", func() { b.pages.RemovePage("rebind") })
+	form.SetCancelFunc(func() { b.pages.RemovePage("rebind") })
+	form.SetBorder(true).SetTitle(" Rebind backend of " + api.APIName + " ")
+	b.pages.AddPage("rebind", center(form, 60, 9), true, true)
+}
+
+// Ask to export backends.template.json from the service
+func (b *browser) export() {
+	after, err := b.BackendsTemplate(b.resourceGroup, b.serviceName)
+	if err != nil {
+		b.message(err.Error())
+		return
+	}
+	change := engine.FileChange{Path: apim.BackendsTemplatePath(b.exportDir), After: after}
+	change.Before, _ = os.ReadFile(change.Path)
+	diff := change.Diff()
+	if diff == "" {
+		b.message(change.Path + " is up to date")
+		return
+	}
+
+	changed := 0
+	for _, line := range strings.Split(diff, "\n") {
+		if (strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-")) && !strings.HasPrefix(line, "+++") && !strings.HasPrefix(line, "---") {
+			changed++
+		}
+	}
+	b.confirm(fmt.Sprintf("Export backends of %s to %s, %d line(s) changed?", b.serviceName, change.Path, changed), func() {
+		b.background("Exporting "+change.Path, func() error {
+			if err := change.Apply(); err != nil {
+				return err
+			}
+			record := serviceRecord(b.APIM, b.resourceGroup, b.serviceName, "export", change.Path)
+			record.Diff = diff
+			writeAudit(record)
+			return nil
+		})
+	})
+}
+
+// Changes on protected services require --allow-production, the service name cannot be typed in the UI
+func (b *browser) guard() error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if config.IsProtected(b.resourceGroup, b.serviceName) && !options.AllowProduction {
+		return fmt.Errorf("%w %s/%s, use --allow-production to change", errProtected, b.resourceGroup, b.serviceName)
+	}
+	return nil
+}
+
+func (b *browser) confirm(text string, yes func()) {
+	modal := tview.NewModal().SetText(text).AddButtons([]string{"No", "Yes"})
+	modal.SetDoneFunc(func(index int, label string) {
+		b.pages.RemovePage("confirm")
+		if label == "Yes" {
+			yes()
+		}
+	})
+	b.pages.AddPage("confirm", modal, true, true)
+}
+
+func (b *browser) message(text string) {
+	modal := tview.NewModal().SetText(text).AddButtons([]string{"OK"})
+	modal.SetDoneFunc(func(int, string) { b.pages.RemovePage("message") })
+	b.pages.AddPage("message", modal, true, true)
+}
+
+// Run action in background with its label on status bar, then reload APIs and backends and show the result
+func (b *browser) background(label string, action func() error) {
+	b.status.SetText("[yellow]" + tview.Escape(label) + "...")
+	go func() {
+		var (
+			apis     []apim.APIModel
+			backends []apim.Backend
+		)
+		err := action()
+		if err == nil {
+			apis, backends, err = b.fetch()
+		}
+		b.app.QueueUpdateDraw(func() {
+			b.status.SetText(helpText)
+			if err != nil {
+				b.message(label + " : Fail\n\n" + err.Error())
+				return
+			}
+			b.apis, b.backends = apis, backends
+			b.refresh()
+			b.message(label + " : Done")
+		})
+	}()
+}
+
+func (b *browser) reload() {
+	b.background("Reloading", func() error { return nil })
+}
+
+// Primitive centered with width and height
+func center(p tview.Primitive, width, height int) tview.Primitive {
+	return tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 1, true).
+			AddItem(nil, 0, 1, false), width, 1, true).
+		AddItem(nil, 0, 1, false)
+}